@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// draining — режим обслуживания: новые задачи не принимаются, а уже
+// запущенные, /status и /download продолжают работать.
+var draining atomic.Bool
+
+// requireAdmin пропускает только запросы с "Authorization: Bearer $ADMIN_TOKEN".
+// Без ADMIN_TOKEN админские эндпоинты отключены.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := getenv("ADMIN_TOKEN", "")
+		if token == "" {
+			http.Error(w, "admin endpoints are disabled", http.StatusForbidden)
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func adminDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	draining.Store(true)
+	log.Printf("Drain mode enabled, /process now rejects new jobs")
+	writeJSON(w, http.StatusOK, map[string]any{"draining": true})
+}
+
+func adminUndrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	draining.Store(false)
+	log.Printf("Drain mode disabled")
+	writeJSON(w, http.StatusOK, map[string]any{"draining": false})
+}
+
+func readyz(w http.ResponseWriter, r *http.Request) {
+	if draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"ready": false, "draining": true})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ready": true, "draining": false})
+}
+
+// load — GET /load: сигнал нагрузки для автоскейлера (KEDA/HPA).
+// Читает только длину канала и атомарный счётчик, без блокировок.
+func load(w http.ResponseWriter, r *http.Request) {
+	running, capacity := len(runSlots), cap(runSlots)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"running":            running,
+		"queued":             queuedRuns.Load(),
+		"semaphore_capacity": capacity,
+		"utilization":        float64(running) / float64(capacity),
+	})
+}
+
+// adminSearch — GET /search?q=: поиск сохранённых результатов по части
+// имени файла, когда id потерян. Видит записи всех tenant'ов, поэтому
+// только для администратора.
+func adminSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" || len(q) > 128 {
+		http.Error(w, "q must be 1..128 characters", http.StatusBadRequest)
+		return
+	}
+	limit := getenvInt("SEARCH_MAX_RESULTS", 50)
+	hits := store.Search(q, limit)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"query":     q,
+		"results":   hits,
+		"truncated": len(hits) >= limit,
+	})
+}
+
+// startedAt — момент запуска процесса, выставляется первым делом в main.
+var startedAt time.Time
+
+// uptime — GET /uptime: по сбросу uptime_seconds мониторинг замечает
+// неожиданные перезапуски.
+func uptime(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"start_time":     startedAt.UTC().Format(time.RFC3339),
+		"uptime_seconds": time.Since(startedAt).Seconds(),
+	})
+}
+
+// rejectIfDraining отвечает 503 с Retry-After, если сервер в режиме drain.
+func rejectIfDraining(w http.ResponseWriter) bool {
+	if !draining.Load() {
+		return false
+	}
+	retry := getenvDuration("DRAIN_RETRY_AFTER", time.Minute)
+	w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())))
+	http.Error(w, "server is draining, try again later", http.StatusServiceUnavailable)
+	return true
+}
+
+func adminCancelAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cancelled, dequeued := jobs.CancelAll()
+	log.Printf("Admin cancel-all: %d running jobs cancelled, %d queued jobs dropped", cancelled, dequeued)
+	writeJSON(w, http.StatusOK, map[string]any{"cancelled": cancelled, "dequeued": dequeued})
+}
+
+// adminJobOutput отдаёт сырой stdout/stderr завершённой задачи для отладки
+// runner.py: клиентам уходят только обезличенные сообщения об ошибках.
+func adminJobOutput(w http.ResponseWriter, r *http.Request) {
+	job, ok := jobs.Lookup(r.URL.Query().Get("id"))
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if job.output == nil {
+		http.Error(w, "job has no captured output yet (state: "+job.State+")", http.StatusConflict)
+		return
+	}
+	out := job.output
+	writeJSON(w, http.StatusOK, map[string]any{
+		"job_id":           job.ID,
+		"state":            job.State,
+		"stdout":           string(out.Stdout),
+		"stdout_bytes":     out.StdoutBytes,
+		"stdout_truncated": out.StdoutTruncated,
+		"stderr":           string(out.Stderr),
+		"stderr_bytes":     out.StderrBytes,
+		"stderr_truncated": out.StderrTruncated,
+	})
+}
+
+// adminFlush удаляет все сохранённые файлы результатов, например после
+// изменения логики runner.py. С ?jobs=1 из истории удаляются и завершённые
+// задачи вместе со сводками и метриками, которые отдают /summary и /compare.
+// Очередь и работающие задачи не трогаются.
+func adminFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	removed, freed := store.Clear()
+	resp := map[string]any{"results_removed": removed, "bytes_freed": freed, "results_remaining": store.Len()}
+	if r.URL.Query().Get("jobs") == "1" {
+		n := jobs.Clear()
+		resp["jobs_removed"] = n
+		log.Printf("Admin flush: %d stored results (%d bytes) and %d finished jobs removed", removed, freed, n)
+	} else {
+		log.Printf("Admin flush: %d stored results (%d bytes) removed", removed, freed)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminFlush(t *testing.T) {
+	defer func(s *resultStore, j *jobRegistry) { store, jobs = s, j }(store, jobs)
+	store = newResultStore(10)
+	jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+
+	flush := func(query string) map[string]float64 {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		adminFlush(rec, httptest.NewRequest(http.MethodPost, "/admin/flush"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST /admin/flush%s: %d %s", query, rec.Code, rec.Body)
+		}
+		var got map[string]float64
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	store.Store("a", newRecord("classic.csv", []byte("12345"), ""))
+	store.Store("b", newRecord("quantum.csv", []byte("123"), "t1"))
+	expired := newRecord("old.csv", []byte("1"), "")
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	store.Store("c", expired)
+	jobs.Start(&jobRecord{ID: "done"}, nil)
+	jobs.Finish("done", map[string]string{"classic_csv": "a"})
+	jobs.Start(&jobRecord{ID: "running"}, nil)
+	jobs.Running("running")
+
+	got := flush("")
+	want := map[string]float64{"results_removed": 3, "bytes_freed": 9, "results_remaining": 0}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v (%v)", k, got[k], v, got)
+		}
+	}
+	if _, ok := got["jobs_removed"]; ok {
+		t.Errorf("job history flushed without ?jobs=1: %v", got)
+	}
+	if _, ok := jobs.Lookup("done"); !ok {
+		t.Error("finished job removed without ?jobs=1")
+	}
+
+	store.Store("d", newRecord("classic.csv", []byte("xy"), ""))
+	got = flush("?jobs=1")
+	if got["results_removed"] != 1 || got["jobs_removed"] != 1 {
+		t.Errorf("flush with jobs=1 = %v, want 1 result and 1 job", got)
+	}
+	if _, ok := jobs.Lookup("running"); !ok {
+		t.Error("running job must survive a flush")
+	}
+	if !jobs.Pruned("done", "") {
+		t.Error("flushed job must answer 410 on /status")
+	}
+
+	rec := httptest.NewRecorder()
+	adminFlush(rec, httptest.NewRequest(http.MethodGet, "/admin/flush", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /admin/flush = %d, want 405", rec.Code)
+	}
+}
+
+func TestDrainMode(t *testing.T) {
+	defer draining.Store(false)
+	t.Setenv("ADMIN_TOKEN", "s3cret")
+	t.Setenv("DRAIN_RETRY_AFTER", "90s")
+	call := func(h http.HandlerFunc, method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	if rec := call(requireAdmin(adminDrain), http.MethodPost, "/admin/drain", "wrong"); rec.Code != http.StatusUnauthorized || draining.Load() {
+		t.Fatalf("drain with a wrong token: %d, draining=%v", rec.Code, draining.Load())
+	}
+	if rec := call(requireAdmin(adminDrain), http.MethodPost, "/admin/drain", "s3cret"); rec.Code != http.StatusOK {
+		t.Fatalf("drain: %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(readyz, http.MethodGet, "/readyz", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz while draining: %d", rec.Code)
+	}
+	rec := postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "90" {
+		t.Errorf("process while draining: %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	if rec := call(requireAdmin(adminUndrain), http.MethodPost, "/admin/undrain", "s3cret"); rec.Code != http.StatusOK {
+		t.Fatalf("undrain: %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(readyz, http.MethodGet, "/readyz", ""); rec.Code != http.StatusOK {
+		t.Errorf("readyz after undrain: %d", rec.Code)
+	}
+
+	t.Setenv("ADMIN_TOKEN", "")
+	if rec := call(requireAdmin(adminDrain), http.MethodPost, "/admin/drain", "s3cret"); rec.Code != http.StatusForbidden || draining.Load() {
+		t.Errorf("drain without ADMIN_TOKEN: %d, draining=%v", rec.Code, draining.Load())
+	}
+}
+
+func TestAdminCancelAll(t *testing.T) {
+	defer func(j *jobRegistry) { jobs = j }(jobs)
+	jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+	fakeRunner(t, "import time\ntime.sleep(10)\n")
+
+	// Синхронный запуск висит в runner.py, пока его не отменят.
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for countState(jobRunning) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("job never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	queuedCtx, queuedCancel := context.WithCancelCause(context.Background())
+	jobs.Start(&jobRecord{ID: "queued"}, queuedCancel)
+	jobs.Start(&jobRecord{ID: "finished"}, nil)
+	jobs.Finish("finished", nil)
+
+	rec := httptest.NewRecorder()
+	adminCancelAll(rec, httptest.NewRequest(http.MethodPost, "/admin/cancel-all", nil))
+	var got map[string]float64
+	json.Unmarshal(rec.Body.Bytes(), &got)
+	if got["cancelled"] != 1 || got["dequeued"] != 1 {
+		t.Errorf("cancel-all = %v, want 1 cancelled and 1 dequeued", got)
+	}
+	if !errors.Is(context.Cause(queuedCtx), errJobCancelled) {
+		t.Errorf("queued job cause = %v", context.Cause(queuedCtx))
+	}
+	select {
+	case rec := <-done:
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "cancelled") {
+			t.Errorf("cancelled run answered %d %s", rec.Code, rec.Body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("running job was not interrupted")
+	}
+	if job, _ := jobs.Lookup("finished"); job.State != jobDone {
+		t.Errorf("finished job state = %s", job.State)
+	}
+}
+
+// countState — сколько задач в реестре в состоянии state.
+func countState(state string) int {
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+	n := 0
+	for _, job := range jobs.jobs {
+		if job.State == state {
+			n++
+		}
+	}
+	return n
+}
+
+func TestAdminJobOutput(t *testing.T) {
+	t.Setenv("JOB_OUTPUT_MAX_BYTES", "100")
+	fakeRunner(t, `import json, sys
+sys.stderr.write("E" * 250)
+print(json.dumps({"ok": True, "results": [], "summary": {"pad": "x" * 300}}))
+`)
+	got := decodeBody(t, postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil), http.StatusOK)
+	id := got["job_id"].(string)
+
+	get := func(id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		adminJobOutput(rec, httptest.NewRequest(http.MethodGet, "/admin/job-output?id="+id, nil))
+		return rec
+	}
+	out := decodeBody(t, get(id), http.StatusOK)
+	// Сохраняются первые JOB_OUTPUT_MAX_BYTES, но полный размер известен.
+	if len(out["stderr"].(string)) != 100 || out["stderr_bytes"] != float64(250) || out["stderr_truncated"] != true {
+		t.Errorf("stderr: %d bytes kept, %v total, truncated %v", len(out["stderr"].(string)), out["stderr_bytes"], out["stderr_truncated"])
+	}
+	if len(out["stdout"].(string)) != 100 || out["stdout_bytes"].(float64) <= 300 || out["stdout_truncated"] != true {
+		t.Errorf("stdout: %d bytes kept, %v total, truncated %v", len(out["stdout"].(string)), out["stdout_bytes"], out["stdout_truncated"])
+	}
+
+	if rec := get(genID()); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: %d, want 404", rec.Code)
+	}
+	queued := genID()
+	jobs.Start(&jobRecord{ID: queued}, nil)
+	if rec := get(queued); rec.Code != http.StatusConflict {
+		t.Errorf("job without output: %d, want 409", rec.Code)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	defer func(s chan struct{}) { runSlots = s }(runSlots)
+	runSlots = make(chan struct{}, 2)
+	get := func() map[string]float64 {
+		rec := httptest.NewRecorder()
+		load(rec, httptest.NewRequest(http.MethodGet, "/load", nil))
+		var got map[string]float64
+		json.Unmarshal(rec.Body.Bytes(), &got)
+		return got
+	}
+	want := func(running, queued, utilization float64) {
+		t.Helper()
+		got := get()
+		if got["running"] != running || got["queued"] != queued || got["semaphore_capacity"] != 2 || got["utilization"] != utilization {
+			t.Errorf("load = %v, want running %g, queued %g, utilization %g", got, running, queued, utilization)
+		}
+	}
+
+	want(0, 0, 0)
+	release1, _ := acquireRunSlot(context.Background())
+	want(1, 0, 0.5)
+	release2, _ := acquireRunSlot(context.Background())
+
+	acquired := make(chan func())
+	go func() {
+		release, _ := acquireRunSlot(context.Background())
+		acquired <- release
+	}()
+	for deadline := time.Now().Add(5 * time.Second); queuedRuns.Load() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("third run never queued")
+		}
+	}
+	want(2, 1, 1)
+
+	release1()
+	release3 := <-acquired
+	want(2, 0, 1)
+	release2()
+	release3()
+	want(0, 0, 0)
+}
+
+func TestUptime(t *testing.T) {
+	defer func(s time.Time) { startedAt = s }(startedAt)
+	startedAt = time.Now().Add(-90 * time.Second)
+
+	rec := httptest.NewRecorder()
+	uptime(rec, httptest.NewRequest(http.MethodGet, "/uptime", nil))
+	got := decodeBody(t, rec, http.StatusOK)
+	if secs := got["uptime_seconds"].(float64); secs < 90 || secs > 120 {
+		t.Errorf("uptime_seconds = %v, want about 90", secs)
+	}
+	start, err := time.Parse(time.RFC3339, got["start_time"].(string))
+	if err != nil || !start.Equal(startedAt.Truncate(time.Second)) {
+		t.Errorf("start_time = %v (%v), want %v", got["start_time"], err, startedAt.UTC())
+	}
+}
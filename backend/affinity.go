@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// cpuSets — наборы ядер из CPU_AFFINITY; запуски runner.py получают их по
+// кругу. Пусто — привязка не используется.
+var cpuSets [][]int
+
+var nextCPUSet atomic.Uint64
+
+// parseCPUSets разбирает CPU_AFFINITY: наборы через ";", внутри —
+// номера и диапазоны через ",", например "0-7;8-15" или "0,2,4;1,3,5".
+func parseCPUSets(v string) ([][]int, error) {
+	var sets [][]int
+	for _, part := range strings.Split(v, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		var set []int
+		for _, item := range strings.Split(part, ",") {
+			lo, hi, isRange := strings.Cut(strings.TrimSpace(item), "-")
+			first, err := strconv.Atoi(lo)
+			last := first
+			if err == nil && isRange {
+				last, err = strconv.Atoi(hi)
+			}
+			if err != nil || first < 0 || last < first || last >= maxAffinityCPU {
+				return nil, fmt.Errorf("invalid CPU range %q in %q", item, part)
+			}
+			for cpu := first; cpu <= last; cpu++ {
+				set = append(set, cpu)
+			}
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
+
+// assignCPUSet выдаёт следующий набор ядер по кругу; nil — без привязки.
+func assignCPUSet() []int {
+	if len(cpuSets) == 0 {
+		return nil
+	}
+	return cpuSets[(nextCPUSet.Add(1)-1)%uint64(len(cpuSets))]
+}
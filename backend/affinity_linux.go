@@ -0,0 +1,27 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// maxAffinityCPU — размер маски cpu_set_t в glibc (CPU_SETSIZE).
+const maxAffinityCPU = 1024
+
+// setAffinity привязывает только что запущенный процесс к ядрам cpus через
+// sched_setaffinity. Как и niceness, маску наследуют потоки и дочерние
+// процессы, созданные после вызова.
+func setAffinity(pid int, cpus []int) error {
+	var mask [maxAffinityCPU / 64]uint64
+	for _, cpu := range cpus {
+		mask[cpu/64] |= 1 << (cpu % 64)
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY,
+		uintptr(pid), unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
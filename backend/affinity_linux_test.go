@@ -0,0 +1,38 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestRunnerCPUAffinity(t *testing.T) {
+	defer func(s [][]int) { cpuSets = s }(cpuSets)
+	// Привязка выставляется сразу после старта; скрипт ждёт, чтобы её увидеть.
+	script := writeScript(t, "import json, os, time\ntime.sleep(0.3)\nprint(json.dumps(sorted(os.sched_getaffinity(0))))\n")
+	affinity := func() []int {
+		t.Helper()
+		var stdout bytes.Buffer
+		if err := runPython(context.Background(), snapshotSettings(), []string{script}, &stdout, nil); err != nil {
+			t.Fatal(err)
+		}
+		var cpus []int
+		if err := json.Unmarshal(stdout.Bytes(), &cpus); err != nil {
+			t.Fatalf("runner output %q: %v", stdout.String(), err)
+		}
+		return cpus
+	}
+
+	cpuSets = nil
+	allowed := affinity()
+	// Последнее доступное ядро: на многоядерной машине маска сужается.
+	last := allowed[len(allowed)-1]
+	cpuSets = [][]int{{last}}
+	if got := affinity(); !slices.Equal(got, []int{last}) {
+		t.Errorf("runner pinned to %v, want [%d] (allowed %v)", got, last, allowed)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+const maxAffinityCPU = 1024
+
+func setAffinity(pid int, cpus []int) error {
+	return errors.New("CPU_AFFINITY is only supported on Linux")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCPUSets(t *testing.T) {
+	tests := []struct {
+		value string
+		want  [][]int // nil — значение отклоняется
+	}{
+		{"0-3;4-7", [][]int{{0, 1, 2, 3}, {4, 5, 6, 7}}},
+		{"0,2,4; 1,3,5", [][]int{{0, 2, 4}, {1, 3, 5}}},
+		{"0-1,6;;", [][]int{{0, 1, 6}}},
+		{"3-1", nil},
+		{"-1", nil},
+		{"a-b", nil},
+		{"0-1024", nil},
+	}
+	for _, tt := range tests {
+		got, err := parseCPUSets(tt.value)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("parseCPUSets(%q) = %v, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCPUSets(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+	if sets, err := parseCPUSets(""); err != nil || sets != nil {
+		t.Errorf("empty CPU_AFFINITY = %v, %v, want no sets", sets, err)
+	}
+}
+
+func TestAssignCPUSetRoundRobin(t *testing.T) {
+	defer func(s [][]int) { cpuSets = s }(cpuSets)
+	cpuSets = nil
+	if got := assignCPUSet(); got != nil {
+		t.Fatalf("without CPU_AFFINITY got %v", got)
+	}
+	cpuSets = [][]int{{0}, {1}, {2}}
+	first := assignCPUSet()[0]
+	for i := 1; i <= 4; i++ {
+		if got := assignCPUSet()[0]; got != (first+i)%3 {
+			t.Errorf("assignment %d = %d, want %d", i, got, (first+i)%3)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// failureAlert — тело POST на FAILURE_WEBHOOK при сбое задачи.
+type failureAlert struct {
+	JobID     string `json:"job_id"`
+	Reason    string `json:"reason"`
+	Filename  string `json:"filename,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// alertDebounce помнит, когда уходил алерт с той же причиной и файлом,
+// чтобы серия одинаковых сбоев не превращалась в серию вызовов.
+var alertDebounce = struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}{last: map[string]time.Time{}}
+
+// alertFailure отправляет алерт о сбое задачи, если задан FAILURE_WEBHOOK.
+// Одинаковые алерты (причина + файл) в пределах FAILURE_WEBHOOK_DEBOUNCE
+// пропускаются. Отправка идёт в фоне и запрос не задерживает.
+func alertFailure(job jobRecord) {
+	url := getenv("FAILURE_WEBHOOK", "")
+	if url == "" {
+		return
+	}
+	alert := failureAlert{JobID: job.ID, Reason: job.Error, RequestID: job.requestID}
+	if job.Source != nil {
+		alert.Filename = job.Source.Filename
+	}
+	now := time.Now()
+	key := alert.Reason + "\x00" + alert.Filename
+	window := getenvDuration("FAILURE_WEBHOOK_DEBOUNCE", 5*time.Minute)
+	alertDebounce.mu.Lock()
+	if last, ok := alertDebounce.last[key]; ok && now.Sub(last) < window {
+		alertDebounce.mu.Unlock()
+		return
+	}
+	alertDebounce.last[key] = now
+	for k, t := range alertDebounce.last {
+		if now.Sub(t) >= window {
+			delete(alertDebounce.last, k)
+		}
+	}
+	alertDebounce.mu.Unlock()
+
+	go func() {
+		if err := sendAlert(url, alert, getenvInt("FAILURE_WEBHOOK_RETRIES", 3)); err != nil {
+			log.Printf("Failure webhook for job %s not delivered: %v", alert.JobID, err)
+		}
+	}()
+}
+
+// sendAlert делает до retries+1 попыток с экспоненциальной паузой от
+// секунды; успехом считается любой ответ 2xx.
+func sendAlert(url string, alert failureAlert, retries int) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err = postAlert(client, url, body)
+		if err == nil || attempt >= retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func postAlert(client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// alertServer принимает алерты в канал; первые fail запросов получают 503.
+func alertServer(t *testing.T, fail int32) (*httptest.Server, <-chan failureAlert) {
+	t.Helper()
+	alerts := make(chan failureAlert, 10)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var a failureAlert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Errorf("decode alert: %v", err)
+		}
+		alerts <- a
+	}))
+	t.Cleanup(srv.Close)
+	return srv, alerts
+}
+
+func resetAlertDebounce() {
+	alertDebounce.mu.Lock()
+	alertDebounce.last = map[string]time.Time{}
+	alertDebounce.mu.Unlock()
+}
+
+func TestAlertFailureDebounce(t *testing.T) {
+	defer func(j *jobRegistry) { jobs = j }(jobs)
+	srv, alerts := alertServer(t, 0)
+	t.Setenv("FAILURE_WEBHOOK", srv.URL)
+	t.Setenv("FAILURE_WEBHOOK_RETRIES", "0")
+
+	type failure struct{ reason, filename string }
+	tests := []struct {
+		name     string
+		window   string
+		failures []failure
+		want     int
+	}{
+		{"single", "1m", []failure{{"timeout", "a.csv"}}, 1},
+		{"identical within window", "1m", []failure{{"timeout", "a.csv"}, {"timeout", "a.csv"}, {"timeout", "a.csv"}}, 1},
+		{"different file", "1m", []failure{{"timeout", "a.csv"}, {"timeout", "b.csv"}}, 2},
+		{"different reason", "1m", []failure{{"timeout", "a.csv"}, {"stalled", "a.csv"}}, 2},
+		{"no debounce", "0s", []failure{{"timeout", "a.csv"}, {"timeout", "a.csv"}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FAILURE_WEBHOOK_DEBOUNCE", tt.window)
+			resetAlertDebounce()
+			jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+			ids := map[string]bool{}
+			for _, f := range tt.failures {
+				id := genID()
+				ids[id] = true
+				jobs.Start(&jobRecord{ID: id, Source: &jobSource{Filename: f.filename}, requestID: "req-" + id}, nil)
+				jobs.Fail(id, f.reason)
+			}
+			for i := 0; i < tt.want; i++ {
+				select {
+				case a := <-alerts:
+					if !ids[a.JobID] || a.RequestID != "req-"+a.JobID || a.Reason == "" || a.Filename == "" {
+						t.Errorf("alert = %+v", a)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("got %d alerts, want %d", i, tt.want)
+				}
+			}
+			select {
+			case a := <-alerts:
+				t.Errorf("unexpected alert %+v", a)
+			case <-time.After(200 * time.Millisecond):
+			}
+		})
+	}
+
+	t.Run("no webhook", func(t *testing.T) {
+		t.Setenv("FAILURE_WEBHOOK", "")
+		resetAlertDebounce()
+		alertFailure(jobRecord{ID: genID(), Error: "timeout"})
+		select {
+		case a := <-alerts:
+			t.Errorf("unexpected alert %+v", a)
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+}
+
+func TestSendAlertRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		fail    int32
+		retries int
+		wantErr bool
+	}{
+		{"first attempt", 0, 0, false},
+		{"retried after 503", 1, 1, false},
+		{"retries exhausted", 1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, alerts := alertServer(t, tt.fail)
+			err := sendAlert(srv.URL, failureAlert{JobID: "j1", Reason: "timeout"}, tt.retries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sendAlert = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if a := <-alerts; a.JobID != "j1" || a.Reason != "timeout" {
+				t.Errorf("alert = %+v", a)
+			}
+		})
+	}
+}
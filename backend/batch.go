@@ -0,0 +1,161 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// extractBatch распаковывает zip с входными файлами в destDir и возвращает
+// пути распакованных .csv/.txt. Записи с путями вне архива (zip-slip)
+// отклоняют весь архив; прочие файлы пропускаются. Лимиты maxFiles и
+// maxBytes проверяются по ходу распаковки, а не по заголовкам архива.
+func extractBatch(zipPath, destDir string, maxFiles int, maxBytes int64) ([]string, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("not a zip archive: %w", err)
+	}
+	defer zr.Close()
+
+	var (
+		paths []string
+		total int64
+	)
+	for _, f := range zr.File {
+		if !filepath.IsLocal(f.Name) || strings.Contains(f.Name, `\`) {
+			return nil, fmt.Errorf("archive entry %q escapes the archive root", truncate(f.Name, 128))
+		}
+		if f.FileInfo().IsDir() || !allowedExtension(filepath.Ext(f.Name)) ||
+			strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(filepath.Base(f.Name), ".") {
+			continue
+		}
+		if maxFiles > 0 && len(paths) >= maxFiles {
+			return nil, fmt.Errorf("archive has more than %d input files (BATCH_MAX_FILES)", maxFiles)
+		}
+		target := filepath.Join(destDir, f.Name)
+		if err := os.MkdirAll(filepath.Dir(target), tempDirMode); err != nil {
+			return nil, err
+		}
+		remaining := int64(-1)
+		if maxBytes > 0 {
+			remaining = maxBytes - total
+		}
+		n, err := extractEntry(f, target, remaining)
+		total += n
+		if err != nil {
+			return nil, err
+		}
+		if maxBytes > 0 && total > maxBytes {
+			return nil, fmt.Errorf("archive unpacks to more than %d bytes (BATCH_MAX_BYTES)", maxBytes)
+		}
+		paths = append(paths, target)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("archive contains no .csv or .txt files")
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// extractEntry копирует не больше limit+1 байт записи (limit < 0 — без
+// ограничения): лишний байт означает превышение лимита, дальше читать не нужно.
+func extractEntry(f *zip.File, target string, limit int64) (int64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return 0, fmt.Errorf("open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	dst, err := createTempFile(target)
+	if err != nil {
+		return 0, err
+	}
+	var src io.Reader = rc
+	if limit >= 0 {
+		src = io.LimitReader(rc, limit+1)
+	}
+	n, err := io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return n, fmt.Errorf("extract %s: %w", f.Name, err)
+	}
+	return n, nil
+}
+
+// batchItem — результат одного файла из zip-архива.
+type batchItem struct {
+	File        string            `json:"file"`
+	OK          bool              `json:"ok"`
+	JobID       string            `json:"job_id,omitempty"`
+	Results     any               `json:"results,omitempty"`
+	Summary     any               `json:"summary,omitempty"`
+	Downloads   map[string]string `json:"downloads,omitempty"`
+	Convergence any               `json:"convergence,omitempty"`
+	Error       string            `json:"error,omitempty"`
+
+	err error
+}
+
+// runBatch запускает runner.py для каждого файла архива, как sweep — для
+// каждой точки: параллельно в пределах runSlots. ok == false, только если
+// не удался ни один файл.
+func runBatch(ctx context.Context, spec runSpec, root string, paths []string) ([]batchItem, bool) {
+	items := make([]batchItem, len(paths))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rel, _ := filepath.Rel(root, path)
+			item := batchItem{File: filepath.ToSlash(rel)}
+			out, err := runBatchFile(ctx, spec, path, item.File)
+			item.JobID, item.err = out.JobID, err
+			if err != nil {
+				log.Printf("Batch file %s failed: %v", item.File, err)
+				item.Error = err.Error()
+			} else {
+				item.OK = true
+				item.Results = out.Result["results"]
+				item.Summary = out.Result["summary"]
+				item.Downloads = out.Downloads
+				item.Convergence = out.Convergence
+			}
+			items[i] = item
+		}()
+	}
+	wg.Wait()
+
+	for _, it := range items {
+		if it.OK {
+			return items, true
+		}
+	}
+	return items, false
+}
+
+func runBatchFile(ctx context.Context, spec runSpec, path, name string) (runOutcome, error) {
+	inputPath, err := preprocessInput(ctx, spec.Params.config, path, filepath.Dir(path))
+	if err != nil {
+		return runOutcome{}, err
+	}
+	s := spec
+	s.InputPath = inputPath
+	if spec.Source != nil {
+		src := *spec.Source
+		src.Filename = spec.Source.Filename + "/" + name
+		src.Size = -1
+		if info, err := os.Stat(path); err == nil {
+			src.Size = info.Size()
+		}
+		s.Source = &src
+	}
+	return optimize(ctx, s)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// makeZip собирает zip-архив из пар имя -> содержимое.
+func makeZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		maxFiles int
+		maxBytes int64
+		want     []string
+		err      string
+	}{
+		{"inputs only", map[string]string{
+			"a.csv": "x\n", "dir/b.txt": "y\n", "readme.md": "z", "__MACOSX/a.csv": "", ".hidden.csv": "",
+		}, 10, 1 << 20, []string{"a.csv", "dir/b.txt"}, ""},
+		{"zip slip", map[string]string{"../evil.csv": "x\n"}, 10, 1 << 20, nil, "escapes the archive root"},
+		{"too many files", map[string]string{"a.csv": "", "b.csv": "", "c.csv": ""}, 2, 1 << 20, nil, "BATCH_MAX_FILES"},
+		{"too many bytes", map[string]string{"a.csv": strings.Repeat("x", 100)}, 10, 50, nil, "BATCH_MAX_BYTES"},
+		{"no inputs", map[string]string{"readme.md": "z"}, 10, 1 << 20, nil, "no .csv or .txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			zipPath := filepath.Join(dir, "in.zip")
+			if err := os.WriteFile(zipPath, makeZip(t, tt.files), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			root := filepath.Join(dir, "batch")
+			paths, err := extractBatch(zipPath, root, tt.maxFiles, tt.maxBytes)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range paths {
+				rel, _ := filepath.Rel(root, p)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("extracted %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchProcess(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	archive := makeZip(t, map[string]string{"one.csv": "a\n1\n", "sub/two.csv": "a\n2\n"})
+	got := decodeBody(t, postProcess(t, nil, "in.zip", string(archive), nil), http.StatusOK)
+	items := got["batch"].([]any)
+	if len(items) != 2 {
+		t.Fatalf("batch = %v", got["batch"])
+	}
+	for i, want := range []struct{ file, content string }{{"one.csv", "a\n1\n"}, {"sub/two.csv", "a\n2\n"}} {
+		item := items[i].(map[string]any)
+		if item["file"] != want.file || item["ok"] != true {
+			t.Errorf("item %d = %v", i, item)
+			continue
+		}
+		rec, ok := store.Peek(item["downloads"].(map[string]any)["classic_csv"].(string))
+		if !ok || string(rec.Data) != want.content {
+			t.Errorf("%s: runner input %q, want %q", want.file, rec.Data, want.content)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type bundleFile struct {
+	name string
+	rec  csvRecord
+}
+
+// bundleFiles собирает файлы задачи jobID для архива: каждый id один раз
+// (submission_csv и classic_csv указывают на одну запись), имена уникальны.
+// Файлы, сохранённые другой задачей (например, классическим проходом
+// conditional_quantum), получают префикс её id, чтобы одинаковые имена
+// разных запусков не путались; оставшиеся совпадения — суффикс _2, _3...
+func bundleFiles(jobID string, downloads map[string]string) []bundleFile {
+	keys := make([]string, 0, len(downloads))
+	for k := range downloads {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	seenID := map[string]bool{}
+	used := map[string]bool{}
+	var files []bundleFile
+	for _, key := range keys {
+		id := downloads[key]
+		if seenID[id] {
+			continue
+		}
+		seenID[id] = true
+		rec, ok := store.Peek(id)
+		if !ok {
+			continue
+		}
+		base := rec.Name
+		if rec.JobID != "" && rec.JobID != jobID {
+			base = rec.JobID + "_" + base
+		}
+		name := base
+		for n := 2; used[name]; n++ {
+			ext := filepath.Ext(base)
+			name = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(base, ext), n, ext)
+		}
+		used[name] = true
+		files = append(files, bundleFile{name: name, rec: rec})
+	}
+	return files
+}
+
+// downloadAll — GET /download-all?job=&format=zip|targz: все файлы
+// результата задачи одним архивом (по умолчанию zip).
+func downloadAll(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	job, ok := jobs.Get(q.Get("job"), tenantOf(r))
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "targz" {
+		http.Error(w, "format must be zip or targz", http.StatusBadRequest)
+		return
+	}
+	files := bundleFiles(job.ID, job.Downloads)
+	if len(files) == 0 {
+		http.Error(w, "result files are no longer stored", http.StatusGone)
+		return
+	}
+
+	release, ok := downloadSlots.Acquire(clientIP(r))
+	if !ok {
+		http.Error(w, "too many concurrent downloads from this client", http.StatusTooManyRequests)
+		return
+	}
+	defer release()
+
+	w = throttle(w, r.Context(), downloadRate)
+	var err error
+	switch format {
+	case "zip":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="results-`+job.ID+`.zip"`)
+		err = writeZip(w, files)
+	case "targz":
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="results-`+job.ID+`.tar.gz"`)
+		err = writeTarGz(w, files)
+	}
+	if err != nil {
+		log.Printf("Bundle for job %s interrupted: %v", job.ID, err)
+	}
+}
+
+func writeZip(w io.Writer, files []bundleFile) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		src, err := f.rec.reader()
+		if err != nil {
+			return err
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			src.Close()
+			return err
+		}
+		_, err = io.Copy(fw, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, files []bundleFile) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		src, err := f.rec.reader()
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: f.name, Mode: 0o644, Size: f.rec.Size, ModTime: time.Now()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			src.Close()
+			return err
+		}
+		_, err = io.Copy(tw, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDownloadAll(t *testing.T) {
+	defer func(s *resultStore, j *jobRegistry) { store, jobs = s, j }(store, jobs)
+	store = newResultStore(20)
+	jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+
+	put := func(id, name, jobID, data string) {
+		rec := newRecord(name, []byte(data), "")
+		rec.JobID = jobID
+		store.Store(id, rec)
+	}
+	put("c1", "classic.csv", "job1", "classic of job1")
+	put("q1", "quantum.csv", "job1", "quantum of job1")
+	put("r1", "report.csv", "job1", "first report")
+	put("r2", "report.csv", "job1", "second report")
+	put("x1", "report_2.csv", "job1", "named report_2 by the runner")
+	// Классический проход другой задачи с тем же именем файла.
+	put("c0", "classic.csv", "job0", "classic of job0")
+	jobs.Start(&jobRecord{ID: "job1"}, nil)
+	jobs.Finish("job1", map[string]string{
+		"submission_csv": "c1", "classic_csv": "c1", "classic_job0": "c0", "quantum_csv": "q1",
+		"report.csv": "r1", "report.csv_2": "r2", "report_2": "x1", "gone": "evicted",
+	})
+	want := map[string]string{
+		"classic.csv":      "classic of job1",
+		"job0_classic.csv": "classic of job0",
+		"quantum.csv":      "quantum of job1",
+		"report.csv":       "first report",
+		"report_2.csv":     "second report",
+		"report_2_2.csv":   "named report_2 by the runner",
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		downloadAll(rec, httptest.NewRequest(http.MethodGet, "/download-all?"+query, nil))
+		return rec
+	}
+
+	rec := get("job=job1")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("zip: %d %s", rec.Code, rec.Header())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, f := range zr.File {
+		if _, dup := got[f.Name]; dup {
+			t.Errorf("zip has two entries named %s", f.Name)
+		}
+		r, _ := f.Open()
+		b, _ := io.ReadAll(r)
+		r.Close()
+		got[f.Name] = string(b)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("zip entries = %v, want %v", got, want)
+	}
+
+	rec = get("job=job1&format=targz")
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("targz: %d %v", rec.Code, err)
+	}
+	tr := tar.NewReader(gz)
+	got = map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(tr)
+		got[hdr.Name] = string(b)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tar entries = %v, want %v", got, want)
+	}
+
+	if rec := get("job=job1&format=rar"); rec.Code != http.StatusBadRequest {
+		t.Errorf("format=rar: %d, want 400", rec.Code)
+	}
+	if rec := get("job=nope"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: %d, want 404", rec.Code)
+	}
+	jobs.Start(&jobRecord{ID: "job2"}, nil)
+	jobs.Finish("job2", map[string]string{"classic_csv": "evicted"})
+	if rec := get("job=job2"); rec.Code != http.StatusGone {
+		t.Errorf("evicted files: %d, want 410", rec.Code)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// allowedExtensions — расширения входных файлов, которые принимает /process.
+var allowedExtensions = []string{".csv", ".txt"}
+
+func allowedExtension(ext string) bool { return slices.Contains(allowedExtensions, ext) }
+
+// mireaAvailable — заданы ли учётные данные MIREA; без них runner.py
+// считает только классическую часть.
+func mireaAvailable(cfg settings) bool {
+	return cfg.get("MIREA_EMAIL", "") != "" && cfg.get("MIREA_PASSWORD", "") != ""
+}
+
+// capabilities — GET /capabilities: что умеет этот экземпляр сервера при
+// текущей конфигурации, чтобы фронт мог подстроить интерфейс.
+func capabilities(w http.ResponseWriter, r *http.Request) {
+	cfg := snapshotSettings()
+	backends := []string{"classic"}
+	if mireaAvailable(cfg) {
+		backends = append(backends, "mirea")
+	}
+	writeCacheableJSON(w, r, map[string]any{
+		"allowed_extensions": allowedExtensions,
+		// Размер загрузки сервер не ограничивает; null — без лимита.
+		"max_upload_bytes":     nil,
+		"source_url_max_bytes": cfg.getInt("SOURCE_URL_MAX_BYTES", 64<<20),
+		"presets":              []string{},
+		"backends":             backends,
+		"mirea_available":      mireaAvailable(cfg),
+		"optimizer_available":  fileExists(runnerScript(cfg)),
+		"primary_download_key": primaryDownloadKey(cfg),
+		"limits": map[string]any{
+			"p_layers_max":               cfg.getInt("P_LAYERS_MAX", 10),
+			"sweep_max_points":           cfg.getInt("SWEEP_MAX_POINTS", 5),
+			"batch_max_files":            cfg.getInt("BATCH_MAX_FILES", 20),
+			"batch_max_bytes":            cfg.getInt("BATCH_MAX_BYTES", 256<<20),
+			"max_routes_ceiling":         maxRoutesCeiling(cfg),
+			"min_timeout_seconds":        cfg.getDuration("MIN_TIMEOUT", time.Minute).Seconds(),
+			"processing_timeout_seconds": cfg.getDuration("PROCESSING_TIMEOUT", 30*time.Minute).Seconds(),
+			"retain_max_seconds":         cfg.getDuration("RETAIN_MAX", 7*24*time.Hour).Seconds(),
+		},
+		"features": map[string]bool{
+			"sse":                 false,
+			"websocket":           true,
+			"async":               true,
+			"sweep":               true,
+			"source_url":          true,
+			"validate":            true,
+			"validate_params":     true,
+			"estimate":            true,
+			"zip_batch":           true,
+			"conditional_quantum": true,
+			"compare":             true,
+			"dedupe":              true,
+		},
+		"response_encodings": []string{"br", "gzip"},
+		"response_formats":   []string{"application/json", mimeMsgpack},
+	})
+}
+
+// writeCacheableJSON отдаёт ответ с ETag — хешем содержимого; совпавший
+// If-None-Match даёт 304 без тела. Last-Modified не отдаётся: часть полей
+// (optimizer_available, mirea_available) меняется без перезагрузки
+// настроек, и If-Modified-Since вернул бы 304 на устаревший ответ.
+func writeCacheableJSON(w http.ResponseWriter, r *http.Request, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeJSON(w, http.StatusOK, v)
+		return
+	}
+	sum := sha256.Sum256(b)
+	etag := hex.EncodeToString(sum[:12])
+	if wantsMsgpack(w) {
+		etag += "-msgpack"
+	}
+	etag = `W/"` + etag + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Add("Vary", "Accept")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// etagMatches — слабое сравнение для If-None-Match: список через запятую
+// или "*", префикс W/ не учитывается.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func getCapabilities(t *testing.T, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/capabilities", nil)
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	rec := httptest.NewRecorder()
+	capabilities(rec, req)
+	return rec
+}
+
+func TestCapabilities(t *testing.T) {
+	t.Setenv("P_LAYERS_MAX", "6")
+	t.Setenv("SWEEP_MAX_POINTS", "3")
+	t.Setenv("MIN_TIMEOUT", "2m")
+	tests := []struct {
+		email, password string
+		backends        []any
+	}{
+		{"", "", []any{"classic"}},
+		{"team@example.com", "", []any{"classic"}},
+		{"team@example.com", "pw", []any{"classic", "mirea"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("MIREA_EMAIL", tt.email)
+		t.Setenv("MIREA_PASSWORD", tt.password)
+		got := decodeBody(t, getCapabilities(t, nil), http.StatusOK)
+		if !reflect.DeepEqual(got["backends"], tt.backends) || got["mirea_available"] != (len(tt.backends) == 2) {
+			t.Errorf("email %q password %q: backends %v, mirea_available %v", tt.email, tt.password, got["backends"], got["mirea_available"])
+		}
+		limits := got["limits"].(map[string]any)
+		if limits["p_layers_max"] != float64(6) || limits["sweep_max_points"] != float64(3) || limits["min_timeout_seconds"] != float64(120) {
+			t.Errorf("limits = %v", limits)
+		}
+		if !reflect.DeepEqual(got["allowed_extensions"], []any{".csv", ".txt"}) {
+			t.Errorf("allowed_extensions = %v", got["allowed_extensions"])
+		}
+	}
+}
+
+func TestCapabilitiesConditional(t *testing.T) {
+	t.Setenv("MIREA_EMAIL", "")
+	rec := getCapabilities(t, nil)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status %d, ETag %q", rec.Code, etag)
+	}
+	if lm := rec.Header().Get("Last-Modified"); lm != "" {
+		t.Errorf("Last-Modified = %q, want none", lm)
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"matching etag", http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+		{"etag in a list", http.Header{"If-None-Match": {`W/"other", ` + etag}}, http.StatusNotModified},
+		{"other etag", http.Header{"If-None-Match": {`W/"other"`}}, http.StatusOK},
+		// If-Modified-Since сам по себе 304 не даёт.
+		{"if-modified-since only", http.Header{"If-Modified-Since": {future}}, http.StatusOK},
+		{"msgpack variant", http.Header{"If-None-Match": {etag}, "Accept": {mimeMsgpack}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/capabilities", nil)
+			req.Header = tt.header
+			rec := httptest.NewRecorder()
+			var w http.ResponseWriter = rec
+			if prefersMsgpack(req.Header.Get("Accept")) {
+				w = &msgpackWriter{w}
+			}
+			capabilities(w, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	// MIREA стал доступен без перезагрузки настроек — старый ETag не подходит.
+	t.Setenv("MIREA_EMAIL", "team@example.com")
+	t.Setenv("MIREA_PASSWORD", "pw")
+	rec = getCapabilities(t, http.Header{"If-None-Match": {etag}, "If-Modified-Since": {future}})
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("after MIREA change: status %d, ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
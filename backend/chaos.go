@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// chaosFailures — классы сбоев, которые /process?fail= имитирует при
+// CHAOS=1, не запуская runner.py. Ответ тот же, что при настоящем сбое.
+var chaosFailures = []string{"timeout", "stalled", "queue_deadline", "python_error", "parse_error"}
+
+// chaosFailure читает ?fail=. Без CHAOS=1 параметр игнорируется, чтобы
+// в рабочей среде его нельзя было включить запросом.
+func chaosFailure(r *http.Request, cfg settings) (string, error) {
+	fail := r.URL.Query().Get("fail")
+	if fail == "" || cfg.get("CHAOS", "") != "1" {
+		return "", nil
+	}
+	if !slices.Contains(chaosFailures, fail) {
+		return "", errors.New("fail must be one of timeout, stalled, queue_deadline, python_error, parse_error")
+	}
+	return fail, nil
+}
+
+// injectFailure регистрирует задачу и проводит её через те же ветки
+// runFailure, что и настоящий сбой.
+func injectFailure(ctx context.Context, spec runSpec) (runOutcome, error) {
+	jobID := spec.JobID
+	if jobID == "" {
+		jobID = genID()
+	}
+	jobs.Start(&jobRecord{ID: jobID, Tenant: spec.Tenant, Source: spec.Source, Labels: spec.Params.Labels, requestID: spec.RequestID}, nil)
+	log.Printf("CHAOS: injecting %s failure into job %s", spec.Fail, jobID)
+	started := time.Now()
+	switch spec.Fail {
+	case "timeout":
+		expired, cancel := context.WithDeadline(ctx, started)
+		defer cancel()
+		return runOutcome{JobID: jobID}, runFailure(expired, jobID, spec, started, context.DeadlineExceeded, nil)
+	case "stalled":
+		return runOutcome{JobID: jobID}, runFailure(ctx, jobID, spec, started, errStalled, nil)
+	case "queue_deadline":
+		return runOutcome{JobID: jobID}, runFailure(ctx, jobID, spec, started, errQueueDeadline, nil)
+	case "parse_error":
+		jobs.Fail(jobID, "failed to parse python results")
+		return runOutcome{JobID: jobID}, &runError{Status: http.StatusInternalServerError, Message: "Failed to parse python results"}
+	}
+	return runOutcome{JobID: jobID}, runFailure(ctx, jobID, spec, started, errors.New("exit status 1"), []byte("chaos: injected python error"))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChaosFailureInjection(t *testing.T) {
+	defer func(j *jobRegistry) { jobs = j }(jobs)
+	fakeRunner(t, echoRunner)
+	post := func(fail string) *httptest.ResponseRecorder {
+		t.Helper()
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "in.csv")
+		io.WriteString(fw, "a,b\n1,2\n")
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/process?fail="+fail, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		process(rec, req)
+		return rec
+	}
+
+	// Без CHAOS=1 параметр ничего не меняет.
+	if rec := post("timeout"); rec.Code != http.StatusOK {
+		t.Fatalf("fail= without CHAOS: status %d %s", rec.Code, rec.Body)
+	}
+
+	t.Setenv("CHAOS", "1")
+	tests := []struct {
+		fail   string
+		status int
+		code   string // код ошибки в JSON; пусто — ответ текстом
+	}{
+		{"timeout", http.StatusGatewayTimeout, "timeout"},
+		{"queue_deadline", http.StatusGatewayTimeout, "queue_deadline"},
+		{"stalled", http.StatusGatewayTimeout, ""},
+		{"python_error", http.StatusInternalServerError, ""},
+		{"parse_error", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fail, func(t *testing.T) {
+			jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+			rec := post(tt.fail)
+			if tt.code != "" {
+				body := decodeBody(t, rec, tt.status)
+				if code := body["error"].(map[string]any)["code"]; code != tt.code {
+					t.Errorf("error code %v, want %s", code, tt.code)
+				}
+			} else if rec.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			// Задача помечена упавшей, runner.py не запускался.
+			list := jobs.List("")
+			if len(list) != 1 || list[0].State != jobFailed || list[0].Command != nil {
+				t.Errorf("jobs = %+v, want one failed job without a command", list)
+			}
+		})
+	}
+
+	if rec := post("oom"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown failure class: status %d, want 400", rec.Code)
+	}
+}
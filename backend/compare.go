@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// resultMetrics сводит числовые показатели запуска в плоскую карту: все
+// числовые поля summary плюс суммы final_cost и time_ms по графам.
+func resultMetrics(result map[string]any) map[string]float64 {
+	m := map[string]float64{}
+	summary, _ := result["summary"].(map[string]any)
+	for k, v := range summary {
+		if f, ok := toFloat(v); ok {
+			m[k] = f
+		}
+	}
+	results, _ := result["results"].([]any)
+	for _, r := range results {
+		item, _ := r.(map[string]any)
+		stats, _ := item["stats"].(map[string]any)
+		if f, ok := toFloat(stats["final_cost"]); ok {
+			m["final_cost_total"] += f
+		}
+		if f, ok := toFloat(stats["time_ms"]); ok {
+			m["time_ms_total"] += f
+		}
+	}
+	return m
+}
+
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// quantumComparison — блок comparison: окупается ли квантовый проход по
+// сравнению с классическим при пороге MIN_IMPROVEMENT_PCT.
+type quantumComparison struct {
+	ClassicCost float64 `json:"classic_cost"`
+	QuantumCost float64 `json:"quantum_cost"`
+	// ImprovementPct — снижение стоимости относительно классической;
+	// nil, если классическая стоимость нулевая.
+	ImprovementPct    *float64 `json:"improvement_pct"`
+	MinImprovementPct float64  `json:"min_improvement_pct"`
+	QuantumWorthwhile bool     `json:"quantum_worthwhile"`
+	// QuantumOmitted — quantum.csv убран из downloads (OMIT_UNWORTHWHILE_QUANTUM).
+	QuantumOmitted bool `json:"quantum_omitted,omitempty"`
+}
+
+// compareQuantum сравнивает final_cost_total с quantum_cost_total из
+// summary. Текущий runner.py квантовую стоимость не считает (MIREA отдаёт
+// только гистограммы измерений) — тогда сравнивать не с чем и возвращается nil.
+func compareQuantum(metrics map[string]float64, minPct float64) *quantumComparison {
+	classic, ok := metrics["final_cost_total"]
+	if !ok {
+		return nil
+	}
+	quantum, ok := metrics["quantum_cost_total"]
+	if !ok {
+		return nil
+	}
+	c := &quantumComparison{ClassicCost: classic, QuantumCost: quantum, MinImprovementPct: minPct}
+	if classic != 0 {
+		p := (classic - quantum) / classic * 100
+		c.ImprovementPct = &p
+		c.QuantumWorthwhile = p >= minPct
+	}
+	return c
+}
+
+type metricDelta struct {
+	A     float64 `json:"a"`
+	B     float64 `json:"b"`
+	Delta float64 `json:"delta"`
+	// Percent — изменение относительно a; nil, если a == 0.
+	Percent *float64 `json:"percent,omitempty"`
+}
+
+// compareMetrics считает b - a по общим метрикам; метрики, которые есть
+// только у одной из задач (другая версия runner.py), перечисляются отдельно.
+func compareMetrics(a, b map[string]float64) (deltas map[string]metricDelta, onlyA, onlyB []string) {
+	deltas = map[string]metricDelta{}
+	onlyA, onlyB = []string{}, []string{}
+	for k, av := range a {
+		bv, ok := b[k]
+		if !ok {
+			onlyA = append(onlyA, k)
+			continue
+		}
+		d := metricDelta{A: av, B: bv, Delta: bv - av}
+		if av != 0 {
+			p := (bv - av) / av * 100
+			d.Percent = &p
+		}
+		deltas[k] = d
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			onlyB = append(onlyB, k)
+		}
+	}
+	sort.Strings(onlyA)
+	sort.Strings(onlyB)
+	return deltas, onlyA, onlyB
+}
+
+// rowDiff — построчное сравнение двух CSV без учёта порядка строк.
+type rowDiff struct {
+	RowsA      int      `json:"rows_a"`
+	RowsB      int      `json:"rows_b"`
+	OnlyInA    int      `json:"only_in_a"`
+	OnlyInB    int      `json:"only_in_b"`
+	SameHeader bool     `json:"same_header"`
+	SampleA    []string `json:"sample_only_in_a"`
+	SampleB    []string `json:"sample_only_in_b"`
+}
+
+const rowDiffSamples = 20
+
+func diffRows(a, b io.Reader) (rowDiff, error) {
+	headA, rowsA, err := readRowCounts(a)
+	if err != nil {
+		return rowDiff{}, err
+	}
+	headB, rowsB, err := readRowCounts(b)
+	if err != nil {
+		return rowDiff{}, err
+	}
+	d := rowDiff{SameHeader: headA == headB, SampleA: []string{}, SampleB: []string{}}
+	only := func(x, y map[string]int, n *int, sample *[]string) {
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, row := range keys {
+			if extra := x[row] - y[row]; extra > 0 {
+				*n += extra
+				if len(*sample) < rowDiffSamples {
+					*sample = append(*sample, row)
+				}
+			}
+		}
+	}
+	for _, c := range rowsA {
+		d.RowsA += c
+	}
+	for _, c := range rowsB {
+		d.RowsB += c
+	}
+	only(rowsA, rowsB, &d.OnlyInA, &d.SampleA)
+	only(rowsB, rowsA, &d.OnlyInB, &d.SampleB)
+	return d, nil
+}
+
+func readRowCounts(r io.Reader) (string, map[string]int, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	var header string
+	rows := map[string]int{}
+	for first := true; sc.Scan(); first = false {
+		if first {
+			header = sc.Text()
+			continue
+		}
+		rows[sc.Text()]++
+	}
+	return header, rows, sc.Err()
+}
+
+// compareJobs — GET /compare?a=&b=[&rows=1]: разница метрик двух задач и,
+// по запросу, построчный diff их основных CSV (оба должны быть ещё в store).
+func compareJobs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tenant := tenantOf(r)
+	a, okA := jobs.Get(q.Get("a"), tenant)
+	b, okB := jobs.Get(q.Get("b"), tenant)
+	if !okA || !okB {
+		http.Error(w, "both jobs must exist: pass ?a=<job>&b=<job>", http.StatusNotFound)
+		return
+	}
+	if a.State != jobDone || b.State != jobDone {
+		http.Error(w, "both jobs must have finished successfully", http.StatusConflict)
+		return
+	}
+
+	deltas, onlyA, onlyB := compareMetrics(a.Metrics, b.Metrics)
+	resp := map[string]any{
+		"a":         a.ID,
+		"b":         b.ID,
+		"metrics":   deltas,
+		"only_in_a": onlyA,
+		"only_in_b": onlyB,
+	}
+
+	if q.Get("rows") == "1" {
+		key := primaryDownloadKey(snapshotSettings())
+		recA, okA := store.Peek(a.Downloads[key])
+		recB, okB := store.Peek(b.Downloads[key])
+		if !okA || !okB {
+			http.Error(w, "submission files of both jobs must still be retained for a row diff", http.StatusGone)
+			return
+		}
+		srcA, errA := recA.reader()
+		if errA == nil {
+			defer srcA.Close()
+		}
+		srcB, errB := recB.reader()
+		if errB == nil {
+			defer srcB.Close()
+		}
+		if errA != nil || errB != nil {
+			http.Error(w, "failed to read stored submission files", http.StatusInternalServerError)
+			return
+		}
+		diff, err := diffRows(srcA, srcB)
+		if err != nil {
+			http.Error(w, "row diff failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp["rows"] = diff
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffRows(t *testing.T) {
+	d, err := diffRows(strings.NewReader("a,b\n1,2\n1,2\n3,4\n"), strings.NewReader("a,b\n1,2\n5,6\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Повторяющиеся строки считаются поштучно.
+	want := rowDiff{RowsA: 3, RowsB: 2, OnlyInA: 2, OnlyInB: 1, SameHeader: true,
+		SampleA: []string{"1,2", "3,4"}, SampleB: []string{"5,6"}}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("diffRows = %+v, want %+v", d, want)
+	}
+}
+
+func TestCompareMetrics(t *testing.T) {
+	deltas, onlyA, onlyB := compareMetrics(
+		map[string]float64{"cost": 10, "zero": 0, "old": 1},
+		map[string]float64{"cost": 8, "zero": 3, "new": 2},
+	)
+	if d := deltas["cost"]; d.Delta != -2 || d.Percent == nil || *d.Percent != -20 {
+		t.Errorf("cost delta = %+v", d)
+	}
+	if d := deltas["zero"]; d.Delta != 3 || d.Percent != nil {
+		t.Errorf("zero delta = %+v, want no percent", d)
+	}
+	if !reflect.DeepEqual(onlyA, []string{"old"}) || !reflect.DeepEqual(onlyB, []string{"new"}) {
+		t.Errorf("onlyA %v, onlyB %v", onlyA, onlyB)
+	}
+}
+
+func TestCompareJobs(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	t.Setenv("PYTHON_ENV_PASSTHROUGH", "FAKE_COST")
+	run := func(cost, csv string) string {
+		t.Setenv("FAKE_COST", cost)
+		return decodeBody(t, postProcess(t, nil, "in.csv", csv, nil), http.StatusOK)["job_id"].(string)
+	}
+	a := run("10", "a,b\n1,2\n3,4\n")
+	b := run("8", "a,b\n1,2\n5,6\n7,8\n")
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		compareJobs(rec, httptest.NewRequest(http.MethodGet, "/compare?"+query, nil))
+		return rec
+	}
+	got := decodeBody(t, get("a="+a+"&b="+b+"&rows=1"), http.StatusOK)
+	cost := got["metrics"].(map[string]any)["final_cost_total"].(map[string]any)
+	if cost["a"] != float64(10) || cost["b"] != float64(8) || cost["delta"] != float64(-2) || cost["percent"] != float64(-20) {
+		t.Errorf("final_cost_total = %v", cost)
+	}
+	rows := got["rows"].(map[string]any)
+	if rows["only_in_a"] != float64(1) || rows["only_in_b"] != float64(2) || rows["same_header"] != true {
+		t.Errorf("rows = %v", rows)
+	}
+
+	if rec := get("a=" + a + "&b=" + genID()); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: %d, want 404", rec.Code)
+	}
+	running := genID()
+	jobs.Start(&jobRecord{ID: running}, nil)
+	if rec := get("a=" + a + "&b=" + running); rec.Code != http.StatusConflict {
+		t.Errorf("unfinished job: %d, want 409", rec.Code)
+	}
+}
+
+func TestMinImprovementGate(t *testing.T) {
+	fakeRunner(t, `import base64, json, os
+b64 = lambda s: base64.b64encode(s.encode()).decode()
+summary = {"final_cost_total": 100.0}
+if os.environ.get("FAKE_QCOST"):
+    summary["quantum_cost_total"] = float(os.environ["FAKE_QCOST"])
+print(json.dumps({"ok": True, "results": [], "summary": summary, "csv_files": [
+    {"name": "classic.csv", "base64": b64("c\n1\n")},
+    {"name": "quantum.csv", "base64": b64("q\n2\n")},
+]}))
+`)
+	t.Setenv("PYTHON_ENV_PASSTHROUGH", "FAKE_QCOST")
+	tests := []struct {
+		name       string
+		threshold  string
+		omit       string
+		qcost      string
+		compared   bool
+		worthwhile bool
+		quantumCSV bool
+	}{
+		{"above threshold", "10", "1", "80", true, true, true},
+		{"below threshold", "10", "", "95", true, false, true},
+		{"below threshold omitted", "10", "1", "95", true, false, false},
+		{"no quantum cost from runner", "10", "1", "", false, false, true},
+		{"threshold unset", "", "1", "95", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MIN_IMPROVEMENT_PCT", tt.threshold)
+			t.Setenv("OMIT_UNWORTHWHILE_QUANTUM", tt.omit)
+			t.Setenv("FAKE_QCOST", tt.qcost)
+			got := decodeBody(t, postProcess(t, nil, "in.csv", "a\n1\n", nil), http.StatusOK)
+
+			params := got["parameters"].(map[string]any)
+			if _, ok := params["min_improvement_pct"]; ok != (tt.threshold != "") {
+				t.Errorf("parameters.min_improvement_pct = %v", params["min_improvement_pct"])
+			}
+			cmp, ok := got["comparison"].(map[string]any)
+			if ok != tt.compared {
+				t.Fatalf("comparison = %v", got["comparison"])
+			}
+			if ok && cmp["quantum_worthwhile"] != tt.worthwhile {
+				t.Errorf("quantum_worthwhile = %v, want %v (%v)", cmp["quantum_worthwhile"], tt.worthwhile, cmp)
+			}
+			id, ok := got["downloads"].(map[string]any)["quantum_csv"].(string)
+			if ok != tt.quantumCSV {
+				t.Errorf("quantum_csv in downloads = %v, want %v", ok, tt.quantumCSV)
+			}
+			if ok {
+				if _, stored := store.Peek(id); !stored {
+					t.Errorf("quantum_csv %s not stored", id)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareQuantum(t *testing.T) {
+	if c := compareQuantum(map[string]float64{"final_cost_total": 10}, 5); c != nil {
+		t.Errorf("comparison without quantum cost: %+v", c)
+	}
+	c := compareQuantum(map[string]float64{"final_cost_total": 200, "quantum_cost_total": 150}, 25)
+	if c == nil || c.ImprovementPct == nil || *c.ImprovementPct != 25 || !c.QuantumWorthwhile {
+		t.Errorf("exactly at threshold: %+v", c)
+	}
+	// Нулевая классическая стоимость — улучшать некуда.
+	c = compareQuantum(map[string]float64{"final_cost_total": 0, "quantum_cost_total": 0}, 0)
+	if c == nil || c.ImprovementPct != nil || c.QuantumWorthwhile {
+		t.Errorf("zero classic cost: %+v", c)
+	}
+}
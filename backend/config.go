@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Типы значений настроек — по ним проверяется файл конфигурации.
+type configKind int
+
+const (
+	kindString configKind = iota
+	kindInt
+	kindFloat
+	kindBool
+	kindDuration
+)
+
+// startupOnly — флаг в configKeys: настройка читается один раз при старте
+// (пул запусков runner.py и параметры его процессов, файлы, каталоги,
+// логирование), и после SIGHUP её новое значение вступит в силу только
+// после перезапуска. Лимиты хранилища и ограничителей скачиваний и опросов
+// применяются сразу (applyLimits).
+const startupOnly configKind = 1 << 8
+
+// configKeys — все настройки сервера. Их можно задать переменной окружения
+// или в CONFIG_FILE; окружение перекрывает файл, поля запроса — и то и другое.
+var configKeys = map[string]configKind{
+	"PORT":                        kindString | startupOnly,
+	"WEB_DIR":                     kindString | startupOnly,
+	"LOG_LEVEL":                   kindString | startupOnly,
+	"RUNNER_PATH":                 kindString,
+	"PREPROCESS_CMD":              kindString,
+	"ADMIN_TOKEN":                 kindString,
+	"PYTHON_ENV_PASSTHROUGH":      kindString,
+	"SUBMISSION_NAME_TEMPLATE":    kindString,
+	"SOURCE_URL_SCHEMES":          kindString,
+	"SOURCE_URL_ALLOWED_HOSTS":    kindString,
+	"SOURCE_URL_TIMEOUT":          kindDuration,
+	"SOURCE_URL_MAX_BYTES":        kindInt,
+	"MIREA_EMAIL":                 kindString,
+	"MIREA_PASSWORD":              kindString,
+	"MIREA_SHOTS":                 kindInt,
+	"MIREA_SAMPLES":               kindInt,
+	"MIREA_MAX_CALLS":             kindInt,
+	"SOLVER_ITERATIONS":           kindInt,
+	"DEFAULT_P_LAYERS":            kindInt,
+	"DEFAULT_REROUTE_FRACTION":    kindFloat,
+	"P_LAYERS_MAX":                kindInt,
+	"MAX_ROUTES_CEILING":          kindInt,
+	"SWEEP_MAX_POINTS":            kindInt,
+	"AUTO_SEED":                   kindBool,
+	"PROCESSING_TIMEOUT":          kindDuration,
+	"MIN_TIMEOUT":                 kindDuration,
+	"STALL_TIMEOUT":               kindDuration | startupOnly,
+	"SUBPROCESS_NICE":             kindInt | startupOnly,
+	"MAX_CONCURRENT_RUNS":         kindInt | startupOnly,
+	"MAX_STORED_RESULTS":          kindInt,
+	"COMPRESS_STORE":              kindBool | startupOnly,
+	"STORE_DIR":                   kindString | startupOnly,
+	"FILENAME_POLICY":             kindString | startupOnly,
+	"ESTIMATE_NS_PER_OP":          kindFloat,
+	"LOG_FILE":                    kindString | startupOnly,
+	"BATCH_MAX_FILES":             kindInt,
+	"PRIMARY_DOWNLOAD_KEY":        kindString,
+	"SEARCH_MAX_RESULTS":          kindInt,
+	"TEMP_DIR_MODE":               kindString | startupOnly,
+	"TEMP_FILE_MODE":              kindString | startupOnly,
+	"POSTPROCESS_CMD":             kindString,
+	"STRICT_PARAMS":               kindBool,
+	"ASYNC_BY_DEFAULT":            kindBool,
+	"MAX_JOB_HISTORY":             kindInt,
+	"JOB_HISTORY_TTL":             kindDuration,
+	"STATSD_ADDR":                 kindString | startupOnly,
+	"STATSD_PREFIX":               kindString | startupOnly,
+	"MAX_LABELS":                  kindInt,
+	"LABEL_VALUE_MAX_BYTES":       kindInt,
+	"CPU_AFFINITY":                kindString | startupOnly,
+	"CHAOS":                       kindBool,
+	"BASE64_SPOOL_MIN_BYTES":      kindInt,
+	"FAILURE_WEBHOOK":             kindString,
+	"FAILURE_WEBHOOK_DEBOUNCE":    kindDuration,
+	"FAILURE_WEBHOOK_RETRIES":     kindInt,
+	"KILL_GRACE_PERIOD":           kindDuration | startupOnly,
+	"ENV_OVERRIDE_ALLOWLIST":      kindString,
+	"TOTAL_DEADLINE":              kindDuration,
+	"DOWNLOAD_SIGNING_KEY":        kindString,
+	"SIGNED_URL_TTL":              kindDuration,
+	"BATCH_MAX_BYTES":             kindInt,
+	"LOG_MAX_SIZE_MB":             kindInt | startupOnly,
+	"LOG_MAX_BACKUPS":             kindInt | startupOnly,
+	"ESTIMATE_MIREA_CALL_SECONDS": kindFloat,
+	"ESTIMATE_STARTUP_SECONDS":    kindFloat,
+	"RESULT_TTL":                  kindDuration,
+	"RETAIN_MAX":                  kindDuration,
+	"RESULT_FILES_ON_DISK":        kindBool,
+	"RESULT_WORKERS":              kindInt,
+	"MAX_RESULT_FILES":            kindInt,
+	"RESULT_FORMAT_CONFLICT":      kindString,
+	"MIN_IMPROVEMENT_PCT":         kindFloat,
+	"OMIT_UNWORTHWHILE_QUANTUM":   kindBool,
+	"CONDITIONAL_PASS_SLOTS":      kindInt,
+	"STRICT_SCHEMA":               kindBool,
+	"JOB_OUTPUT_MAX_BYTES":        kindInt,
+	"PREVIEW_ROWS":                kindInt,
+	"DEDUPE_MAX_ROWS":             kindInt,
+	"INCLUDE_CLIENT_IP":           kindBool,
+	"DOWNLOAD_RATE_BYTES_PER_SEC": kindInt | startupOnly,
+	"DOWNLOAD_BOM":                kindBool,
+	"DOWNLOAD_MISS_LIMIT":         kindInt,
+	"DOWNLOAD_MAX_PER_IP":         kindInt,
+	"STATUS_POLL_RATE":            kindFloat,
+	"STATUS_POLL_BURST":           kindInt,
+	"DOWNLOAD_MISS_WINDOW":        kindDuration,
+	"DOWNLOAD_BLOCK_DURATION":     kindDuration,
+	"DRAIN_RETRY_AFTER":           kindDuration,
+	"WS_POLL_INTERVAL":            kindDuration,
+	"WS_PING_INTERVAL":            kindDuration,
+}
+
+// fileConfig — значения из CONFIG_FILE, ключи в виде имён переменных
+// окружения. По SIGHUP карта подменяется целиком; чтобы запрос не смешал
+// старые и новые значения разных ключей, он читает настройки из снимка
+// (snapshotSettings).
+var fileConfig atomic.Pointer[map[string]string]
+
+// lookupConfig возвращает текущее значение настройки: окружение, затем файл.
+func lookupConfig(k string) string { return settings{}.lookup(k) }
+
+// settings — снимок CONFIG_FILE, из которого запрос и его задача читают
+// настройки от приёма до конца работы. Нулевое значение — без снимка,
+// каждое чтение берёт текущий файл (так работают getenv и его варианты).
+type settings struct {
+	file   map[string]string
+	pinned bool
+}
+
+// snapshotSettings фиксирует CONFIG_FILE на текущий момент. Окружение
+// процесса не меняется и по-прежнему перекрывает файл.
+func snapshotSettings() settings {
+	s := settings{pinned: true}
+	if cfg := fileConfig.Load(); cfg != nil {
+		s.file = *cfg
+	}
+	return s
+}
+
+func (s settings) lookup(k string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	if !s.pinned {
+		s = snapshotSettings()
+	}
+	return s.file[k]
+}
+
+func (s settings) get(k, def string) string {
+	if v := s.lookup(k); v != "" {
+		return v
+	}
+	return def
+}
+
+func (s settings) getDuration(k string, def time.Duration) time.Duration {
+	if v := s.lookup(k); v != "" {
+		if d, err := parseDuration(v); err == nil {
+			return d
+		}
+		log.Printf("Invalid %s=%q, using default %s", k, v, def)
+	}
+	return def
+}
+
+func (s settings) getInt(k string, def int) int {
+	if v := s.lookup(k); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		log.Printf("Invalid %s=%q, using default %d", k, v, def)
+	}
+	return def
+}
+
+func (s settings) getFloat(k string, def float64) float64 {
+	if v := s.lookup(k); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+		log.Printf("Invalid %s=%q, using default %g", k, v, def)
+	}
+	return def
+}
+
+// loadConfigFile читает YAML-файл настроек. Ключи — имена переменных
+// окружения в любом регистре; вложенные секции склеиваются через "_",
+// так что
+//
+//	mirea:
+//	  email: team@example.com
+//
+// задаёт MIREA_EMAIL. Списки превращаются в значения через запятую.
+// Неизвестные ключи и значения не того типа — ошибка.
+func loadConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	out := map[string]string{}
+	var problems []string
+	flattenConfig("", raw, out, &problems)
+	for k, v := range out {
+		kind, ok := configKeys[k]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown setting %s", k))
+			continue
+		}
+		if err := checkConfigValue(kind, v); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", k, err))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("%s: %s", path, strings.Join(problems, "; "))
+	}
+	return out, nil
+}
+
+func flattenConfig(prefix string, m map[string]any, out map[string]string, problems *[]string) {
+	for k, v := range m {
+		key := strings.ToUpper(k)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			flattenConfig(key, v, out, problems)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+			// пустое значение — как если бы ключа не было
+		case bool:
+			// ключи-флаги в коде сравниваются с "1"
+			out[key] = map[bool]string{true: "1", false: "0"}[v]
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+func checkConfigValue(kind configKind, v string) error {
+	var err error
+	switch kind &^ startupOnly {
+	case kindInt:
+		_, err = strconv.Atoi(v)
+	case kindFloat:
+		_, err = strconv.ParseFloat(v, 64)
+	case kindBool:
+		if v != "0" && v != "1" {
+			err = fmt.Errorf("must be a boolean, got %q", v)
+		}
+	case kindDuration:
+		_, err = parseDuration(v)
+	}
+	return err
+}
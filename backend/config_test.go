@@ -0,0 +1,207 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// swapFileConfig подменяет CONFIG_FILE на время теста, как это делает SIGHUP.
+func swapFileConfig(t *testing.T, cfg map[string]string) {
+	t.Helper()
+	old := fileConfig.Swap(&cfg)
+	t.Cleanup(func() { fileConfig.Store(old) })
+}
+
+func TestSettingsSnapshotSurvivesReload(t *testing.T) {
+	keys := []string{"SOLVER_ITERATIONS", "MIREA_SHOTS", "MIREA_SAMPLES", "MIREA_MAX_CALLS", "RESULT_WORKERS"}
+	for _, k := range keys {
+		t.Setenv(k, "")
+	}
+	oldCfg, newCfg := map[string]string{}, map[string]string{}
+	for i, k := range keys {
+		oldCfg[k] = strconv.Itoa(10 + i)
+		newCfg[k] = strconv.Itoa(100 + i)
+	}
+	swapFileConfig(t, oldCfg)
+
+	params, err := parseParams(&http.Request{Form: url.Values{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileConfig.Store(&newCfg) // SIGHUP между приёмом запроса и запуском
+
+	e := newEffectiveParameters(params)
+	got := []int{e.SolverIterations, e.MireaShots, e.MireaSamples, e.MireaMaxCalls, params.config.getInt("RESULT_WORKERS", 0)}
+	for i, k := range keys {
+		if got[i] != 10+i {
+			t.Errorf("%s = %d from the job snapshot, want %d (value before reload)", k, got[i], 10+i)
+		}
+		if live := getenvInt(k, 0); live != 100+i {
+			t.Errorf("live %s = %d, want %d", k, live, 100+i)
+		}
+	}
+
+	t.Setenv("MIREA_SHOTS", "7")
+	if n := params.config.getInt("MIREA_SHOTS", 0); n != 7 {
+		t.Errorf("environment must override the snapshot, got %d", n)
+	}
+}
+
+// TestStartupOnlyKeysFlagged ловит расхождение флага startupOnly с кодом:
+// всё, что main и setupLogging читают при старте, должно быть помечено.
+func TestStartupOnlyKeysFlagged(t *testing.T) {
+	// Читаются при старте только для предупреждения в лог, в работе — на
+	// каждый запрос.
+	perRequest := map[string]bool{"CHAOS": true, "RUNNER_PATH": true}
+	startup := map[string]bool{}
+	for _, k := range startupOnlyKeys() {
+		startup[k] = true
+	}
+	fset := token.NewFileSet()
+	for file, fn := range map[string]string{"main.go": "main", "logging.go": "setupLogging"} {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range f.Decls {
+			d, ok := decl.(*ast.FuncDecl)
+			if !ok || d.Name.Name != fn {
+				continue
+			}
+			ast.Inspect(d.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || len(call.Args) == 0 {
+					return true
+				}
+				name, ok := call.Fun.(*ast.Ident)
+				lit, isLit := call.Args[0].(*ast.BasicLit)
+				if !ok || !isLit || lit.Kind != token.STRING {
+					return true
+				}
+				switch name.Name {
+				case "getenv", "getenvInt", "getenvFloat", "getenvDuration", "parseFileMode":
+				default:
+					return true
+				}
+				key, _ := strconv.Unquote(lit.Value)
+				if _, known := configKeys[key]; !known {
+					t.Errorf("%s: %s reads %s, which is not in configKeys", fset.Position(call.Pos()), fn, key)
+				} else if !startup[key] && !perRequest[key] {
+					t.Errorf("%s: %s reads %s at startup; mark it startupOnly in configKeys", fset.Position(call.Pos()), fn, key)
+				}
+				return true
+			})
+		}
+	}
+	if len(startup) == 0 {
+		t.Fatal("no startupOnly keys found")
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name, yaml string
+		want       map[string]string
+		wantErr    string
+	}{
+		{
+			"nested and lists",
+			"mirea:\n  email: team@example.com\n  shots: 256\nsolver_iterations: 40\nsource_url:\n  allowed_hosts: [a.example.com, b.example.com]\nauto_seed: true\n",
+			map[string]string{
+				"MIREA_EMAIL": "team@example.com", "MIREA_SHOTS": "256", "SOLVER_ITERATIONS": "40",
+				"SOURCE_URL_ALLOWED_HOSTS": "a.example.com,b.example.com", "AUTO_SEED": "1",
+			},
+			"",
+		},
+		{"unknown key", "mirea_emial: x\n", nil, "unknown setting MIREA_EMIAL"},
+		{"wrong type", "solver_iterations: many\nprocessing_timeout: later\n", nil, "PROCESSING_TIMEOUT: "},
+		{"bad yaml", "a: [\n", nil, "config.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			os.WriteFile(path, []byte(tt.yaml), 0o600)
+			got, err := loadConfigFile(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadConfigFile = %v, %v; want error %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadConfigFile = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Файл задаёт умолчания, окружение их перекрывает.
+	t.Setenv("SOLVER_ITERATIONS", "")
+	swapFileConfig(t, map[string]string{"SOLVER_ITERATIONS": "40"})
+	if n := getenvInt("SOLVER_ITERATIONS", 0); n != 40 {
+		t.Errorf("SOLVER_ITERATIONS from file = %d, want 40", n)
+	}
+	t.Setenv("SOLVER_ITERATIONS", "7")
+	if n := getenvInt("SOLVER_ITERATIONS", 0); n != 7 {
+		t.Errorf("SOLVER_ITERATIONS with env = %d, want 7", n)
+	}
+}
+
+func TestReloadConfigLimits(t *testing.T) {
+	defer func(s *resultStore, d *ipSlots, p *pollLimiter) {
+		store, downloadSlots, statusPolls = s, d, p
+	}(store, downloadSlots, statusPolls)
+	store, downloadSlots, statusPolls = newResultStore(10), newIPSlots(8), newPollLimiter(0, 1)
+	for _, k := range []string{"MAX_STORED_RESULTS", "DOWNLOAD_MAX_PER_IP", "STATUS_POLL_RATE", "STATUS_POLL_BURST", "MAX_CONCURRENT_RUNS"} {
+		t.Setenv(k, "")
+	}
+	swapFileConfig(t, map[string]string{})
+	for range 3 {
+		store.Store(genID(), newRecord("classic.csv", []byte("a\n"), ""))
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("max_stored_results: 1\ndownload_max_per_ip: 1\nstatus_poll_rate: 1\nstatus_poll_burst: 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	logs := captureLogs(t, slog.LevelInfo)
+	if err := reloadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := store.Len(); n != 1 {
+		t.Errorf("store holds %d results after MAX_STORED_RESULTS=1", n)
+	}
+	if _, ok := downloadSlots.Acquire("192.0.2.1"); !ok {
+		t.Fatal("first download slot refused")
+	}
+	if _, ok := downloadSlots.Acquire("192.0.2.1"); ok {
+		t.Error("DOWNLOAD_MAX_PER_IP=1 not applied")
+	}
+	if !statusPolls.Allow("192.0.2.1", "j") || statusPolls.Allow("192.0.2.1", "j") {
+		t.Error("STATUS_POLL_RATE/BURST not applied")
+	}
+
+	// Настройки, которые требуют перезапуска, по-прежнему только отмечаются в логе.
+	if err := os.WriteFile(path, []byte("max_concurrent_runs: 7\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "MAX_CONCURRENT_RUNS changed; it takes effect after a restart") {
+		t.Errorf("no restart notice in logs:\n%s", logs)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// convergencePoint — значение целевой функции на одной итерации солвера.
+// Graph — порядковый номер графа во входном файле (счётчик итераций
+// runner.py сбрасывается для каждого графа).
+type convergencePoint struct {
+	Graph     int     `json:"graph"`
+	Iteration int     `json:"iteration"`
+	Objective float64 `json:"objective"`
+}
+
+// Строка прогресса traffic_optimizer.py: "  Iter 3/15: Total Cost = 1234.56".
+var iterationLineRe = regexp.MustCompile(`Iter\s+(\d+)(?:/(\d+))?:.*?=\s*([-+]?[0-9.]+(?:[eE][-+]?\d+)?)`)
+
+// convergenceTracker разбирает stderr runner.py и складывает пары
+// (итерация, стоимость) в запись задачи, чтобы /status видел историю
+// ещё до окончания запуска. По темпу итераций он же пересчитывает ETA:
+// считается, что все итерации всех графов стоят одинаково.
+type convergenceTracker struct {
+	jobID    string
+	graph    int
+	lastIter int
+
+	// started — запуск runner.py; graphs — графов во входном файле
+	// (0 — неизвестно); iterations — итераций на граф, если строка
+	// прогресса не содержит "/N".
+	started    time.Time
+	graphs     int
+	iterations int
+}
+
+func (t *convergenceTracker) Line(line string) { t.observe(line, time.Now()) }
+
+func (t *convergenceTracker) observe(line string, now time.Time) {
+	m := iterationLineRe.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+	iter, err := strconv.Atoi(m[1])
+	if err != nil {
+		return
+	}
+	obj, err := strconv.ParseFloat(m[3], 64)
+	if err != nil || math.IsInf(obj, 0) || math.IsNaN(obj) {
+		return
+	}
+	if iter <= t.lastIter {
+		t.graph++
+	}
+	t.lastIter = iter
+	if n, err := strconv.Atoi(m[2]); err == nil && n > 0 {
+		t.iterations = n
+	}
+	p := convergencePoint{Graph: t.graph, Iteration: iter, Objective: obj}
+	eta, ok := t.eta(now)
+	jobs.Update(t.jobID, func(job *jobRecord) {
+		job.Convergence = append(job.Convergence, p)
+		if ok {
+			secs := math.Round(eta.Seconds()*10) / 10
+			done := now.Add(eta)
+			job.ETASeconds, job.EstimatedCompletion = &secs, &done
+		}
+	})
+}
+
+// eta экстраполирует оставшееся время по среднему времени пройденных
+// итераций.
+func (t *convergenceTracker) eta(now time.Time) (time.Duration, bool) {
+	if t.started.IsZero() || t.iterations <= 0 {
+		return 0, false
+	}
+	done := t.graph*t.iterations + min(t.lastIter, t.iterations)
+	total := max(t.graphs, t.graph+1) * t.iterations
+	elapsed := now.Sub(t.started)
+	if done <= 0 || elapsed <= 0 {
+		return 0, false
+	}
+	return time.Duration(float64(elapsed) / float64(done) * float64(total-done)), true
+}
+
+// countGraphs — число строк данных во входном CSV (по графу на строку);
+// 0, если файл не читается.
+func countGraphs(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	cr := csv.NewReader(br)
+	cr.Comma = sniffDelimiter(br)
+	cr.LazyQuotes = true
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	n := -1 // заголовок
+	for {
+		if _, err := cr.Read(); err != nil {
+			return max(n, 0)
+		}
+		n++
+	}
+}
+
+// lineWriter режет поток на строки и отдаёт каждую целиком в fn.
+type lineWriter struct {
+	mu  sync.Mutex
+	buf []byte
+	fn  func(string)
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		lw.fn(string(bytes.TrimRight(lw.buf[:i], "\r")))
+		lw.buf = lw.buf[i+1:]
+	}
+	// Защита от бесконечной строки без перевода каретки.
+	if len(lw.buf) > 64<<10 {
+		lw.buf = lw.buf[:0]
+	}
+	return len(p), nil
+}
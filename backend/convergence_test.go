@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestConvergenceTrackerETA: первые итерации медленнее остальных, так что
+// ранняя оценка завышена и по мере работы сходится к реальному окончанию.
+func TestConvergenceTrackerETA(t *testing.T) {
+	id := genID()
+	jobs.Start(&jobRecord{ID: id}, nil)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tr := &convergenceTracker{jobID: id, started: start, graphs: 2}
+
+	tr.observe("[job x] runner started", start.Add(time.Second))
+	if job, _ := jobs.Lookup(id); job.ETASeconds != nil || job.EstimatedCompletion != nil {
+		t.Fatalf("ETA before the first iteration: %v, %v", job.ETASeconds, job.EstimatedCompletion)
+	}
+
+	// 2 графа по 5 итераций; всего 23 с.
+	steps := []time.Duration{4, 3, 2, 2, 2, 2, 2, 2, 2, 2}
+	finish := start.Add(23 * time.Second)
+	now, prevErr := start, math.Inf(1)
+	for i, step := range steps {
+		now = now.Add(step * time.Second)
+		tr.observe(fmt.Sprintf("  Iter %d/5: Total Cost = %d.00", i%5+1, 1000-i), now)
+		job, _ := jobs.Lookup(id)
+		if job.ETASeconds == nil || job.EstimatedCompletion == nil {
+			t.Fatalf("iteration %d: no ETA", i+1)
+		}
+		if got := job.EstimatedCompletion.Sub(now).Seconds(); math.Abs(got-*job.ETASeconds) > 0.1 {
+			t.Errorf("iteration %d: eta_seconds %.1f does not match estimated_completion (%.1f s ahead)", i+1, *job.ETASeconds, got)
+		}
+		errSecs := math.Abs(job.EstimatedCompletion.Sub(finish).Seconds())
+		if errSecs > prevErr {
+			t.Errorf("iteration %d: estimate moved away from the finish: off by %.1fs, was %.1fs", i+1, errSecs, prevErr)
+		}
+		prevErr = errSecs
+	}
+	if prevErr > 0.01 {
+		t.Errorf("final estimate off by %.2fs", prevErr)
+	}
+
+	jobs.Finish(id, nil)
+	if job, _ := jobs.Lookup(id); job.ETASeconds != nil {
+		t.Errorf("finished job still reports eta_seconds = %v", *job.ETASeconds)
+	}
+}
+
+func TestConvergenceTrackerETAWithoutTotal(t *testing.T) {
+	id := genID()
+	jobs.Start(&jobRecord{ID: id}, nil)
+	start := time.Now()
+	tr := &convergenceTracker{jobID: id, started: start, iterations: 4}
+	tr.observe("Iter 1: cost = 10", start.Add(3*time.Second))
+	job, _ := jobs.Lookup(id)
+	if job.ETASeconds == nil || *job.ETASeconds != 9 {
+		t.Fatalf("eta_seconds = %v, want 9 (3 more iterations of 3s)", job.ETASeconds)
+	}
+}
+
+func TestCountGraphs(t *testing.T) {
+	tests := []struct {
+		name, content string
+		want          int
+	}{
+		{"comma", "GraphIndex,GraphMatrix,RoutesStartEnd\n1,\"[[0]]\",\"[0,0]\"\n2,\"[[0]]\",\"[0,0]\"\n", 2},
+		{"semicolon with BOM", "\ufeffGraphIndex;GraphMatrix;RoutesStartEnd\n1;[[0]];[0,0]\n", 1},
+		{"header only", "GraphIndex,GraphMatrix,RoutesStartEnd\n", 0},
+		{"empty", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "in.csv")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if got := countGraphs(path); got != tt.want {
+				t.Errorf("countGraphs = %d, want %d", got, tt.want)
+			}
+		})
+	}
+	if got := countGraphs(filepath.Join(t.TempDir(), "missing.csv")); got != 0 {
+		t.Errorf("missing file: countGraphs = %d", got)
+	}
+}
+
+func TestConvergenceInResponse(t *testing.T) {
+	const stderrRunner = `import json, sys
+for i, cost in enumerate([30, 20, 15], 1):
+    print("  Iter %d/3: Total Cost = %.2f" % (i, cost), file=sys.stderr)
+print(json.dumps({"ok": True, "results": [], "summary": {}}))
+`
+	const jsonRunner = `import json
+print(json.dumps({"ok": True, "results": [], "summary": {},
+    "convergence": [{"graph_index": 1, "history": [{"iteration": 1, "cost": 5}]}]}))
+`
+	tests := []struct {
+		name, script string
+		want         []any
+	}{
+		{"from stderr", stderrRunner, []any{
+			map[string]any{"graph": float64(0), "iteration": float64(1), "objective": float64(30)},
+			map[string]any{"graph": float64(0), "iteration": float64(2), "objective": float64(20)},
+			map[string]any{"graph": float64(0), "iteration": float64(3), "objective": float64(15)},
+		}},
+		// История из JSON runner.py важнее разобранной из stderr.
+		{"from runner json", jsonRunner, []any{
+			map[string]any{"graph_index": float64(1), "history": []any{map[string]any{"iteration": float64(1), "cost": float64(5)}}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeRunner(t, tt.script)
+			got := decodeBody(t, postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil), http.StatusOK)
+			if !reflect.DeepEqual(got["convergence"], tt.want) {
+				t.Errorf("convergence = %v, want %v", got["convergence"], tt.want)
+			}
+		})
+	}
+
+	// /status показывает историю, разобранную из stderr.
+	fakeRunner(t, stderrRunner)
+	got := decodeBody(t, postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil), http.StatusOK)
+	rec := httptest.NewRecorder()
+	status(rec, httptest.NewRequest(http.MethodGet, "/status?id="+got["job_id"].(string), nil))
+	if conv, _ := decodeBody(t, rec, http.StatusOK)["convergence"].([]any); len(conv) != 3 {
+		t.Errorf("/status convergence = %v, want 3 points", conv)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+)
+
+// errUnknownColumn возвращается, если запрошенной колонки нет в CSV.
+type errUnknownColumn struct {
+	Column    string
+	Available []string
+}
+
+func (e *errUnknownColumn) Error() string {
+	return fmt.Sprintf("unknown column %q, available: %s", e.Column, strings.Join(e.Available, ","))
+}
+
+// splitList разбирает "a,b,c" из query-параметра, пропуская пустые элементы.
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// projectCSV оставляет только колонки columns (в указанном порядке), затем
+// переставляет их согласно order: перечисленные идут первыми, остальные —
+// в исходном порядке. Пустые columns и order означают «без изменений».
+func projectCSV(data []byte, columns, order []string) ([]byte, error) {
+	if len(columns) == 0 && len(order) == 0 {
+		return data, nil
+	}
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return data, nil
+	}
+	header := rows[0]
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[h] = i
+	}
+
+	selected := make([]int, 0, len(header))
+	if len(columns) == 0 {
+		for i := range header {
+			selected = append(selected, i)
+		}
+	}
+	for _, c := range columns {
+		i, ok := index[c]
+		if !ok {
+			return nil, &errUnknownColumn{Column: c, Available: header}
+		}
+		selected = append(selected, i)
+	}
+
+	if len(order) > 0 {
+		inSelection := make(map[int]bool, len(selected))
+		for _, i := range selected {
+			inSelection[i] = true
+		}
+		reordered := make([]int, 0, len(selected))
+		placed := make(map[int]bool, len(selected))
+		for _, c := range order {
+			i, ok := index[c]
+			if !ok || !inSelection[i] {
+				return nil, &errUnknownColumn{Column: c, Available: header}
+			}
+			if !placed[i] {
+				reordered = append(reordered, i)
+				placed[i] = true
+			}
+		}
+		for _, i := range selected {
+			if !placed[i] {
+				reordered = append(reordered, i)
+			}
+		}
+		selected = reordered
+	}
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	out := make([]string, len(selected))
+	for _, row := range rows {
+		for j, i := range selected {
+			if i < len(row) {
+				out[j] = row[i]
+			} else {
+				out[j] = ""
+			}
+		}
+		if err := cw.Write(out); err != nil {
+			return nil, err
+		}
+	}
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestProjectCSV(t *testing.T) {
+	const data = "id,from,to,cost\n1,a,b,5\n2,c,d,7\n"
+	tests := []struct {
+		name           string
+		columns, order []string
+		want           string
+		unknown        string
+	}{
+		{"unchanged", nil, nil, data, ""},
+		{"select", []string{"cost", "id"}, nil, "cost,id\n5,1\n7,2\n", ""},
+		{"order only", nil, []string{"cost"}, "cost,id,from,to\n5,1,a,b\n7,2,c,d\n", ""},
+		{"select and order", []string{"id", "from", "to"}, []string{"to", "from"}, "to,from,id\nb,a,1\nd,c,2\n", ""},
+		{"duplicate order", nil, []string{"to", "to"}, "to,id,from,cost\nb,1,a,5\nd,2,c,7\n", ""},
+		{"unknown column", []string{"id", "weight"}, nil, "", "weight"},
+		{"order outside selection", []string{"id"}, []string{"cost"}, "", "cost"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := projectCSV([]byte(data), tt.columns, tt.order)
+			if tt.unknown != "" {
+				var unknown *errUnknownColumn
+				if !errors.As(err, &unknown) || unknown.Column != tt.unknown {
+					t.Fatalf("projectCSV = %v, want unknown column %q", err, tt.unknown)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("projectCSV = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadColumns(t *testing.T) {
+	defer func(s *resultStore, m *missLimiter) { store, downloadMiss = s, m }(store, downloadMiss)
+	store = newResultStore(10)
+	downloadMiss = newMissLimiter(100, time.Minute, time.Minute)
+	id := genID()
+	store.Store(id, newRecord("classic.csv", []byte("id,cost\n1,5\n"), ""))
+	tests := []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"&columns=cost", http.StatusOK, "cost\n5\n"},
+		{"&order=cost", http.StatusOK, "cost,id\n5,1\n"},
+		{"&columns=missing", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := getDownload(t, "id="+id+tt.query)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", rec.Body, tt.body)
+			}
+		})
+	}
+}
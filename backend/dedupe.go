@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"io"
+)
+
+// dedupeResult — итог удаления дубликатов строк во входном CSV.
+type dedupeResult struct {
+	Removed int
+	Capped  bool
+}
+
+// dedupeRows копирует src в dst, пропуская точные повторы строк (первая
+// сохраняется, заголовок всегда пишется). Память ограничена maxRows
+// хешами: после заполнения множества остаток копируется как есть.
+func dedupeRows(src io.Reader, dst io.Writer, maxRows int) (dedupeResult, error) {
+	var res dedupeResult
+	br := bufio.NewReader(src)
+	seen := make(map[[sha256.Size]byte]struct{})
+	first := true
+
+	for {
+		rec, err := readRecord(br)
+		if len(rec) > 0 {
+			key := sha256.Sum256(bytes.TrimRight(rec, "\r\n"))
+			_, dup := seen[key]
+			switch {
+			case first:
+				first = false
+			case dup:
+				res.Removed++
+				rec = nil
+			case len(seen) < maxRows:
+				seen[key] = struct{}{}
+			default:
+				res.Capped = true
+			}
+			if rec != nil {
+				if _, werr := dst.Write(rec); werr != nil {
+					return res, werr
+				}
+			}
+		}
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+}
+
+// readRecord читает одну логическую запись CSV: строки склеиваются,
+// пока кавычки не сбалансированы (значение в кавычках может содержать \n).
+func readRecord(br *bufio.Reader) ([]byte, error) {
+	var rec []byte
+	for {
+		line, err := br.ReadBytes('\n')
+		rec = append(rec, line...)
+		if err != nil || bytes.Count(rec, []byte{'"'})%2 == 0 {
+			return rec, err
+		}
+	}
+}
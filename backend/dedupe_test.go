@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDedupeRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		max     int
+		want    string
+		removed int
+		capped  bool
+	}{
+		{"no duplicates", "a,b\n1,2\n3,4\n", 10, "a,b\n1,2\n3,4\n", 0, false},
+		{"exact repeats", "a,b\n1,2\n1,2\n3,4\n1,2\n", 10, "a,b\n1,2\n3,4\n", 2, false},
+		{"crlf and lf are the same row", "a,b\r\n1,2\r\n1,2\n", 10, "a,b\r\n1,2\r\n", 1, false},
+		{"no trailing newline", "a,b\n1,2\n1,2", 10, "a,b\n1,2\n", 1, false},
+		{"header kept", "a,b\na,b\n", 10, "a,b\na,b\n", 0, false},
+		{"quoted newline", "a,b\n\"x\ny\",1\n\"x\ny\",1\n", 10, "a,b\n\"x\ny\",1\n", 1, false},
+		{"capped", "a\n1\n2\n3\n3\n1\n", 2, "a\n1\n2\n3\n3\n", 1, true},
+		{"empty", "", 10, "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			res, err := dedupeRows(strings.NewReader(tt.in), &out, tt.max)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want || res.Removed != tt.removed || res.Capped != tt.capped {
+				t.Errorf("dedupeRows = %q, %+v; want %q, removed %d, capped %v", out.String(), res, tt.want, tt.removed, tt.capped)
+			}
+		})
+	}
+}
+
+func TestProcessDedupe(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	const in = "a,b\n1,2\n1,2\n3,4\n"
+	tests := []struct {
+		dedupe  string
+		input   string
+		removed any
+	}{
+		{"", in, nil},
+		{"1", "a,b\n1,2\n3,4\n", float64(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dedupe, func(t *testing.T) {
+			got := decodeBody(t, postProcess(t, url.Values{"dedupe": {tt.dedupe}}, "in.csv", in, nil), http.StatusOK)
+			if removed := got["summary"].(map[string]any)["duplicate_rows_removed"]; removed != tt.removed {
+				t.Errorf("duplicate_rows_removed = %v, want %v", removed, tt.removed)
+			}
+			// echoRunner возвращает свой вход как classic.csv.
+			id := got["downloads"].(map[string]any)["classic_csv"].(string)
+			if rec := getDownload(t, "id="+id); rec.Body.String() != tt.input {
+				t.Errorf("runner input = %q, want %q", rec.Body, tt.input)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// downloadCharsets — кодировки для ?encoding=; хранится всегда UTF-8, а
+// перекодируется при отдаче. Значение — имя для charset в Content-Type.
+var downloadCharsets = map[string]struct {
+	name string
+	enc  *charmap.Charmap
+}{
+	"cp1251":       {"windows-1251", charmap.Windows1251},
+	"windows-1251": {"windows-1251", charmap.Windows1251},
+}
+
+func download(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ip := clientIP(r)
+	if downloadMiss.Blocked(ip) {
+		http.Error(w, "too many failed downloads, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	q := r.URL.Query()
+	id := q.Get("id")
+	if !downloadIDRe.MatchString(id) {
+		downloadMiss.Miss(ip)
+		log.Printf("Malformed download id from %s: %q", ip, truncate(id, 64))
+		http.Error(w, "malformed id", http.StatusBadRequest)
+		return
+	}
+	// Подписанная ссылка заменяет проверку tenant'а, но только на чтение.
+	signed := q.Has("sig") || q.Has("expires")
+	if signed {
+		if err := verifyDownloadSignature(q, time.Now()); err != nil {
+			downloadMiss.Miss(ip)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			http.Error(w, "signed links are read-only", http.StatusForbidden)
+			return
+		}
+	}
+	rec, ok := store.Load(id)
+	if !ok || (!signed && rec.Tenant != tenantOf(r)) {
+		downloadMiss.Miss(ip)
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		store.Delete(id)
+		log.Printf("Download %s deleted by client", id)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch q.Get("as") {
+	case "":
+	case "routes":
+		serveRoutes(w, rec)
+		return
+	default:
+		http.Error(w, "as must be routes", http.StatusBadRequest)
+		return
+	}
+
+	// BOM нужен Excel, чтобы распознать UTF-8 (иначе кириллица ломается);
+	// по умолчанию выключен, чтобы не мешать программным потребителям.
+	bom := getenv("DOWNLOAD_BOM", "") == "1"
+	if v := q.Get("bom"); v != "" {
+		var err error
+		if bom, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "bom must be a boolean", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// ?encoding=cp1251 — для потребителей, которые не читают UTF-8.
+	// Символы вне кодировки заменяются на "?".
+	charset := "utf-8"
+	var encoder transform.Transformer
+	if v := strings.ToLower(q.Get("encoding")); v != "" && v != "utf-8" && v != "utf8" {
+		cs, ok := downloadCharsets[v]
+		if !ok {
+			http.Error(w, "encoding must be utf-8 or cp1251", http.StatusBadRequest)
+			return
+		}
+		if q.Get("bom") != "" && bom {
+			http.Error(w, "bom is only valid for utf-8", http.StatusBadRequest)
+			return
+		}
+		charset, bom = cs.name, false
+		encoder = transform.Chain(runes.Map(func(c rune) rune {
+			if _, ok := cs.enc.EncodeRune(c); !ok {
+				return '?'
+			}
+			return c
+		}), cs.enc.NewEncoder())
+	}
+
+	// ?filename= меняет только имя в Content-Disposition; оно проходит ту
+	// же очистку, что и имена от runner.py.
+	name := rec.Name
+	if v := q.Get("filename"); v != "" {
+		if len(v) > 255 {
+			http.Error(w, "filename is too long", http.StatusBadRequest)
+			return
+		}
+		if name = safeName(v, ""); name == "" {
+			http.Error(w, "invalid filename", http.StatusBadRequest)
+			return
+		}
+	}
+
+	columns, order := splitList(q.Get("columns")), splitList(q.Get("order"))
+	if rec.Path != "" && len(columns) == 0 && len(order) == 0 && !bom && encoder == nil {
+		serveStoredFile(w, r, rec, name)
+		return
+	}
+	src, err := recordBody(rec, columns, order)
+	if err != nil {
+		var unknown *errUnknownColumn
+		if errors.As(err, &unknown) {
+			http.Error(w, unknown.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "malformed stored csv: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer src.Close()
+	var body io.Reader = src
+	if bom {
+		body = io.MultiReader(bytes.NewReader(utf8BOM), src)
+	}
+
+	if encoder != nil {
+		body = transform.NewReader(body, encoder)
+	}
+
+	enc := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	w.Header().Set("Content-Type", "text/csv; charset="+charset)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	// Длина и ETag известны заранее только для файла целиком; проекция
+	// колонок считается на лету, сжатие и перекодировка меняют длину.
+	if len(columns) == 0 && len(order) == 0 {
+		etag := rec.SHA256
+		if bom {
+			etag += "-bom"
+		}
+		if encoder != nil {
+			etag += "-" + charset
+		}
+		if enc != "identity" {
+			etag += "-" + enc
+		} else if encoder == nil {
+			size := rec.Size
+			if bom {
+				size += int64(len(utf8BOM))
+			}
+			w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		}
+		w.Header().Set("ETag", `"`+etag+`"`)
+	}
+	if r.Method == http.MethodHead {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if enc != "identity" {
+			w.Header().Set("Content-Encoding", enc)
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	release, ok := downloadSlots.Acquire(ip)
+	if !ok {
+		http.Error(w, "too many concurrent downloads from this client", http.StatusTooManyRequests)
+		return
+	}
+	defer release()
+
+	w = throttle(w, r.Context(), downloadRate)
+	out := encodeResponse(w, enc)
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(out, body); err != nil {
+		log.Printf("Download %s interrupted: %v", id, err)
+	}
+	out.Close()
+}
+
+// serveRoutes — ?as=routes: маршруты из файла результата в виде JSON.
+func serveRoutes(w http.ResponseWriter, rec csvRecord) {
+	src, err := rec.reader()
+	if err != nil {
+		http.Error(w, "malformed stored csv: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer src.Close()
+	routes, err := parseRouteAssignments(src)
+	if err != nil {
+		var missing *errMissingColumns
+		if errors.As(err, &missing) {
+			http.Error(w, missing.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "malformed stored csv: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"name": rec.Name, "routes": routes})
+}
+
+// serveStoredFile отдаёт файл из STORE_DIR через http.ServeContent, не
+// читая его в память: так работают Range, If-None-Match и Content-Length.
+// Сжатие здесь не применяется — иначе ломаются диапазоны.
+func serveStoredFile(w http.ResponseWriter, r *http.Request, rec csvRecord, name string) {
+	f, err := os.Open(rec.Path)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	if r.Method != http.MethodHead {
+		release, ok := downloadSlots.Acquire(clientIP(r))
+		if !ok {
+			http.Error(w, "too many concurrent downloads from this client", http.StatusTooManyRequests)
+			return
+		}
+		defer release()
+		w = throttle(w, r.Context(), downloadRate)
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("ETag", `"`+rec.SHA256+`"`)
+	http.ServeContent(w, r, name, time.Time{}, f)
+}
+
+// recordBody возвращает содержимое записи целиком либо проекцию колонок.
+func recordBody(rec csvRecord, columns, order []string) (io.ReadCloser, error) {
+	src, err := rec.reader()
+	if err != nil || (len(columns) == 0 && len(order) == 0) {
+		return src, err
+	}
+	raw, err := io.ReadAll(src)
+	src.Close()
+	if err != nil {
+		return nil, err
+	}
+	data, err := projectCSV(raw, columns, order)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// getDownload выполняет GET /download с заданным query.
+func getDownload(t *testing.T, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	download(rec, httptest.NewRequest(http.MethodGet, "/download?"+query, nil))
+	return rec
+}
+
+func TestDownloadLRUEviction(t *testing.T) {
+	defer func(s *resultStore, m *missLimiter) { store, downloadMiss = s, m }(store, downloadMiss)
+	downloadMiss = newMissLimiter(100, time.Minute, time.Minute)
+
+	tests := []struct {
+		name    string
+		touch   []int // какие записи скачать до переполнения
+		evicted []int
+	}{
+		{"oldest by insertion", nil, []int{0}},
+		{"download refreshes entry", []int{0}, []int{1}},
+		{"several refreshed", []int{0, 1}, []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store = newResultStore(3)
+			ids := []string{genID(), genID(), genID(), genID()}
+			for _, id := range ids[:3] {
+				store.Store(id, newRecord("classic.csv", []byte("a,b\n1,2\n"), ""))
+			}
+			for _, i := range tt.touch {
+				if rec := getDownload(t, "id="+ids[i]); rec.Code != http.StatusOK {
+					t.Fatalf("download %d: %d", i, rec.Code)
+				}
+			}
+			store.Store(ids[3], newRecord("classic.csv", []byte("a,b\n3,4\n"), ""))
+
+			for i, id := range ids {
+				want := http.StatusOK
+				for _, e := range tt.evicted {
+					if e == i {
+						want = http.StatusNotFound
+					}
+				}
+				// Peek не трогает порядок LRU, в отличие от скачивания.
+				if _, ok := store.Peek(id); ok != (want == http.StatusOK) {
+					t.Errorf("entry %d stored = %v", i, ok)
+				}
+				if rec := getDownload(t, "id="+id); rec.Code != want {
+					t.Errorf("download %d: status %d, want %d", i, rec.Code, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadBOM(t *testing.T) {
+	defer func(s *resultStore) { store = s }(store)
+	store = newResultStore(10)
+	const data = "route,name\n1,Москва\n"
+	id := genID()
+	store.Store(id, newRecord("r.csv", []byte(data), ""))
+
+	tests := []struct {
+		env, query string
+		status     int
+		bom        bool
+	}{
+		{"", "", http.StatusOK, false},
+		{"", "&bom=1", http.StatusOK, true},
+		{"1", "", http.StatusOK, true},
+		{"1", "&bom=false", http.StatusOK, false},
+		{"", "&bom=maybe", http.StatusBadRequest, false},
+		{"", "&bom=1&encoding=cp1251", http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run("DOWNLOAD_BOM="+tt.env+tt.query, func(t *testing.T) {
+			t.Setenv("DOWNLOAD_BOM", tt.env)
+			rec := getDownload(t, "id="+id+tt.query)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d %s, want %d", rec.Code, rec.Body, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			want := data
+			if tt.bom {
+				want = "\ufeff" + data
+			}
+			if rec.Body.String() != want {
+				t.Errorf("body = %q, want %q", rec.Body, want)
+			}
+			if cl := rec.Header().Get("Content-Length"); cl != strconv.Itoa(len(want)) {
+				t.Errorf("Content-Length = %s, want %d", cl, len(want))
+			}
+		})
+	}
+}
+
+func TestDownloadEncoding(t *testing.T) {
+	defer func(s *resultStore) { store = s }(store)
+	store = newResultStore(10)
+	id := genID()
+	const csv = "маршрут,улица\n1,Тверская\n2,Café ✓\n"
+	store.Store(id, newRecord("classic.csv", []byte(csv), ""))
+
+	tests := []struct {
+		query       string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"", http.StatusOK, "text/csv; charset=utf-8", csv},
+		{"&encoding=utf-8", http.StatusOK, "text/csv; charset=utf-8", csv},
+		// é и ✓ в cp1251 нет — они заменяются на "?".
+		{"&encoding=cp1251", http.StatusOK, "text/csv; charset=windows-1251", "маршрут,улица\n1,Тверская\n2,Caf? ?\n"},
+		{"&encoding=Windows-1251", http.StatusOK, "text/csv; charset=windows-1251", "маршрут,улица\n1,Тверская\n2,Caf? ?\n"},
+		{"&encoding=cp1251&bom=1", http.StatusBadRequest, "", ""},
+		{"&encoding=koi8-r", http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := getDownload(t, "id="+id+tt.query)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.contentType)
+			}
+			body := rec.Body.String()
+			if strings.HasSuffix(tt.contentType, "windows-1251") {
+				decoded, err := charmap.Windows1251.NewDecoder().String(body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if decoded == body {
+					t.Error("body was not transcoded")
+				}
+				body = decoded
+			}
+			if body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestDownloadHead(t *testing.T) {
+	defer func(s *resultStore) { store = s }(store)
+	store = newResultStore(10)
+	id := genID()
+	body := []byte("a,b\n1,2\n")
+	store.Store(id, newRecord("classic.csv", body, ""))
+
+	get := getDownload(t, "id="+id)
+	head := httptest.NewRecorder()
+	download(head, httptest.NewRequest(http.MethodHead, "/download?id="+id, nil))
+	if head.Code != http.StatusOK || head.Body.Len() != 0 {
+		t.Fatalf("HEAD: status %d, body %q", head.Code, head.Body)
+	}
+	if got := head.Header().Get("Content-Length"); got != strconv.Itoa(len(body)) {
+		t.Errorf("HEAD Content-Length = %q, want %d", got, len(body))
+	}
+	if etag := head.Header().Get("ETag"); etag == "" || etag != get.Header().Get("ETag") {
+		t.Errorf("HEAD ETag %q, GET ETag %q", etag, get.Header().Get("ETag"))
+	}
+	if got := head.Header().Get("Content-Disposition"); got != get.Header().Get("Content-Disposition") {
+		t.Errorf("HEAD Content-Disposition %q", got)
+	}
+
+	missing := httptest.NewRecorder()
+	download(missing, httptest.NewRequest(http.MethodHead, "/download?id="+genID(), nil))
+	if missing.Code != http.StatusNotFound {
+		t.Errorf("HEAD unknown id: status %d", missing.Code)
+	}
+}
+
+func TestDownloadFilename(t *testing.T) {
+	defer func(s *resultStore) { store = s }(store)
+	store = newResultStore(10)
+	id := genID()
+	store.Store(id, newRecord("classic.csv", []byte("a\n1\n"), ""))
+	tests := []struct {
+		filename string
+		status   int
+		want     string
+	}{
+		{"", http.StatusOK, "classic.csv"},
+		{"team-42.csv", http.StatusOK, "team-42.csv"},
+		{`../x"y.csv`, http.StatusOK, "_x_y.csv"},
+		{"..", http.StatusBadRequest, ""},
+		{strings.Repeat("a", 256), http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			rec := getDownload(t, "id="+id+"&filename="+url.QueryEscape(tt.filename))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="`+tt.want+`"` {
+				t.Errorf("Content-Disposition = %s, want filename %q", got, tt.want)
+			}
+			// Имя в store не меняется.
+			if rec, _ := store.Peek(id); rec.Name != "classic.csv" {
+				t.Errorf("stored name changed to %q", rec.Name)
+			}
+		})
+	}
+}
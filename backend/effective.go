@@ -0,0 +1,142 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// effectiveParameters — параметры запуска в том виде, в каком они уходят в
+// runner.py. Из этой же структуры строится argv, поэтому блок "parameters"
+// в ответе не может разойтись с тем, что реально запускалось.
+type effectiveParameters struct {
+	SolverIterations int       `json:"solver_iterations"`
+	MireaEnabled     bool      `json:"mirea_enabled"`
+	MireaShots       int       `json:"mirea_shots"`
+	MireaSamples     int       `json:"mirea_samples"`
+	MireaMaxCalls    int       `json:"mirea_max_calls"`
+	PLayers          int       `json:"p_layers"`
+	MaxRoutes        int       `json:"max_routes"`
+	Workers          int       `json:"workers"`
+	RerouteFraction  *float64  `json:"reroute_fraction,omitempty"`
+	RerouteFractions []float64 `json:"reroute_fractions,omitempty"`
+	Seed             *int64    `json:"seed"`
+	Dedupe           bool      `json:"dedupe"`
+	Preview          bool      `json:"preview,omitempty"`
+	Team             string    `json:"team"`
+	TimeoutSeconds   float64   `json:"timeout_seconds"`
+	RetainSeconds    float64   `json:"retain_seconds,omitempty"`
+	// MinImprovementPct — порог MIN_IMPROVEMENT_PCT для блока comparison.
+	MinImprovementPct *float64 `json:"min_improvement_pct,omitempty"`
+	// QuantumTargetCost задан только в режиме conditional_quantum.
+	QuantumTargetCost *float64 `json:"quantum_target_cost,omitempty"`
+	// EnvOverrides — ключи env_overrides; значения (там могут быть
+	// учётные данные) в ответ не попадают.
+	EnvOverrides []string `json:"env_overrides,omitempty"`
+
+	env    map[string]string
+	config settings
+}
+
+// setting — настройка сервера с учётом env_overrides задачи.
+func (e effectiveParameters) setting(k, def string) string {
+	if v, ok := e.env[k]; ok {
+		return v
+	}
+	return e.config.get(k, def)
+}
+
+func (e effectiveParameters) settingInt(k string, def int) int {
+	if n, err := strconv.Atoi(e.setting(k, "")); err == nil {
+		return n
+	}
+	return e.config.getInt(k, def)
+}
+
+// mireaAvailable — есть ли учётные данные MIREA для этой задачи: из её
+// снимка настроек или env_overrides, как их получит runner.py.
+func (e effectiveParameters) mireaAvailable() bool {
+	return e.setting("MIREA_EMAIL", "") != "" && e.setting("MIREA_PASSWORD", "") != ""
+}
+
+// environ — env_overrides в виде KEY=VALUE для runPython.
+func (e effectiveParameters) environ() []string {
+	out := make([]string, 0, len(e.EnvOverrides))
+	for _, k := range e.EnvOverrides {
+		out = append(out, k+"="+e.env[k])
+	}
+	return out
+}
+
+func newEffectiveParameters(p solverParams) effectiveParameters {
+	e := effectiveParameters{
+		MireaEnabled:      true,
+		PLayers:           p.PLayers,
+		MaxRoutes:         p.MaxRoutes,
+		Workers:           4,
+		Seed:              p.Seed,
+		Dedupe:            p.Dedupe,
+		Preview:           p.Preview,
+		Team:              p.Team,
+		TimeoutSeconds:    p.Timeout.Seconds(),
+		RetainSeconds:     p.Retain.Seconds(),
+		QuantumTargetCost: p.QuantumTarget,
+		EnvOverrides:      slices.Sorted(maps.Keys(p.EnvOverrides)),
+		env:               p.EnvOverrides,
+		config:            p.config,
+	}
+	e.SolverIterations = e.settingInt("SOLVER_ITERATIONS", 15)
+	e.MireaShots = e.settingInt("MIREA_SHOTS", 1024)
+	e.MireaSamples = e.settingInt("MIREA_SAMPLES", 2)
+	e.MireaMaxCalls = e.settingInt("MIREA_MAX_CALLS", 10)
+	if v := e.config.lookup("MIN_IMPROVEMENT_PCT"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			e.MinImprovementPct = &f
+		}
+	}
+	if len(p.RerouteFractions) == 1 {
+		e.RerouteFraction = &p.RerouteFractions[0]
+	} else {
+		e.RerouteFractions = p.RerouteFractions
+	}
+	return e
+}
+
+// withFraction — копия для одной точки sweep-запуска.
+func (e effectiveParameters) withFraction(f float64) effectiveParameters {
+	e.RerouteFraction = &f
+	e.RerouteFractions = nil
+	return e
+}
+
+// args строит аргументы runner.py. Учётные данные MIREA берутся из
+// окружения и в ответ не попадают.
+func (e effectiveParameters) args(runnerPath, inputPath string) []string {
+	fraction := 0.1
+	if e.RerouteFraction != nil {
+		fraction = *e.RerouteFraction
+	}
+	args := []string{
+		runnerPath,
+		"--csv-file", inputPath,
+		"--iterations", strconv.Itoa(e.SolverIterations),
+		"--reroute-fraction", strconv.FormatFloat(fraction, 'f', -1, 64),
+		"--max-routes", strconv.Itoa(e.MaxRoutes),
+		"--p-layers", strconv.Itoa(e.PLayers),
+		"--workers", strconv.Itoa(e.Workers),
+	}
+	if e.MireaEnabled {
+		args = append(args,
+			"--use-mirea",
+			"--mirea-email", e.setting("MIREA_EMAIL", ""),
+			"--mirea-password", e.setting("MIREA_PASSWORD", ""),
+			"--mirea-shots", strconv.Itoa(e.MireaShots),
+			"--mirea-samples", strconv.Itoa(e.MireaSamples),
+			"--max-total-mirea-calls", strconv.Itoa(e.MireaMaxCalls),
+		)
+	}
+	if e.Seed != nil {
+		args = append(args, "--seed", strconv.FormatInt(*e.Seed, 10))
+	}
+	return args
+}
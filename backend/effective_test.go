@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// argValue — значение флага из argv runner.py.
+func argValue(argv []any, flag string) any {
+	for i, a := range argv {
+		if a == flag && i+1 < len(argv) {
+			return argv[i+1]
+		}
+	}
+	return nil
+}
+
+func TestEffectiveParametersMatchArgv(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	t.Setenv("SOLVER_ITERATIONS", "9")
+	t.Setenv("MIREA_SHOTS", "256")
+	form := url.Values{
+		"p_layers":          {"3"},
+		"max_routes":        {"5"},
+		"reroute_fractions": {"0.25"},
+		"seed":              {"7"},
+	}
+	got := decodeBody(t, postProcess(t, form, "in.csv", "a,b\n1,2\n", nil), http.StatusOK)
+	params := got["parameters"].(map[string]any)
+	argv := got["summary"].(map[string]any)["argv"].([]any)
+
+	for flag, key := range map[string]string{
+		"--iterations":       "solver_iterations",
+		"--p-layers":         "p_layers",
+		"--max-routes":       "max_routes",
+		"--workers":          "workers",
+		"--reroute-fraction": "reroute_fraction",
+		"--seed":             "seed",
+		"--mirea-shots":      "mirea_shots",
+		"--mirea-samples":    "mirea_samples",
+	} {
+		// JSON-числа приходят как float64, в argv — строки.
+		want := strconv.FormatFloat(params[key].(float64), 'f', -1, 64)
+		if argValue(argv, flag) != want {
+			t.Errorf("%s = %v, parameters.%s = %v", flag, argValue(argv, flag), key, params[key])
+		}
+	}
+
+	// /validate-params показывает те же параметры, не запуская runner.
+	req := httptest.NewRequest(http.MethodPost, "/validate-params", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	validateParams(rec, req)
+	dry := decodeBody(t, rec, http.StatusOK)
+	if dry["valid"] != true || !reflect.DeepEqual(dry["parameters"], got["parameters"]) {
+		t.Errorf("validate-params = %v\nprocess parameters = %v", dry["parameters"], got["parameters"])
+	}
+}
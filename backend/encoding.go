@@ -0,0 +1,87 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Поддерживаемые Content-Encoding в порядке предпочтения при равных q.
+var supportedEncodings = []string{"br", "gzip", "identity"}
+
+// negotiateEncoding выбирает лучшее кодирование из Accept-Encoding
+// с учётом q-значений; при отсутствии заголовка — identity.
+func negotiateEncoding(accept string) string {
+	if accept == "" {
+		return "identity"
+	}
+	q := acceptWeights(accept)
+
+	best, bestQ := "identity", 0.0
+	for _, enc := range supportedEncodings {
+		weight, ok := q[enc]
+		if !ok {
+			weight, ok = q["*"]
+		}
+		if !ok && enc == "identity" {
+			weight, ok = 0.001, true
+		}
+		if ok && weight > bestQ {
+			best, bestQ = enc, weight
+		}
+	}
+	return best
+}
+
+// acceptWeights разбирает Accept-Encoding в карту кодирование -> q.
+func acceptWeights(accept string) map[string]float64 {
+	q := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		weight := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				weight = f
+			}
+		}
+		q[name] = weight
+	}
+	return q
+}
+
+// acceptsEncoding сообщает, допускает ли клиент кодирование enc (q > 0).
+func acceptsEncoding(accept, enc string) bool {
+	q := acceptWeights(accept)
+	weight, ok := q[enc]
+	if !ok {
+		weight, ok = q["*"]
+	}
+	return ok && weight > 0
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// encodeResponse выставляет Content-Encoding и возвращает writer для тела.
+func encodeResponse(w http.ResponseWriter, enc string) io.WriteCloser {
+	w.Header().Add("Vary", "Accept-Encoding")
+	switch enc {
+	case "br":
+		w.Header().Set("Content-Encoding", "br")
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression)
+	case "gzip":
+		w.Header().Set("Content-Encoding", "gzip")
+		return gzip.NewWriter(w)
+	default:
+		return nopWriteCloser{w}
+	}
+}
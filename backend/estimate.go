@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+)
+
+// workload — объём задачи во входном файле, от которого зависит время
+// работы runner.py.
+type workload struct {
+	Graphs int `json:"graphs"`
+	Routes int `json:"routes"`
+	// ops — число шагов поиска пути за одну итерацию: каждый маршрут
+	// перекладывается по плотной матрице, то есть O(n²) на маршрут.
+	ops      float64
+	perGraph []int
+}
+
+// measureWorkload читает файл так же, как validateCSV, но только считает
+// графы и маршруты; на первой некорректной строке возвращает ошибку.
+func measureWorkload(src io.Reader) (workload, error) {
+	var wl workload
+	br := bufio.NewReader(src)
+	cr := csv.NewReader(br)
+	cr.Comma = sniffDelimiter(br)
+	cr.LazyQuotes = true
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return wl, fmt.Errorf("cannot read header: %w", err)
+	}
+	trimBOM(header)
+	index := map[string]int{}
+	for i, h := range header {
+		index[normalizeColumn(h)] = i
+	}
+	for _, c := range requiredColumns {
+		if _, ok := index[normalizeColumn(c)]; !ok {
+			return wl, fmt.Errorf("missing required column %s", c)
+		}
+	}
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			return wl, err
+		}
+		if len(rec) < len(header) {
+			return wl, fmt.Errorf("line %d: too few fields", line)
+		}
+		n, err := matrixSize(rec[index["graphmatrix"]])
+		if err != nil {
+			return wl, fmt.Errorf("line %d: %w", line, err)
+		}
+		routes, err := parseRoutes(rec[index["routesstartend"]])
+		if err != nil {
+			return wl, fmt.Errorf("line %d: %w", line, err)
+		}
+		wl.Graphs++
+		wl.Routes += len(routes) / 2
+		wl.perGraph = append(wl.perGraph, len(routes)/2)
+		wl.ops += float64(len(routes)/2) * float64(n*n)
+	}
+	if wl.Graphs == 0 {
+		return wl, errors.New("no data rows")
+	}
+	return wl, nil
+}
+
+// estimateCost оценивает вызовы MIREA и время одного запуска. Вызовов на
+// граф столько же, сколько в runner.py: не больше mirea_samples и числа
+// маршрутов, в сумме не больше mirea_max_calls.
+func estimateCost(wl workload, e effectiveParameters, mirea bool) map[string]any {
+	calls := 0
+	if mirea && e.MireaEnabled {
+		for _, routes := range wl.perGraph {
+			calls += max(0, min(e.MireaSamples, e.MireaMaxCalls-calls, routes))
+		}
+	}
+	classical := wl.ops * float64(e.SolverIterations) * e.config.getFloat("ESTIMATE_NS_PER_OP", 200) / 1e9
+	quantum := float64(calls) * e.config.getFloat("ESTIMATE_MIREA_CALL_SECONDS", 8)
+	startup := e.config.getFloat("ESTIMATE_STARTUP_SECONDS", 3)
+	return map[string]any{
+		"mirea_calls":       calls,
+		"classical_seconds": math.Round(classical*10) / 10,
+		"mirea_seconds":     quantum,
+		"startup_seconds":   startup,
+		"estimated_seconds": math.Round((classical+quantum+startup)*10) / 10,
+	}
+}
+
+// estimate — POST /estimate: файл и параметры как у /process, но вместо
+// запуска оптимизатора возвращается оценка числа вызовов MIREA и времени.
+// Точки sweep идут параллельно в пределах MAX_CONCURRENT_RUNS, поэтому
+// общее время — это время запуска, умноженное на число «волн».
+func estimate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		http.Error(w, "bad form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	params, err := parseParams(r)
+	if err != nil {
+		var verr *validationError
+		if errors.As(err, &verr) {
+			writeValidationError(w, r, verr)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file required: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	if !allowedExtension(filepath.Ext(header.Filename)) {
+		http.Error(w, "only .csv or .txt files are allowed", http.StatusBadRequest)
+		return
+	}
+
+	wl, err := measureWorkload(file)
+	if err != nil {
+		http.Error(w, "cannot estimate: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	effective := newEffectiveParameters(params)
+	run := estimateCost(wl, effective, effective.mireaAvailable())
+	points := len(params.RerouteFractions)
+	waves := (points + cap(runSlots) - 1) / cap(runSlots)
+	total := run["estimated_seconds"].(float64) * float64(waves)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"input":                   wl,
+		"per_run":                 run,
+		"sweep_points":            points,
+		"total_mirea_calls":       run["mirea_calls"].(int) * points,
+		"total_estimated_seconds": math.Round(total*10) / 10,
+		"timeout_seconds":         params.Timeout.Seconds(),
+		"fits_timeout":            total <= params.Timeout.Seconds(),
+		"parameters":              effective,
+	})
+}
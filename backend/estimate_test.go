@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Два графа по три маршрута.
+const estimateInput = "graph_index,graph_matrix,routes_start_end\n" +
+	"1,\"[[0,1],[1,0]]\",\"[0,1,1,0,0,1]\"\n" +
+	"2,\"[[0,1],[1,0]]\",\"[0,1,1,0,0,1]\"\n"
+
+func postEstimate(t *testing.T) map[string]any {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "in.csv")
+	io.WriteString(fw, estimateInput)
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/estimate", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	estimate(rec, req)
+	return decodeBody(t, rec, http.StatusOK)
+}
+
+func TestEstimateMireaCalls(t *testing.T) {
+	for _, k := range []string{"MIREA_EMAIL", "MIREA_PASSWORD", "MIREA_SAMPLES", "MIREA_MAX_CALLS"} {
+		t.Setenv(k, "")
+	}
+	tests := []struct {
+		name string
+		cfg  map[string]string
+		want float64
+	}{
+		{"no credentials", map[string]string{}, 0},
+		{"credentials in config file", map[string]string{"MIREA_EMAIL": "a@b", "MIREA_PASSWORD": "x"}, 4},
+		{"call budget", map[string]string{"MIREA_EMAIL": "a@b", "MIREA_PASSWORD": "x", "MIREA_MAX_CALLS": "3"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			swapFileConfig(t, tt.cfg)
+			got := postEstimate(t)
+			if calls := got["per_run"].(map[string]any)["mirea_calls"]; calls != tt.want {
+				t.Errorf("mirea_calls = %v, want %v", calls, tt.want)
+			}
+			if got["input"].(map[string]any)["routes"] != 6.0 {
+				t.Errorf("input = %v", got["input"])
+			}
+		})
+	}
+}
+
+// Учётные данные берутся из снимка настроек запроса: перечитанный после
+// приёма CONFIG_FILE на оценку не влияет.
+func TestEstimateUsesSnapshot(t *testing.T) {
+	t.Setenv("MIREA_EMAIL", "")
+	t.Setenv("MIREA_PASSWORD", "")
+	swapFileConfig(t, map[string]string{"MIREA_EMAIL": "a@b", "MIREA_PASSWORD": "x"})
+	params, err := parseForm(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapFileConfig(t, map[string]string{})
+
+	e := newEffectiveParameters(params)
+	if !e.mireaAvailable() {
+		t.Fatal("credentials from the request snapshot ignored")
+	}
+	wl, err := measureWorkload(strings.NewReader(estimateInput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := estimateCost(wl, e, e.mireaAvailable())["mirea_calls"]; calls != 4 {
+		t.Errorf("mirea_calls = %v, want 4", calls)
+	}
+	if mireaAvailable(snapshotSettings()) {
+		t.Error("current settings still report MIREA credentials")
+	}
+}
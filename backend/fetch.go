@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var errForbiddenAddress = errors.New("source address is not allowed")
+
+// fetchSource скачивает входной CSV по source_url. Разрешены только схемы из
+// SOURCE_URL_SCHEMES и (если задан) хосты из SOURCE_URL_ALLOWED_HOSTS;
+// соединения с приватными и loopback-адресами отклоняются на этапе dial,
+// поэтому DNS-rebinding и редиректы внутрь сети тоже не проходят.
+func fetchSource(ctx context.Context, cfg settings, raw string) (io.ReadCloser, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid source_url: %w", err)
+	}
+	if err := checkSourceURL(cfg, u); err != nil {
+		return nil, "", err
+	}
+
+	timeout := cfg.getDuration("SOURCE_URL_TIMEOUT", 30*time.Second)
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: denyPrivateAddress}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return checkSourceURL(cfg, req.URL)
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch source_url: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("fetch source_url: upstream returned %s", resp.Status)
+	}
+	maxBytes := int64(cfg.getInt("SOURCE_URL_MAX_BYTES", 64<<20))
+	if resp.ContentLength > maxBytes {
+		resp.Body.Close()
+		return nil, "", &http.MaxBytesError{Limit: maxBytes}
+	}
+	return http.MaxBytesReader(nil, resp.Body, maxBytes), path.Base(u.Path), nil
+}
+
+func checkSourceURL(cfg settings, u *url.URL) error {
+	schemes := splitList(cfg.get("SOURCE_URL_SCHEMES", "https"))
+	if !containsFold(schemes, u.Scheme) {
+		return fmt.Errorf("source_url scheme %q is not allowed", u.Scheme)
+	}
+	if hosts := splitList(cfg.get("SOURCE_URL_ALLOWED_HOSTS", "")); len(hosts) > 0 && !containsFold(hosts, u.Hostname()) {
+		return fmt.Errorf("source_url host %q is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+func denyPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() ||
+		cgnat.Contains(ip) {
+		return fmt.Errorf("%w: %s", errForbiddenAddress, host)
+	}
+	return nil
+}
+
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
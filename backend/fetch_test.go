@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDenyPrivateAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		denied  bool
+	}{
+		{"127.0.0.1:80", true},
+		{"10.1.2.3:443", true},
+		{"172.16.0.1:443", true},
+		{"192.168.1.10:8080", true},
+		{"169.254.169.254:80", true}, // метаданные облака
+		{"100.64.0.1:80", true},
+		{"0.0.0.0:80", true},
+		{"224.0.0.1:80", true},
+		{"[::1]:443", true},
+		{"[fe80::1]:443", true},
+		{"[fd00::1]:443", true},
+		{"8.8.8.8:443", false},
+		{"[2001:4860:4860::8888]:443", false},
+	}
+	for _, tt := range tests {
+		err := denyPrivateAddress("tcp", tt.address, nil)
+		if got := errors.Is(err, errForbiddenAddress); got != tt.denied {
+			t.Errorf("denyPrivateAddress(%s) = %v, want denied=%v", tt.address, err, tt.denied)
+		}
+	}
+}
+
+func TestCheckSourceURL(t *testing.T) {
+	t.Setenv("SOURCE_URL_SCHEMES", "https")
+	t.Setenv("SOURCE_URL_ALLOWED_HOSTS", "data.example.com")
+	tests := []struct {
+		raw, wantErr string
+	}{
+		{"https://data.example.com/in.csv", ""},
+		{"HTTPS://DATA.EXAMPLE.COM/in.csv", ""},
+		{"http://data.example.com/in.csv", "scheme"},
+		{"file:///etc/passwd", "scheme"},
+		{"https://evil.example.com/in.csv", "host"},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.raw)
+		err := checkSourceURL(snapshotSettings(), u)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("checkSourceURL(%s) = %v, want %q", tt.raw, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFetchSourceRefusesLoopback(t *testing.T) {
+	t.Setenv("SOURCE_URL_SCHEMES", "http")
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+		w.Write([]byte("a,b\n1,2\n"))
+	}))
+	defer srv.Close()
+
+	_, _, err := fetchSource(context.Background(), snapshotSettings(), srv.URL+"/in.csv")
+	if !errors.Is(err, errForbiddenAddress) {
+		t.Errorf("fetchSource(%s) = %v, want %v", srv.URL, err, errForbiddenAddress)
+	}
+	if hit {
+		t.Error("request reached the loopback server")
+	}
+
+	// Через /process — 400, до запуска оптимизатора дело не доходит.
+	rec := postProcess(t, url.Values{"source_url": {srv.URL + "/in.csv"}}, "", "", nil)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "not allowed") {
+		t.Errorf("process = %d %q, want 400 with the address refusal", rec.Code, rec.Body.String())
+	}
+}
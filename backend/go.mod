@@ -1,3 +1,10 @@
 module qbit
 
 go 1.25.1
+
+require (
+	github.com/andybalholm/brotli v1.2.5
+	golang.org/x/sync v0.19.0
+	golang.org/x/text v0.32.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Переводы сообщений об ошибках по машинному коду. Английский текст —
+// исходный (задаётся в коде вместе с ошибкой и может содержать детали),
+// поэтому здесь только другие языки.
+var errorMessages = map[string]map[string]string{
+	"ru": {
+		"validation":     "некорректные параметры запроса",
+		"cancelled":      "задача отменена администратором",
+		"timeout":        "оптимизатор не уложился в отведённое время; укажите больший timeout (не больше PROCESSING_TIMEOUT сервера)",
+		"schema":         "результат оптимизатора не соответствует ожидаемой схеме",
+		"queue_deadline": "срок запроса истёк в очереди; оптимизатор не запускался",
+	},
+}
+
+var supportedLanguages = []string{"en", "ru"}
+
+// preferredLanguage выбирает язык из Accept-Language (en или ru) с учётом
+// q-значений; по умолчанию en.
+func preferredLanguage(r *http.Request) string {
+	best, bestQ := "en", 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		weight := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				weight = f
+			}
+		}
+		for _, l := range supportedLanguages {
+			if l == lang && weight > bestQ {
+				best, bestQ = l, weight
+			}
+		}
+	}
+	return best
+}
+
+// localize возвращает сообщение для кода на языке клиента или исходный текст.
+func localize(r *http.Request, code, fallback string) string {
+	if msg, ok := errorMessages[preferredLanguage(r)][code]; ok {
+		return msg
+	}
+	return fallback
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestPreferredLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"ru", "ru"},
+		{"ru-RU,ru;q=0.9", "ru"},
+		{"de-DE, ru;q=0.5", "ru"},
+		{"ru;q=0.3, en;q=0.8", "en"},
+		{"en-US,en;q=0.9,ru;q=0.8", "en"},
+		{"fr, de", "en"},
+		{"RU;q=bad", "ru"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Language", tt.header)
+			if got := preferredLanguage(r); got != tt.want {
+				t.Errorf("preferredLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalizedValidationError(t *testing.T) {
+	form := url.Values{"p_layers": {"x"}}
+	for lang, want := range map[string]string{
+		"ru": errorMessages["ru"]["validation"],
+		"en": "invalid parameters",
+	} {
+		rec := postProcess(t, form, "in.csv", "a\n1\n", http.Header{"Accept-Language": {lang}})
+		e := decodeBody(t, rec, http.StatusBadRequest)["error"].(map[string]any)
+		if e["code"] != "validation" || e["message"] != want {
+			t.Errorf("%s: error = %v, want message %q", lang, e, want)
+		}
+		// Детали по полям не переводятся.
+		if _, ok := e["fields"].(map[string]any)["p_layers"]; !ok {
+			t.Errorf("%s: fields = %v", lang, e["fields"])
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// inferSampleRows — сколько строк данных просматривается для вывода типов.
+const inferSampleRows = 200
+
+// columnType — выведенный тип колонки. Mixed — в колонке встретились
+// значения разных типов (int и float при этом считаются float).
+type columnType struct {
+	Name  string   `json:"name"`
+	Type  string   `json:"type"`
+	Mixed bool     `json:"mixed,omitempty"`
+	Seen  []string `json:"seen_types,omitempty"`
+	Empty int      `json:"empty,omitempty"`
+}
+
+type schemaInferrer struct {
+	rows  int
+	seen  []map[string]int
+	empty []int
+}
+
+func (s *schemaInferrer) observe(row []string) {
+	if s.rows >= inferSampleRows {
+		return
+	}
+	s.rows++
+	for len(s.seen) < len(row) {
+		s.seen = append(s.seen, map[string]int{})
+		s.empty = append(s.empty, 0)
+	}
+	for i, v := range row {
+		if t := valueType(v); t == "" {
+			s.empty[i]++
+		} else {
+			s.seen[i][t]++
+		}
+	}
+}
+
+func (s *schemaInferrer) result(header []string) []columnType {
+	out := make([]columnType, len(header))
+	for i, name := range header {
+		ct := columnType{Name: name, Type: "string"}
+		if i < len(s.seen) {
+			ct.Empty = s.empty[i]
+			types := make([]string, 0, len(s.seen[i]))
+			for t := range s.seen[i] {
+				types = append(types, t)
+			}
+			sort.Strings(types)
+			switch {
+			case len(types) == 0:
+				ct.Type = "empty"
+			case len(types) == 1:
+				ct.Type = types[0]
+			case len(types) == 2 && s.seen[i]["int"] > 0 && s.seen[i]["float"] > 0:
+				ct.Type = "float"
+			default:
+				ct.Mixed = true
+				ct.Seen = types
+			}
+		}
+		out[i] = ct
+	}
+	return out
+}
+
+func valueType(v string) string {
+	v = strings.TrimSpace(v)
+	switch {
+	case v == "":
+		return ""
+	case isInt(v):
+		return "int"
+	case isFloat(v):
+		return "float"
+	case isBool(v):
+		return "bool"
+	}
+	return "string"
+}
+
+func isInt(v string) bool {
+	_, err := strconv.ParseInt(v, 10, 64)
+	return err == nil
+}
+
+func isFloat(v string) bool {
+	_, err := strconv.ParseFloat(v, 64)
+	return err == nil
+}
+
+func isBool(v string) bool {
+	switch strings.ToLower(v) {
+	case "true", "false":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInferSchema(t *testing.T) {
+	var s schemaInferrer
+	for _, row := range [][]string{
+		{"1", "1.5", "true", "x", "", "1"},
+		{"2", "2", "FALSE", "y", " ", "a"},
+		{"3", "", "true", "z", "", "2.5"},
+	} {
+		s.observe(row)
+	}
+	got := s.result([]string{"id", "cost", "flag", "name", "blank", "mixed", "extra"})
+	want := []columnType{
+		{Name: "id", Type: "int"},
+		{Name: "cost", Type: "float", Empty: 1},
+		{Name: "flag", Type: "bool"},
+		{Name: "name", Type: "string"},
+		{Name: "blank", Type: "empty", Empty: 3},
+		{Name: "mixed", Type: "string", Mixed: true, Seen: []string{"float", "int", "string"}},
+		{Name: "extra", Type: "string"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("schema =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestInferSchemaSampleBound(t *testing.T) {
+	var s schemaInferrer
+	for range inferSampleRows {
+		s.observe([]string{"1"})
+	}
+	// Строки за пределами выборки на тип не влияют.
+	s.observe([]string{"text"})
+	if got := s.result([]string{"n"}); got[0].Type != "int" || got[0].Mixed {
+		t.Errorf("type after sample = %+v, want int", got[0])
+	}
+}
+
+func TestValidateCSVInferredSchema(t *testing.T) {
+	rep := validateCSV(strings.NewReader("graph_index,graph_matrix,routes_start_end\n1,\"[[0,1],[1,0]]\",\"[0,1]\"\n"))
+	want := []columnType{{Name: "graph_index", Type: "int"}, {Name: "graph_matrix", Type: "string"}, {Name: "routes_start_end", Type: "string"}}
+	if !reflect.DeepEqual(rep.InferredSchema, want) {
+		t.Errorf("inferred_schema = %+v, want %+v", rep.InferredSchema, want)
+	}
+}
+
+func TestInferredSchemaInResponse(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	got := decodeBody(t, postProcess(t, nil, "in.csv", "route,cost\n1,2.5\n2,x\n", nil), http.StatusOK)
+	schema, _ := got["inferred_schema"].([]any)
+	if len(schema) != 2 {
+		t.Fatalf("inferred_schema = %v", got["inferred_schema"])
+	}
+	if c := schema[1].(map[string]any); c["name"] != "cost" || c["mixed"] != true {
+		t.Errorf("cost column = %v, want mixed", c)
+	}
+}
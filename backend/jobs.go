@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jobRecord — метаданные одного запуска оптимизатора.
+type jobRecord struct {
+	ID         string            `json:"id"`
+	Tenant     string            `json:"-"`
+	State      string            `json:"state"`
+	Command    []string          `json:"command"`
+	Source     *jobSource        `json:"source,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Downloads  map[string]string `json:"downloads,omitempty"`
+	// Metrics — числовые показатели результата для /compare.
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	// Convergence пополняется по строкам прогресса runner.py во время работы.
+	Convergence []convergencePoint `json:"convergence,omitempty"`
+	// ETASeconds и EstimatedCompletion — оценка оставшегося времени по
+	// темпу итераций (см. convergenceTracker); null, пока не прошла ни одна
+	// итерация, и после завершения задачи.
+	ETASeconds          *float64   `json:"eta_seconds"`
+	EstimatedCompletion *time.Time `json:"estimated_completion"`
+
+	cancel context.CancelCauseFunc
+	// requestID — X-Request-ID запроса, создавшего задачу (для алертов).
+	requestID string
+	// summary — блок "summary" из вывода runner.py для /summary; в
+	// /status и /jobs не отдаётся, чтобы не раздувать списки.
+	summary any
+	// output — сырой вывод runner.py без редактирования; только для
+	// /admin/job-output, в публичные ответы не попадает.
+	output *jobOutput
+}
+
+// jobOutput — захваченные stdout/stderr runner.py, обрезанные до
+// JOB_OUTPUT_MAX_BYTES каждый.
+type jobOutput struct {
+	Stdout          []byte
+	StdoutBytes     int64
+	StdoutTruncated bool
+	Stderr          []byte
+	StderrBytes     int64
+	StderrTruncated bool
+}
+
+// jobSource — происхождение входных данных задачи. IP клиента попадает
+// сюда только при INCLUDE_CLIENT_IP=1.
+type jobSource struct {
+	Filename   string    `json:"filename"`
+	Size       int64     `json:"size"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	ClientIP   string    `json:"client_ip,omitempty"`
+}
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// errJobCancelled — причина отмены контекста задачи через /admin/cancel-all.
+var errJobCancelled = errors.New("job cancelled")
+
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs map[string]*jobRecord
+	// pruned — id удалённых из истории задач -> tenant, чтобы /status
+	// отвечал 410, а не 404. Не больше maxPrunedIDs, старые забываются.
+	pruned map[string]string
+}
+
+const maxPrunedIDs = 10000
+
+var jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+
+// Start регистрирует задачу в состоянии queued; cancel позволяет прервать
+// её извне (очередь или работающий процесс).
+func (reg *jobRegistry) Start(job *jobRecord, cancel context.CancelCauseFunc) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	job.State = jobQueued
+	job.CreatedAt = time.Now()
+	job.cancel = cancel
+	reg.jobs[job.ID] = job
+}
+
+func (reg *jobRegistry) Running(id string) {
+	reg.Update(id, func(job *jobRecord) { job.State = jobRunning })
+}
+
+func (reg *jobRegistry) Update(id string, fn func(*jobRecord)) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if job, ok := reg.jobs[id]; ok {
+		fn(job)
+	}
+}
+
+func (reg *jobRegistry) Finish(id string, downloads map[string]string) {
+	reg.Update(id, func(job *jobRecord) {
+		job.end(jobDone)
+		job.Downloads = downloads
+	})
+}
+
+func (reg *jobRegistry) Cancelled(id string) {
+	reg.Update(id, func(job *jobRecord) {
+		job.end(jobCancelled)
+		job.Error = errJobCancelled.Error()
+	})
+}
+
+// end переводит задачу в конечное состояние; оценка ETA больше не нужна.
+func (job *jobRecord) end(state string) {
+	now := time.Now()
+	job.State = state
+	job.FinishedAt = &now
+	job.ETASeconds, job.EstimatedCompletion = nil, nil
+}
+
+// Cancel отменяет одну незавершённую задачу арендатора (команда cancel
+// в /ws). false — задачи нет, она уже завершена или её нечем прервать.
+func (reg *jobRegistry) Cancel(id, tenant string) bool {
+	reg.mu.Lock()
+	job, ok := reg.jobs[id]
+	if !ok || job.Tenant != tenant || job.cancel == nil || (job.State != jobQueued && job.State != jobRunning) {
+		reg.mu.Unlock()
+		return false
+	}
+	cancel := job.cancel
+	reg.mu.Unlock()
+	cancel(errJobCancelled)
+	return true
+}
+
+// CancelAll отменяет все незавершённые задачи. Снимок берётся под
+// блокировкой, а сами cancel вызываются уже без неё.
+func (reg *jobRegistry) CancelAll() (cancelled, dequeued int) {
+	reg.mu.Lock()
+	var cancels []context.CancelCauseFunc
+	for _, job := range reg.jobs {
+		switch job.State {
+		case jobRunning:
+			cancelled++
+		case jobQueued:
+			dequeued++
+		default:
+			continue
+		}
+		if job.cancel != nil {
+			cancels = append(cancels, job.cancel)
+		}
+	}
+	reg.mu.Unlock()
+
+	for _, cancel := range cancels {
+		cancel(errJobCancelled)
+	}
+	return cancelled, dequeued
+}
+
+// Fail помечает задачу упавшей и шлёт алерт на FAILURE_WEBHOOK.
+func (reg *jobRegistry) Fail(id, reason string) {
+	reg.Update(id, func(job *jobRecord) {
+		job.end(jobFailed)
+		job.Error = reason
+	})
+	if job, ok := reg.Lookup(id); ok {
+		alertFailure(job)
+	}
+}
+
+// Prune удаляет из истории завершённые задачи: закончившиеся раньше ttl
+// назад и самые старые сверх maxHistory. Очередь и работающие задачи не
+// трогаются; файлы результатов остаются в store. ttl, maxHistory <= 0 —
+// без соответствующего ограничения.
+func (reg *jobRegistry) Prune(now time.Time, maxHistory int, ttl time.Duration) int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	var finished []*jobRecord
+	for _, job := range reg.jobs {
+		if job.FinishedAt != nil {
+			finished = append(finished, job)
+		}
+	}
+	// От новых к старым: id сортируются хронологически (см. genID).
+	sort.Slice(finished, func(i, j int) bool { return finished[i].ID > finished[j].ID })
+	n := 0
+	for i, job := range finished {
+		if (maxHistory > 0 && i >= maxHistory) || (ttl > 0 && now.Sub(*job.FinishedAt) > ttl) {
+			delete(reg.jobs, job.ID)
+			reg.pruned[job.ID] = job.Tenant
+			n++
+		}
+	}
+	reg.trimPruned()
+	return n
+}
+
+// Clear удаляет из истории все завершённые задачи (POST /admin/flush?jobs=1);
+// как и после Prune, /status отвечает для них 410.
+func (reg *jobRegistry) Clear() int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	n := 0
+	for id, job := range reg.jobs {
+		if job.FinishedAt != nil {
+			delete(reg.jobs, id)
+			reg.pruned[id] = job.Tenant
+			n++
+		}
+	}
+	reg.trimPruned()
+	return n
+}
+
+// trimPruned забывает самые старые удалённые id сверх maxPrunedIDs.
+// Вызывать под reg.mu.
+func (reg *jobRegistry) trimPruned() {
+	if extra := len(reg.pruned) - maxPrunedIDs; extra > 0 {
+		ids := make([]string, 0, len(reg.pruned))
+		for id := range reg.pruned {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids[:extra] {
+			delete(reg.pruned, id)
+		}
+	}
+}
+
+// Pruned сообщает, была ли задача арендатора удалена из истории.
+func (reg *jobRegistry) Pruned(id, tenant string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	t, ok := reg.pruned[id]
+	return ok && t == tenant
+}
+
+// Get возвращает копию записи, чтобы её можно было сериализовать без блокировки.
+// Чужие задачи неотличимы от несуществующих.
+func (reg *jobRegistry) Get(id, tenant string) (jobRecord, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	job, ok := reg.jobs[id]
+	if !ok || job.Tenant != tenant {
+		return jobRecord{}, false
+	}
+	return *job, true
+}
+
+// Lookup возвращает задачу любого арендатора — только для админских ручек.
+func (reg *jobRegistry) Lookup(id string) (jobRecord, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	job, ok := reg.jobs[id]
+	if !ok {
+		return jobRecord{}, false
+	}
+	return *job, true
+}
+
+// List возвращает задачи арендатора, от новых к старым.
+func (reg *jobRegistry) List(tenant string) []jobRecord {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	out := make([]jobRecord, 0, len(reg.jobs))
+	for _, job := range reg.jobs {
+		if job.Tenant == tenant {
+			out = append(out, *job)
+		}
+	}
+	// id сортируются хронологически (см. genID)
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out
+}
+
+// listJobs — GET /jobs; ?label=key=value (можно повторять) оставляет
+// только задачи со всеми указанными метками.
+func listJobs(w http.ResponseWriter, r *http.Request) {
+	want := map[string]string{}
+	for _, v := range r.URL.Query()["label"] {
+		k, val, ok := strings.Cut(v, "=")
+		if !ok || k == "" {
+			http.Error(w, "label filter must be key=value", http.StatusBadRequest)
+			return
+		}
+		want[k] = val
+	}
+	list := jobs.List(tenantOf(r))
+	if len(want) > 0 {
+		list = slices.DeleteFunc(list, func(job jobRecord) bool {
+			for k, v := range want {
+				if got, ok := job.Labels[k]; !ok || got != v {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": list})
+}
+
+func status(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if !statusPolls.Allow(clientIP(r), id) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "polling this job too often, slow down", http.StatusTooManyRequests)
+		return
+	}
+	job, ok := jobs.Get(id, tenantOf(r))
+	if !ok {
+		if jobs.Pruned(id, tenantOf(r)) {
+			http.Error(w, "job is no longer in the history (MAX_JOB_HISTORY / JOB_HISTORY_TTL)", http.StatusGone)
+			return
+		}
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// summary — GET /summary?job=: сводка и метрики завершённой задачи без
+// скачивания CSV. Пока задача в очереди или работает — 425.
+func summary(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("job")
+	job, ok := jobs.Get(id, tenantOf(r))
+	switch {
+	case !ok && jobs.Pruned(id, tenantOf(r)):
+		http.Error(w, "job is no longer in the history (MAX_JOB_HISTORY / JOB_HISTORY_TTL)", http.StatusGone)
+		return
+	case !ok:
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case job.State == jobQueued || job.State == jobRunning:
+		http.Error(w, "not ready: job is "+job.State, http.StatusTooEarly)
+		return
+	case job.State != jobDone:
+		http.Error(w, "job "+job.State+": no summary", http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"job_id":  job.ID,
+		"summary": job.summary,
+		"metrics": job.Metrics,
+	})
+}
+
+var secretArgPattern = regexp.MustCompile(`(?i)(password|secret|token|api[-_]?key)`)
+
+// redactArgs маскирует значения секретных флагов (--mirea-password и т.п.)
+// в обеих формах: "--flag value" и "--flag=value".
+func redactArgs(args []string) []string {
+	out := make([]string, len(args))
+	redactNext := false
+	for i, a := range args {
+		switch {
+		case redactNext:
+			out[i] = "***"
+			redactNext = false
+		case strings.HasPrefix(a, "-") && secretArgPattern.MatchString(a):
+			if flag, _, ok := strings.Cut(a, "="); ok {
+				out[i] = flag + "=***"
+			} else {
+				out[i] = a
+				redactNext = true
+			}
+		default:
+			out[i] = a
+		}
+	}
+	return out
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		in, want []string
+	}{
+		{[]string{"python3", "runner.py", "--iterations", "15"}, []string{"python3", "runner.py", "--iterations", "15"}},
+		{[]string{"--mirea-password", "hunter2", "--mirea-shots", "8"}, []string{"--mirea-password", "***", "--mirea-shots", "8"}},
+		{[]string{"--api-key=abc", "--token", "t", "--x"}, []string{"--api-key=***", "--token", "***", "--x"}},
+		{[]string{"--mirea-email", "a@b", "password"}, []string{"--mirea-email", "a@b", "password"}},
+		{[]string{"--SECRET"}, []string{"--SECRET"}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.in, " "), func(t *testing.T) {
+			if got := redactArgs(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactArgs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusCommand(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	t.Setenv("MIREA_EMAIL", "user@example.com")
+	t.Setenv("MIREA_PASSWORD", "hunter2")
+	got := decodeBody(t, postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil), http.StatusOK)
+	id := got["job_id"].(string)
+
+	// runner.py получает настоящий пароль, /status — только маску.
+	var argv []string
+	for _, a := range got["summary"].(map[string]any)["argv"].([]any) {
+		argv = append(argv, a.(string))
+	}
+	if !slices.Contains(argv, "hunter2") {
+		t.Fatalf("runner argv %q lacks the password", argv)
+	}
+	rec := httptest.NewRecorder()
+	status(rec, httptest.NewRequest(http.MethodGet, "/status?id="+id, nil))
+	var job struct{ Command []string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatalf("status: %v (%s)", err, rec.Body)
+	}
+	if len(job.Command) != len(argv)+2 || job.Command[0] != "python3" {
+		t.Errorf("command = %q, want python3 + runner + %d args", job.Command, len(argv))
+	}
+	if strings.Contains(rec.Body.String(), "hunter2") || !slices.Contains(job.Command, "***") {
+		t.Errorf("status does not redact the password: %q", job.Command)
+	}
+	if !slices.Contains(job.Command, "--csv-file") || !slices.Contains(job.Command, "user@example.com") {
+		t.Errorf("command = %q, want the full argv", job.Command)
+	}
+}
+
+func TestTenantScoping(t *testing.T) {
+	defer func(s *resultStore, j *jobRegistry, m *missLimiter) { store, jobs, downloadMiss = s, j, m }(store, jobs, downloadMiss)
+	store = newResultStore(10)
+	jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+	downloadMiss = newMissLimiter(100, time.Minute, time.Minute)
+	fakeRunner(t, echoRunner)
+
+	got := decodeBody(t, postProcess(t, nil, "in.csv", "a,b\n1,2\n", http.Header{"X-Tenant": {"team-a"}}), http.StatusOK)
+	id := got["job_id"].(string)
+	file := got["downloads"].(map[string]any)["classic_csv"].(string)
+
+	get := func(handler http.HandlerFunc, target, tenant string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+	tests := []struct {
+		tenant string
+		want   int
+	}{
+		{"team-a", http.StatusOK},
+		{" team-a ", http.StatusOK},
+		{"team-b", http.StatusNotFound},
+		{"", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tenant, func(t *testing.T) {
+			if code := get(download, "/download?id="+file, tt.tenant); code != tt.want {
+				t.Errorf("download: %d, want %d", code, tt.want)
+			}
+			if code := get(status, "/status?id="+id, tt.tenant); code != tt.want {
+				t.Errorf("status: %d, want %d", code, tt.want)
+			}
+			if code := get(manifest, "/manifest?job="+id, tt.tenant); code != tt.want {
+				t.Errorf("manifest: %d, want %d", code, tt.want)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+			req.Header.Set("X-Tenant", tt.tenant)
+			rec := httptest.NewRecorder()
+			listJobs(rec, req)
+			n := len(decodeBody(t, rec, http.StatusOK)["jobs"].([]any))
+			if want := map[bool]int{true: 1, false: 0}[tt.want == http.StatusOK]; n != want {
+				t.Errorf("/jobs lists %d jobs, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestUploadSource(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	for _, includeIP := range []string{"", "1"} {
+		t.Run("INCLUDE_CLIENT_IP="+includeIP, func(t *testing.T) {
+			t.Setenv("INCLUDE_CLIENT_IP", includeIP)
+			before := time.Now().Add(-time.Second)
+			got := decodeBody(t, postProcess(t, nil, "routes.csv", "a,b\n1,2\n", nil), http.StatusOK)
+
+			rec := httptest.NewRecorder()
+			status(rec, httptest.NewRequest(http.MethodGet, "/status?id="+got["job_id"].(string), nil))
+			job := decodeBody(t, rec, http.StatusOK)
+			for name, src := range map[string]any{"response": got["source"], "status": job["source"]} {
+				s, _ := src.(map[string]any)
+				at, _ := time.Parse(time.RFC3339Nano, fmt.Sprint(s["uploaded_at"]))
+				if s["filename"] != "routes.csv" || s["size"] != float64(8) || at.Before(before) || at.After(time.Now()) {
+					t.Errorf("%s source = %v", name, src)
+				}
+				// httptest.NewRequest ставит RemoteAddr 192.0.2.1:1234.
+				if wantIP := includeIP == "1"; (s["client_ip"] == "192.0.2.1") != wantIP {
+					t.Errorf("%s client_ip = %v, want present=%v", name, s["client_ip"], wantIP)
+				}
+			}
+		})
+	}
+}
+
+func TestGenIDSortable(t *testing.T) {
+	prev := ""
+	for range 1000 {
+		id := genID()
+		if len(id) != 24 || !downloadIDRe.MatchString(id) {
+			t.Fatalf("malformed id %q", id)
+		}
+		if id <= prev {
+			t.Fatalf("id %q not after %q", id, prev)
+		}
+		prev = id
+	}
+}
+
+func TestJobListOrder(t *testing.T) {
+	reg := &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+	created := time.Now()
+	var ids []string
+	for range 5 {
+		// Одинаковое время создания — порядок всё равно задаёт id.
+		id := genID()
+		ids = append(ids, id)
+		reg.Start(&jobRecord{ID: id, CreatedAt: created}, nil)
+	}
+	list := reg.List("")
+	if len(list) != len(ids) {
+		t.Fatalf("listed %d jobs, want %d", len(list), len(ids))
+	}
+	for i, job := range list {
+		if want := ids[len(ids)-1-i]; job.ID != want {
+			t.Errorf("list[%d] = %s, want %s (newest first)", i, job.ID, want)
+		}
+	}
+}
+
+// waitJobState ждёт, пока задача id перейдёт в состояние state.
+func waitJobState(t *testing.T, id, state string) jobRecord {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		job, ok := jobs.Lookup(id)
+		if ok && job.State == state {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s: state %q, want %q", id, job.State, state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAsyncProcess(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	rec := postProcess(t, url.Values{"sync": {"false"}}, "in.csv", "a\n1\n", nil)
+	got := decodeBody(t, rec, http.StatusAccepted)
+	id := got["job_id"].(string)
+	if got["status_url"] != "/status?id="+id {
+		t.Errorf("status_url = %v", got["status_url"])
+	}
+	job := waitJobState(t, id, jobDone)
+	stored, ok := store.Peek(job.Downloads["classic_csv"])
+	if !ok || string(stored.Data) != "a\n1\n" {
+		t.Errorf("async result %q", stored.Data)
+	}
+
+	t.Setenv("ASYNC_BY_DEFAULT", "1")
+	rec = postProcess(t, nil, "in.csv", "a\n1\n", nil)
+	waitJobState(t, decodeBody(t, rec, http.StatusAccepted)["job_id"].(string), jobDone)
+	if rec := postProcess(t, url.Values{"sync": {"true"}}, "in.csv", "a\n1\n", nil); rec.Code != http.StatusOK {
+		t.Errorf("sync=true with ASYNC_BY_DEFAULT: status %d", rec.Code)
+	}
+}
+
+// Асинхронную задачу можно отменить сразу после 202, пока она ещё в очереди.
+func TestAsyncCancelWhileQueued(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	for range cap(runSlots) {
+		runSlots <- struct{}{}
+	}
+	released := false
+	release := func() {
+		if !released {
+			released = true
+			for range cap(runSlots) {
+				<-runSlots
+			}
+		}
+	}
+	defer release()
+
+	rec := postProcess(t, url.Values{"sync": {"false"}}, "in.csv", "a\n1\n", nil)
+	id := decodeBody(t, rec, http.StatusAccepted)["job_id"].(string)
+	if !jobs.Cancel(id, "") {
+		t.Fatal("queued async job cannot be cancelled")
+	}
+	job := waitJobState(t, id, jobCancelled)
+	release()
+	if len(job.Downloads) != 0 {
+		t.Errorf("cancelled job has downloads %v", job.Downloads)
+	}
+}
+
+func TestJobHistoryPrune(t *testing.T) {
+	defer func(j *jobRegistry) { jobs = j }(jobs)
+	jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+	now := time.Now()
+	var ids []string
+	for i := range 4 {
+		id := genID()
+		ids = append(ids, id)
+		jobs.Start(&jobRecord{ID: id, Tenant: "team-a"}, nil)
+		finished := now.Add(time.Duration(i-4) * time.Hour)
+		jobs.Update(id, func(job *jobRecord) { job.State, job.FinishedAt = jobDone, &finished })
+	}
+	running := genID()
+	jobs.Start(&jobRecord{ID: running, Tenant: "team-a"}, nil)
+
+	// Старше 150 минут — ids[0] (4 ч) и ids[1] (3 ч).
+	if n := jobs.Prune(now, 0, 150*time.Minute); n != 2 {
+		t.Errorf("ttl pruned %d, want 2", n)
+	}
+	// Из оставшихся двух завершённых хранится одна, самая новая.
+	if n := jobs.Prune(now, 1, 0); n != 1 {
+		t.Errorf("max history pruned %d, want 1", n)
+	}
+	for i, id := range ids {
+		_, kept := jobs.Lookup(id)
+		if kept != (i == 3) {
+			t.Errorf("job %d kept = %v", i, kept)
+		}
+	}
+	if _, ok := jobs.Lookup(running); !ok {
+		t.Error("running job pruned")
+	}
+
+	// /status отличает удалённую задачу (410) от неизвестной (404).
+	for id, want := range map[string]int{ids[0]: http.StatusGone, genID(): http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/status?id="+id, nil)
+		req.Header.Set("X-Tenant", "team-a")
+		rec := httptest.NewRecorder()
+		status(rec, req)
+		if rec.Code != want {
+			t.Errorf("status of %s: %d, want %d", id, rec.Code, want)
+		}
+	}
+	if jobs.Pruned(ids[0], "team-b") {
+		t.Error("pruned job visible to another tenant")
+	}
+}
+
+func TestListJobsByLabel(t *testing.T) {
+	defer func(j *jobRegistry) { jobs = j }(jobs)
+	jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+	prod, stage := genID(), genID()
+	jobs.Start(&jobRecord{ID: prod, Labels: map[string]string{"team": "ops", "env": "prod"}}, nil)
+	jobs.Start(&jobRecord{ID: stage, Labels: map[string]string{"team": "ops", "env": "stage"}}, nil)
+	jobs.Start(&jobRecord{ID: genID()}, nil)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"label=team=ops", []string{stage, prod}},
+		{"label=team=ops&label=env=prod", []string{prod}},
+		{"label=env=", nil},
+		{"label=team=dev", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			listJobs(rec, httptest.NewRequest(http.MethodGet, "/jobs?"+tt.query, nil))
+			var got struct{ Jobs []jobRecord }
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%v (%s)", err, rec.Body)
+			}
+			var ids []string
+			for _, job := range got.Jobs {
+				ids = append(ids, job.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("jobs = %q, want %q", ids, tt.want)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	listJobs(rec, httptest.NewRequest(http.MethodGet, "/jobs?label=team", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed filter: status %d, want 400", rec.Code)
+	}
+}
+
+func TestJobSummary(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	got := decodeBody(t, postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil), http.StatusOK)
+	id := got["job_id"].(string)
+	get := func(id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		summary(rec, httptest.NewRequest(http.MethodGet, "/summary?job="+id, nil))
+		return rec
+	}
+
+	body := decodeBody(t, get(id), http.StatusOK)
+	if body["job_id"] != id || body["summary"].(map[string]any)["final_cost_total"] != 10.0 {
+		t.Errorf("summary = %v", body)
+	}
+	if metrics, _ := body["metrics"].(map[string]any); metrics["final_cost_total"] != 10.0 {
+		t.Errorf("metrics = %v", body["metrics"])
+	}
+	// В /status сводки нет.
+	rec := httptest.NewRecorder()
+	status(rec, httptest.NewRequest(http.MethodGet, "/status?id="+id, nil))
+	if strings.Contains(rec.Body.String(), `"summary"`) {
+		t.Errorf("status exposes the summary: %s", rec.Body)
+	}
+
+	queued, failed := genID(), genID()
+	jobs.Start(&jobRecord{ID: queued}, nil)
+	jobs.Start(&jobRecord{ID: failed}, nil)
+	jobs.Fail(failed, "boom")
+	for id, want := range map[string]int{queued: http.StatusTooEarly, failed: http.StatusConflict, genID(): http.StatusNotFound} {
+		if rec := get(id); rec.Code != want {
+			t.Errorf("summary of %s: %d, want %d", id, rec.Code, want)
+		}
+	}
+}
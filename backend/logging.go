@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type requestIDKey struct{}
+
+// setupLogging настраивает slog по LOG_LEVEL (debug/info/warn/error).
+func setupLogging() {
+	var level slog.Level
+	switch strings.ToLower(getenv("LOG_LEVEL", "info")) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		level = slog.LevelInfo
+	}
+	var out io.Writer = os.Stderr
+	// LOG_FILE дублирует вывод в файл с ротацией по LOG_MAX_SIZE_MB.
+	if path := getenv("LOG_FILE", ""); path != "" {
+		rf, err := openRotatingFile(path, int64(getenvInt("LOG_MAX_SIZE_MB", 100))<<20, getenvInt("LOG_MAX_BACKUPS", 5))
+		if err != nil {
+			log.Fatalf("LOG_FILE: %v", err)
+		}
+		out = io.MultiWriter(os.Stderr, rf)
+	}
+	installLogging(out, level)
+}
+
+// installLogging ставит slog-обработчик с порогом level. Вызовы log.Printf
+// пишутся в тот же вывод и формат, но мимо порога: среди них и ошибки
+// запуска, и сбои задач, и при LOG_LEVEL=warn они не должны пропадать.
+func installLogging(out io.Writer, level slog.Level) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: level})))
+	std := slog.NewLogLogger(slog.NewTextHandler(out, nil), slog.LevelInfo)
+	log.SetOutput(std.Writer())
+	log.SetFlags(0)
+}
+
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// accessLog пишет одну строку на запрос и пробрасывает X-Request-ID
+// (берёт клиентский или генерирует новый) в контекст и ответ.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		slog.Info("access",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"request_id", id,
+		)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter { return s.ResponseWriter }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLogs ставит installLogging с буфером и возвращает прежние настройки
+// логгеров после теста.
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	prev, prevOut, prevFlags := slog.Default(), log.Writer(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(prev)
+		log.SetOutput(prevOut)
+		log.SetFlags(prevFlags)
+	})
+	var buf bytes.Buffer
+	installLogging(&buf, level)
+	return &buf
+}
+
+func TestLogLevelKeepsStdLog(t *testing.T) {
+	buf := captureLogs(t, slog.LevelWarn)
+	log.Printf("Async job %s failed: %v", "j1", "boom")
+	slog.Info("access", "path", "/health")
+	slog.Debug("runner invocation")
+	slog.Warn("disk almost full")
+
+	out := buf.String()
+	if !strings.Contains(out, "Async job j1 failed: boom") {
+		t.Errorf("log.Printf dropped at LOG_LEVEL=warn:\n%s", out)
+	}
+	if strings.Contains(out, "access") || strings.Contains(out, "runner invocation") {
+		t.Errorf("records below warn were written:\n%s", out)
+	}
+	if !strings.Contains(out, "level=WARN") || !strings.Contains(out, "disk almost full") {
+		t.Errorf("warn record missing:\n%s", out)
+	}
+}
+
+func TestAccessLogRequestID(t *testing.T) {
+	buf := captureLogs(t, slog.LevelInfo)
+	var seen string
+	h := accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("X-Request-ID", "client-42")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if seen != "client-42" || rec.Header().Get("X-Request-ID") != "client-42" {
+		t.Errorf("request id in context %q, header %q, want client-42", seen, rec.Header().Get("X-Request-ID"))
+	}
+	for _, want := range []string{"path=/status", "status=418", "bytes=5", "request_id=client-42"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("access log missing %s:\n%s", want, buf.String())
+		}
+	}
+
+	// Слишком длинный клиентский id заменяется сгенерированным.
+	req = httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("X-Request-ID", strings.Repeat("x", 200))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if id := rec.Header().Get("X-Request-ID"); len(id) != 16 || seen != id {
+		t.Errorf("generated request id %q (context %q), want 16 hex chars", id, seen)
+	}
+}
+
+func TestRequestIDReachesRunner(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "in.csv")
+	io.WriteString(fw, "a,b\n1,2\n")
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/process", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-Request-ID", "req-154")
+	rec := httptest.NewRecorder()
+	accessLog(http.HandlerFunc(process)).ServeHTTP(rec, req)
+
+	got := decodeBody(t, rec, http.StatusOK)
+	env := got["summary"].(map[string]any)["env"].(map[string]any)
+	if env["REQUEST_ID"] != "req-154" || env["JOB_ID"] != got["job_id"] {
+		t.Errorf("runner saw REQUEST_ID=%v JOB_ID=%v, want req-154 and %v", env["REQUEST_ID"], env["JOB_ID"], got["job_id"])
+	}
+}
@@ -2,65 +2,184 @@ package main
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"sync"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
-type csvRecord struct {
-	Name string
-	Data []byte
-}
+// multipartMemory — сколько формы держится в памяти при разборе multipart.
+// Форма читается целиком до построения аргументов runner.py, поэтому поля
+// доступны в любом порядке относительно файла. Текстовые поля всегда в
+// памяти (net/http ограничивает их ещё 10 МБ сверх этого значения),
+// файл сверх остатка лимита уходит во временный файл на диске.
+const multipartMemory = 64 << 20
+
+// Лимиты хранилища и ограничителей задаёт applyLimits.
+var (
+	store        = newResultStore(0)
+	downloadMiss = newMissLimiter(0, 0, 0)
+	// downloadSlots — одновременные скачивания на IP (DOWNLOAD_MAX_PER_IP).
+	downloadSlots = newIPSlots(0)
+	// statusPolls — частота опросов /status одной задачи с одного IP.
+	statusPolls  = newPollLimiter(0, 1)
+	downloadIDRe = regexp.MustCompile(`^[0-9a-f]{24}$`)
+)
 
-var store sync.Map
+// getenv читает текущее значение настройки из окружения или CONFIG_FILE
+// (см. lookupConfig). Код задачи читает настройки из её снимка (settings).
+func getenv(k, def string) string { return settings{}.get(k, def) }
 
-func getenv(k, def string) string {
-	if v := os.Getenv(k); v != "" {
-		return v
+// parseDuration принимает как Go-длительность ("90s", "5m"), так и целое число секунд.
+func parseDuration(v string) (time.Duration, error) {
+	if n, err := strconv.Atoi(v); err == nil {
+		return time.Duration(n) * time.Second, nil
 	}
-	return def
+	return time.ParseDuration(v)
 }
 
+func getenvDuration(k string, def time.Duration) time.Duration { return settings{}.getDuration(k, def) }
+
+func getenvInt(k string, def int) int { return settings{}.getInt(k, def) }
+
+func getenvFloat(k string, def float64) float64 { return settings{}.getFloat(k, def) }
+
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	startedAt = time.Now()
+	processFile := flag.String("process", "", "run the optimizer once on this file and exit (no HTTP server)")
+	outDir := flag.String("out", "", "directory for result files in --process mode")
+	form := paramFlags{}
+	flag.Var(form, "param", "solver parameter key=value for --process, as in the /process form (repeatable)")
+	flag.Parse()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		cfg, err := loadConfigFile(path)
+		if err != nil {
+			log.Fatalf("Invalid config file: %v", err)
+		}
+		fileConfig.Store(&cfg)
+		log.Printf("Loaded %d settings from %s", len(cfg), path)
+	}
+	setupLogging()
+	applyLimits()
+	stallTimeout = getenvDuration("STALL_TIMEOUT", 0)
+	killGrace = getenvDuration("KILL_GRACE_PERIOD", 10*time.Second)
+	subprocessNice = getenvInt("SUBPROCESS_NICE", 0)
+	compressStore = getenv("COMPRESS_STORE", "") == "1"
+	var err error
+	if tempDirMode, err = parseFileMode("TEMP_DIR_MODE", tempDirMode, 0o700); err != nil {
+		log.Fatal(err)
+	}
+	if tempFileMode, err = parseFileMode("TEMP_FILE_MODE", tempFileMode, 0o600); err != nil {
+		log.Fatal(err)
+	}
+	if cpuSets, err = parseCPUSets(getenv("CPU_AFFINITY", "")); err != nil {
+		log.Fatalf("CPU_AFFINITY: %v", err)
+	}
+	if filenamePolicy = getenv("FILENAME_POLICY", policyRaw); !validFilenamePolicy(filenamePolicy) {
+		log.Fatalf("FILENAME_POLICY must be raw, strict-ascii or slug, got %q", filenamePolicy)
+	}
+	downloadRate = int64(getenvInt("DOWNLOAD_RATE_BYTES_PER_SEC", 0))
+	runSlots = make(chan struct{}, max(1, getenvInt("MAX_CONCURRENT_RUNS", 2)))
+	if addr := getenv("STATSD_ADDR", ""); addr != "" {
+		sink, err := newStatsdMetrics(addr, getenv("STATSD_PREFIX", "qbit."))
+		if err != nil {
+			log.Fatalf("STATSD_ADDR: %v", err)
+		}
+		stats = sink
+		log.Printf("Sending StatsD metrics to %s", addr)
+	}
+	if *processFile != "" {
+		os.Exit(runOnce(*processFile, *outDir, url.Values(form)))
+	}
+	if dir := getenv("STORE_DIR", ""); dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			log.Fatalf("STORE_DIR: %v", err)
+		}
+		cleanStoreDir(dir)
+		storeDir = dir
+		log.Printf("Storing results on disk in %s", dir)
+	}
+	go expireResults(time.Minute)
+	go reloadOnSIGHUP(os.Getenv("CONFIG_FILE"))
 	mux := http.NewServeMux()
 
 	webDir := getenv("WEB_DIR", "web")
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			path := filepath.Join(webDir, filepath.Clean(r.URL.Path))
-			if _, err := os.Stat(path); err == nil {
-				http.ServeFile(w, r, path)
+			if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+				serveStatic(w, r, path)
 				return
 			}
 		}
-		http.ServeFile(w, r, filepath.Join(webDir, "index.html"))
+		serveStatic(w, r, filepath.Join(webDir, "index.html"))
 	})
 
 	mux.HandleFunc("/process", process)
 	mux.HandleFunc("/download", download)
+	mux.HandleFunc("/download-all", downloadAll)
+	mux.HandleFunc("/validate", validateUpload)
+	mux.HandleFunc("/validate-params", validateParams)
+	mux.HandleFunc("/estimate", estimate)
+	mux.HandleFunc("/status", status)
+	mux.HandleFunc("/ws", jobSocket)
+	mux.HandleFunc("/jobs", listJobs)
+	mux.HandleFunc("/manifest", manifest)
+	mux.HandleFunc("/summary", summary)
+	mux.HandleFunc("/compare", compareJobs)
+	mux.HandleFunc("/preview", previewPage)
+	mux.HandleFunc("/capabilities", capabilities)
+	mux.HandleFunc("/readyz", readyz)
+	mux.HandleFunc("/load", load)
+	mux.HandleFunc("/uptime", uptime)
+	mux.HandleFunc("/admin/drain", requireAdmin(adminDrain))
+	mux.HandleFunc("/admin/undrain", requireAdmin(adminUndrain))
+	mux.HandleFunc("/admin/cancel-all", requireAdmin(adminCancelAll))
+	mux.HandleFunc("/admin/job-output", requireAdmin(adminJobOutput))
+	mux.HandleFunc("/admin/flush", requireAdmin(adminFlush))
+	mux.HandleFunc("/search", requireAdmin(adminSearch))
 
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	handler := accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Tenant, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, HEAD, DELETE")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
+		if r.URL.Query().Get("pretty") == "1" {
+			w = &prettyWriter{ResponseWriter: w}
+		}
+		// Accept: application/msgpack — ответы writeJSON в MessagePack.
+		if prefersMsgpack(r.Header.Get("Accept")) {
+			w = &msgpackWriter{ResponseWriter: w}
+		}
 		mux.ServeHTTP(w, r)
-	})
+	}))
+
+	if getenv("CHAOS", "") == "1" {
+		log.Printf("WARNING: CHAOS=1, /process?fail= injects failures; never enable this in production")
+	}
+	if runnerPath := runnerScript(settings{}); !fileExists(runnerPath) {
+		log.Printf("WARNING: optimizer runner not found at %s, /process will return 503", runnerPath)
+	}
 
 	addr := ":" + getenv("PORT", "9000")
-	log.Printf("Listening on %s (web dir: %s)", addr, webDir)
+	log.Printf("Listening on %s (web dir: %s, max stored results: %d)", addr, webDir, store.max)
 	if err := http.ListenAndServe(addr, handler); err != nil {
 		log.Fatal(err)
 	}
@@ -72,186 +191,428 @@ func process(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if rejectIfDraining(w) {
+		return
+	}
 
-	if err := r.ParseMultipartForm(64 << 20); err != nil {
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
 		http.Error(w, "bad form: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	file, header, err := r.FormFile("file")
+	params, err := parseParams(r)
+	if err != nil {
+		var verr *validationError
+		if errors.As(err, &verr) {
+			writeValidationError(w, r, verr)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fail, err := chaosFailure(r, params.config)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Вход: файл из формы либо source_url, который сервер скачает сам.
+	var (
+		src      io.Reader
+		filename string
+		size     int64 = -1
+	)
+	file, header, err := r.FormFile("file")
+	switch {
+	case err == nil:
+		defer file.Close()
+		src, filename, size = file, header.Filename, header.Size
+	case errors.Is(err, http.ErrMissingFile) && r.FormValue("source_url") != "":
+		body, name, ferr := fetchSource(r.Context(), params.config, r.FormValue("source_url"))
+		if ferr != nil {
+			log.Printf("source_url rejected: %v", ferr)
+			var tooLarge *http.MaxBytesError
+			if errors.As(ferr, &tooLarge) {
+				http.Error(w, ferr.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, ferr.Error(), http.StatusBadRequest)
+			return
+		}
+		defer body.Close()
+		src, filename = body, name
+	default:
 		http.Error(w, "file required: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
+	filename = filepath.Base(filename)
 
-	ext := filepath.Ext(header.Filename)
-	if ext != ".csv" && ext != ".txt" {
-		http.Error(w, "only .csv or .txt files are allowed", http.StatusBadRequest)
+	ext := filepath.Ext(filename)
+	batch := strings.EqualFold(ext, ".zip")
+	if !allowedExtension(ext) && !batch {
+		http.Error(w, "only .csv, .txt or .zip files are allowed", http.StatusBadRequest)
+		return
+	}
+	if batch && (params.Dedupe || len(params.RerouteFractions) > 1 || params.Async) {
+		http.Error(w, "dedupe, reroute_fractions sweeps and async mode are not supported for zip batches", http.StatusBadRequest)
+		return
+	}
+
+	if size == 0 {
+		http.Error(w, "empty file", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Processing file: %s (size: %d bytes)", header.Filename, header.Size)
+	log.Printf("Processing file: %s (size: %d bytes)", filename, size)
 
-	tmpDir, err := os.MkdirTemp("", "upload-*")
+	tmpDir, err := makeTempDir("upload-*")
 	if err != nil {
 		http.Error(w, "temp dir error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer os.RemoveAll(tmpDir)
+	// В асинхронном режиме каталог и контекст передаются горутине задачи.
+	detached := false
+	defer func() {
+		if !detached {
+			os.RemoveAll(tmpDir)
+		}
+	}()
 
-	dstPath := filepath.Join(tmpDir, header.Filename)
-	dst, err := os.Create(dstPath)
+	dstPath := filepath.Join(tmpDir, filename)
+	dst, err := createTempFile(dstPath)
 	if err != nil {
 		http.Error(w, "create file error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if _, err := io.Copy(dst, file); err != nil {
+	counted := &countingReader{r: src}
+	src = counted
+	var dedupe dedupeResult
+	if params.Dedupe {
+		dedupe, err = dedupeRows(src, dst, params.config.getInt("DEDUPE_MAX_ROWS", 1_000_000))
+		if dedupe.Capped {
+			log.Printf("Dedupe set limit reached for %s, remaining rows passed through unchanged", filename)
+		}
+	} else {
+		_, err = io.Copy(dst, src)
+	}
+	if err != nil {
+		_ = dst.Close()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "source too large: "+err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "save file error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 	_ = dst.Close()
+	if size < 0 {
+		size = counted.n
+	}
+	// Размер мог быть неизвестен заранее (source_url) — проверяем по факту.
+	if counted.n == 0 {
+		http.Error(w, "empty file", http.StatusBadRequest)
+		return
+	}
 
-	const requestTimeout = 30 * time.Minute
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
-	defer cancel()
-
-	// Запуск runner.py
-	runnerPath := filepath.Join("py", "runner.py")
-	args := []string{
-		runnerPath,
-		"--csv-file", dstPath,
-		"--iterations", "15",
-		"--reroute-fraction", "0.1",
-		"--max-routes", "999999",
-		"--p-layers", "1",
-		"--workers", "4",
-		"--use-mirea",
-		"--mirea-email", getenv("MIREA_EMAIL", ""),
-		"--mirea-password", getenv("MIREA_PASSWORD", ""),
-		"--mirea-shots", getenv("MIREA_SHOTS", "1024"),
-		"--mirea-samples", "2",
-		"--max-total-mirea-calls", "10",
-	}
-
-	log.Println("Running hybrid optimization...")
-	output, err := runPython(ctx, args)
-	if err != nil {
-		log.Printf("Quantum error: %v", err)
-		log.Printf("Output: %s", truncate(string(output), 1000))
-		http.Error(w, fmt.Sprintf("Python error: %v\n%s", err, string(output)), http.StatusInternalServerError)
+	ctx, cancel := requestContext(start, params)
+	defer func() {
+		if !detached {
+			cancel()
+		}
+	}()
+
+	source := &jobSource{Filename: filename, Size: size, UploadedAt: start}
+	if params.config.get("INCLUDE_CLIENT_IP", "") == "1" {
+		source.ClientIP = clientIP(r)
+	}
+	spec := runSpec{
+		WorkDir:   tmpDir,
+		Params:    params,
+		Effective: newEffectiveParameters(params),
+		Timeout:   params.Timeout,
+		Tenant:    tenantOf(r),
+		RequestID: requestID(r.Context()),
+		Source:    source,
+		Fail:      fail,
+	}
+
+	// Zip-архив: каждый .csv/.txt внутри — отдельный запуск.
+	if batch {
+		root := filepath.Join(tmpDir, "batch")
+		paths, err := extractBatch(dstPath, root, params.config.getInt("BATCH_MAX_FILES", 20), int64(params.config.getInt("BATCH_MAX_BYTES", 256<<20)))
+		if err != nil {
+			log.Printf("Batch archive %s rejected: %v", filename, err)
+			http.Error(w, "bad archive: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		items, ok := runBatch(ctx, spec, root, paths)
+		if !ok {
+			writeRunError(w, r, items[0].err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"ok":         true,
+			"batch":      items,
+			"source":     source,
+			"elapsed_ms": time.Since(start).Milliseconds(),
+			"parameters": spec.Effective,
+		})
 		return
 	}
 
-	// Парсим JSON как map
-	var result map[string]interface{}
-	if err := json.Unmarshal(output, &result); err != nil {
-		log.Printf("Failed to parse python results: %v", err)
-		log.Printf("Output: %s", truncate(string(output), 1000))
-		http.Error(w, "Failed to parse python results", http.StatusInternalServerError)
+	inputPath, err := preprocessInput(ctx, params.config, dstPath, tmpDir)
+	if err != nil {
+		writeRunError(w, r, err)
 		return
 	}
 
-	downloads := map[string]string{}
-
-	// Новый формат: массив файлов [{name, base64}]
-	if filesAny, ok := result["csv_files"].([]any); ok {
-		for _, f := range filesAny {
-			m, _ := f.(map[string]any)
-			name, _ := m["name"].(string)
-			b64, _ := m["base64"].(string)
-			if name != "" && b64 != "" {
-				b, _ := base64.StdEncoding.DecodeString(b64)
-				id := genID()
-				store.Store(id, csvRecord{
-					Name: safeName(name, "file.csv"),
-					Data: b,
-				})
-				// Ключи для фронта
-				switch name {
-				case "classic.csv":
-					downloads["classic_csv"] = id
-					downloads["submission_csv"] = id // обратная совместимость
-				case "quantum.csv":
-					downloads["quantum_csv"] = id
-				default:
-					downloads[name] = id
-				}
-			}
+	var input inputInfo
+	if f, err := os.Open(inputPath); err == nil {
+		input, _ = inspectInput(f)
+		f.Close()
+	}
+
+	spec.InputPath = inputPath
+	annotate := func(result map[string]any) {
+		if !params.Dedupe {
+			return
 		}
-	} else {
-		// Старый формат: одно поле csv_base64/csv_filename
-		csvBase64, _ := result["csv_base64"].(string)
-		csvFilename, _ := result["csv_filename"].(string)
-		if csvBase64 != "" {
-			b, _ := base64.StdEncoding.DecodeString(csvBase64)
-			id := genID()
-			store.Store(id, csvRecord{
-				Name: safeName(csvFilename, "submission.csv"),
-				Data: b,
-			})
-			downloads["submission_csv"] = id
+		summary, _ := result["summary"].(map[string]any)
+		if summary == nil {
+			summary = map[string]any{}
+			result["summary"] = summary
 		}
+		summary["duplicate_rows_removed"] = dedupe.Removed
+		summary["dedupe_capped"] = dedupe.Capped
 	}
-
-	finalResponse := map[string]interface{}{
-		"ok":         result["ok"],
-		"results":    result["results"],
-		"summary":    result["summary"],
-		"elapsed_ms": time.Since(start).Milliseconds(),
-		"downloads":  downloads,
-		"parameters": map[string]interface{}{
-			"solver_iterations": 15,
-			"reroute_fraction":  0.1,
-			"mirea_enabled":     true,
-		},
+	if len(params.RerouteFractions) > 1 {
+		points, ok := sweep(ctx, spec, params.RerouteFractions, annotate)
+		if !ok {
+			writeRunError(w, r, points[0].err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"ok":              true,
+			"sweep":           points,
+			"source":          source,
+			"input_columns":   input.Columns,
+			"header_detected": input.HeaderDetected,
+			"inferred_schema": input.Schema,
+			"elapsed_ms":      time.Since(start).Milliseconds(),
+			"parameters":      spec.Effective,
+		})
+		return
 	}
-	writeJSON(w, http.StatusOK, finalResponse)
-}
 
-func download(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	v, ok := store.Load(id)
-	if !ok {
-		http.Error(w, "not found", http.StatusNotFound)
+	if params.Async {
+		detached = true
+		spec.JobID = genID()
+		// Задача видна в /status сразу, ещё до того как горутина дойдёт
+		// до optimize (он перерегистрирует её с тем же id), и её уже
+		// можно отменить.
+		ctx, cancelJob := context.WithCancelCause(ctx)
+		jobs.Start(&jobRecord{ID: spec.JobID, Tenant: spec.Tenant, Source: source, Labels: params.Labels, requestID: spec.RequestID}, cancelJob)
+		go runDetached(ctx, func() { cancelJob(nil); cancel() }, tmpDir, spec)
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"ok":         true,
+			"job_id":     spec.JobID,
+			"status_url": "/status?id=" + spec.JobID,
+			"source":     source,
+			"parameters": spec.Effective,
+		})
 		return
 	}
-	rec := v.(csvRecord)
-	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
-	w.Header().Set("Content-Disposition", `attachment; filename="`+rec.Name+`"`)
-	w.WriteHeader(http.StatusOK)
-	w.Write(rec.Data)
-}
 
-func runPython(ctx context.Context, args []string) ([]byte, error) {
-	cmd := exec.CommandContext(ctx, "python3", args...)
-	cmd.Env = os.Environ()
-	stdout, err := cmd.StdoutPipe()
+	var (
+		out      runOutcome
+		decision *quantumDecision
+	)
+	if params.QuantumTarget != nil {
+		out, decision, err = optimizeConditional(ctx, spec)
+	} else {
+		out, err = optimize(ctx, spec)
+	}
 	if err != nil {
-		return nil, err
+		writeRunError(w, r, err)
+		return
 	}
-	if err := cmd.Start(); err != nil {
-		return nil, err
+	result := out.Result
+	annotate(result)
+
+	finalResponse := map[string]interface{}{
+		"ok":              result["ok"],
+		"job_id":          out.JobID,
+		"results":         result["results"],
+		"summary":         result["summary"],
+		"elapsed_ms":      time.Since(start).Milliseconds(),
+		"downloads":       out.Downloads,
+		"source":          source,
+		"parameters":      spec.Effective,
+		"input_columns":   input.Columns,
+		"header_detected": input.HeaderDetected,
+		"inferred_schema": input.Schema,
 	}
-	output, err := io.ReadAll(stdout)
-	if err != nil {
-		return nil, err
+	if out.Convergence != nil {
+		finalResponse["convergence"] = out.Convergence
 	}
-	if err := cmd.Wait(); err != nil {
-		return output, err
+	if decision != nil {
+		finalResponse["conditional_quantum"] = decision
 	}
-	return output, nil
+	if out.Comparison != nil {
+		finalResponse["comparison"] = out.Comparison
+	}
+	if params.Preview {
+		finalResponse["previews"] = buildPreviews(out.Downloads, params.config.getInt("PREVIEW_ROWS", 20))
+	}
+	writeJSON(w, http.StatusOK, finalResponse)
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Add("Vary", "Accept")
+	if wantsMsgpack(w) {
+		if b, err := marshalMsgpack(v); err == nil {
+			w.Header().Set("Content-Type", mimeMsgpack)
+			w.WriteHeader(status)
+			_, _ = w.Write(b)
+			return
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
+	if wantsPretty(w) {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err == nil {
+			_, _ = w.Write(append(b, '\n'))
+		}
+		return
+	}
 	_ = json.NewEncoder(w).Encode(v)
 }
 
-func genID() string { return fmt.Sprintf("%d", time.Now().UnixNano()) }
+// prettyWriter помечает запрос с ?pretty=1: writeJSON выводит JSON с
+// отступами (для чтения глазами через curl), по умолчанию — компактно.
+type prettyWriter struct {
+	http.ResponseWriter
+}
+
+func (p *prettyWriter) Unwrap() http.ResponseWriter { return p.ResponseWriter }
 
+func wantsPretty(w http.ResponseWriter) bool {
+	for {
+		switch x := w.(type) {
+		case *prettyWriter:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = x.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// tenantOf определяет арендатора по заголовку X-Tenant; пустая строка —
+// арендатор по умолчанию. Результаты и задачи видны только своему арендатору.
+func tenantOf(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get("X-Tenant"))
+}
+
+func runnerScript(cfg settings) string {
+	return cfg.get("RUNNER_PATH", filepath.Join("py", "runner.py"))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+var lastID atomic.Int64
+
+// genID возвращает id фиксированной длины: 16 hex-цифр строго
+// возрастающего UnixNano и 8 hex-цифр случайного суффикса. Сравнение id как
+// строк совпадает с хронологическим порядком, а суффикс не даёт угадать
+// соседний id по времени.
+func genID() string {
+	var ts int64
+	for {
+		prev := lastID.Load()
+		ts = max(time.Now().UnixNano(), prev+1)
+		if lastID.CompareAndSwap(prev, ts) {
+			break
+		}
+	}
+	return fmt.Sprintf("%016x%08x", ts, rand.Uint32())
+}
+
+// Политики FILENAME_POLICY поверх базовой очистки safeName.
+const (
+	policyRaw         = "raw"          // как есть (по умолчанию)
+	policyStrictASCII = "strict-ascii" // не-ASCII символы заменяются на _
+	policySlug        = "slug"         // пробелы -> _, не-ASCII удаляются
+)
+
+var filenamePolicy = policyRaw
+
+func validFilenamePolicy(p string) bool {
+	return p == policyRaw || p == policyStrictASCII || p == policySlug
+}
+
+// applyFilenamePolicy преобразует имя по filenamePolicy.
+func applyFilenamePolicy(s string) string {
+	switch filenamePolicy {
+	case policyStrictASCII:
+		return strings.Map(func(r rune) rune {
+			if r > 0x7e {
+				return '_'
+			}
+			return r
+		}, s)
+	case policySlug:
+		return strings.Map(func(r rune) rune {
+			switch {
+			case r == ' ':
+				return '_'
+			case r > 0x7e:
+				return -1
+			}
+			return r
+		}, s)
+	}
+	return s
+}
+
+// safeName приводит имя файла к виду, безопасному для Content-Disposition
+// и файловой системы: без каталогов, кавычек и управляющих символов.
+// Затем применяется FILENAME_POLICY; если от имени осталось одно
+// расширение, берётся def.
 func safeName(s, def string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			return -1
+		case r == '"' || r == '\\' || r == '/' || r == ':' || r == '*' || r == '?' || r == '<' || r == '>' || r == '|':
+			return '_'
+		}
+		return r
+	}, s)
+	if filenamePolicy != policyRaw {
+		s = applyFilenamePolicy(s)
+		if strings.Trim(strings.TrimSuffix(s, filepath.Ext(s)), "_ .") == "" {
+			return def
+		}
+	}
+	s = strings.Trim(strings.TrimSpace(s), ".")
 	if s == "" {
 		return def
 	}
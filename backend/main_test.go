@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// TestMain поднимает глобальное состояние, которое в рабочем режиме
+// настраивает main.
+func TestMain(m *testing.M) {
+	store = newResultStore(200)
+	runSlots = make(chan struct{}, 2)
+	downloadMiss = newMissLimiter(20, time.Minute, 5*time.Minute)
+	downloadSlots = newIPSlots(8)
+	os.Exit(m.Run())
+}
+
+// fakeRunner пишет python-скрипт, подменяющий runner.py, и направляет на
+// него RUNNER_PATH.
+func fakeRunner(t *testing.T, script string) {
+	t.Helper()
+	t.Setenv("RUNNER_PATH", writeScript(t, script))
+}
+
+// writeScript пишет python-скрипт во временный каталог теста; без python3
+// тест пропускается.
+func writeScript(t *testing.T, script string) string {
+	t.Helper()
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 not available")
+	}
+	path := t.TempDir() + "/runner.py"
+	if err := os.WriteFile(path, []byte(script), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// echoRunner — заглушка runner.py: отдаёт входной CSV как classic.csv,
+// argv и выбранные переменные окружения — в summary. FAKE_COST задаёт
+// final_cost_total.
+const echoRunner = `import base64, json, os, sys
+args = sys.argv[1:]
+path = args[args.index("--csv-file") + 1]
+data = open(path, "rb").read()
+print(json.dumps({
+    "ok": True,
+    "results": [],
+    "summary": {
+        "final_cost_total": float(os.environ.get("FAKE_COST", "10")),
+        "argv": args,
+        "env": {k: os.environ.get(k) for k in ("JOB_ID", "REQUEST_ID", "MIREA_SHOTS", "HOME", "SECRET_TOKEN")},
+    },
+    "csv_files": [
+        {"name": "classic.csv", "base64": base64.b64encode(data).decode()},
+        {"name": "quantum.csv", "base64": base64.b64encode(b"route,cost\n1,2\n").decode()},
+    ],
+}))
+`
+
+// postProcess отправляет multipart-запрос на /process: поля form и файл
+// filename с содержимым content (без файла, если filename пуст).
+func postProcess(t *testing.T, form url.Values, filename, content string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, vs := range form {
+		for _, v := range vs {
+			mw.WriteField(k, v)
+		}
+	}
+	if filename != "" {
+		fw, err := mw.CreateFormFile("file", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, content)
+	}
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/process", &body)
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	process(rec, req)
+	return rec
+}
+
+// decodeBody разбирает JSON-ответ; статус должен быть want.
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, want int) map[string]any {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, want, rec.Body)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return got
+}
+
+func TestWriteJSONPretty(t *testing.T) {
+	v := map[string]any{"ok": true, "files": []string{"a.csv"}}
+	tests := []struct {
+		name string
+		wrap func(http.ResponseWriter) http.ResponseWriter
+		want string
+	}{
+		{"compact", func(w http.ResponseWriter) http.ResponseWriter { return w }, `{"files":["a.csv"],"ok":true}` + "\n"},
+		{"pretty", func(w http.ResponseWriter) http.ResponseWriter { return &prettyWriter{w} },
+			"{\n  \"files\": [\n    \"a.csv\"\n  ],\n  \"ok\": true\n}\n"},
+		// Обёртки поверх prettyWriter (access log, throttle) не теряют флаг.
+		{"pretty under statusRecorder", func(w http.ResponseWriter) http.ResponseWriter {
+			return &statusRecorder{ResponseWriter: &prettyWriter{w}}
+		}, "{\n  \"files\": [\n    \"a.csv\"\n  ],\n  \"ok\": true\n}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeJSON(tt.wrap(rec), http.StatusCreated, v)
+			if rec.Code != http.StatusCreated || rec.Body.String() != tt.want {
+				t.Errorf("got %d %q, want %q", rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestSafeNamePolicy(t *testing.T) {
+	defer func(p string) { filenamePolicy = p }(filenamePolicy)
+	tests := []struct {
+		policy, in, want string
+	}{
+		{policyRaw, "отчёт 1.csv", "отчёт 1.csv"},
+		{policyRaw, `a/b\c"d.csv`, "a_b_c_d.csv"},
+		{policyRaw, "..", "def.csv"},
+		{policyStrictASCII, "отчёт 1.csv", "_____ 1.csv"},
+		{policyStrictASCII, "report.csv", "report.csv"},
+		{policySlug, "отчёт final.csv", "_final.csv"},
+		{policySlug, "my result.csv", "my_result.csv"},
+		// От имени осталось одно расширение — берётся имя по умолчанию.
+		{policySlug, "отчёт.csv", "def.csv"},
+		{policyStrictASCII, "отчёт.csv", "def.csv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+"/"+tt.in, func(t *testing.T) {
+			filenamePolicy = tt.policy
+			if got := safeName(tt.in, "def.csv"); got != tt.want {
+				t.Errorf("safeName(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+type manifestEntry struct {
+	Key         string `json:"key"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	ContentType string `json:"content_type"`
+	DownloadURL string `json:"download_url"`
+	// ExpiresAt — когда файл будет удалён (retain / RESULT_TTL).
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// SignedURL — ссылка для передачи другим, если задан DOWNLOAD_SIGNING_KEY.
+	SignedURL          string     `json:"signed_url,omitempty"`
+	SignedURLExpiresAt *time.Time `json:"signed_url_expires_at,omitempty"`
+}
+
+// manifest перечисляет все файлы задачи, чтобы клиенту не приходилось
+// угадывать ключи карты downloads. Вытесненные из store файлы попадают в missing.
+func manifest(w http.ResponseWriter, r *http.Request) {
+	jobID := r.URL.Query().Get("job")
+	job, ok := jobs.Get(jobID, tenantOf(r))
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	keys := make([]string, 0, len(job.Downloads))
+	for k := range job.Downloads {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	files := make([]manifestEntry, 0, len(keys))
+	missing := []string{}
+	for _, key := range keys {
+		id := job.Downloads[key]
+		rec, ok := store.Peek(id)
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		entry := manifestEntry{
+			Key:         key,
+			ID:          id,
+			Name:        rec.Name,
+			Size:        rec.Size,
+			SHA256:      rec.SHA256,
+			ContentType: "text/csv; charset=utf-8",
+			DownloadURL: "/download?id=" + url.QueryEscape(id),
+		}
+		if !rec.ExpiresAt.IsZero() {
+			entry.ExpiresAt = &rec.ExpiresAt
+		}
+		if link, expires, ok := signedDownloadURL(id, time.Now()); ok {
+			entry.SignedURL, entry.SignedURLExpiresAt = link, &expires
+		}
+		files = append(files, entry)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"job_id":  job.ID,
+		"state":   job.State,
+		"labels":  job.Labels,
+		"files":   files,
+		"missing": missing,
+	})
+}
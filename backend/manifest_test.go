@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	defer func(s *resultStore, j *jobRegistry) { store, jobs = s, j }(store, jobs)
+	store = newResultStore(10)
+	jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+
+	store.Store("a", newRecord("classic.csv", []byte("c\n1\n"), "team-a"))
+	store.Store("b", newRecord("quantum.csv", []byte("q\n22\n"), "team-a"))
+	jobs.Start(&jobRecord{ID: "job1", Tenant: "team-a"}, nil)
+	jobs.Finish("job1", map[string]string{"quantum_csv": "b", "classic_csv": "a", "report_csv": "evicted"})
+
+	get := func(tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/manifest?job=job1", nil)
+		req.Header.Set("X-Tenant", tenant)
+		rec := httptest.NewRecorder()
+		manifest(rec, req)
+		return rec
+	}
+	if rec := get("team-b"); rec.Code != http.StatusNotFound {
+		t.Errorf("other tenant: %d, want 404", rec.Code)
+	}
+
+	rec := get("team-a")
+	var got struct {
+		State   string
+		Files   []manifestEntry
+		Missing []string
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("manifest: %d %s (%v)", rec.Code, rec.Body, err)
+	}
+	if got.State != jobDone || !reflect.DeepEqual(got.Missing, []string{"report_csv"}) {
+		t.Errorf("state %q, missing %v", got.State, got.Missing)
+	}
+	want := []struct{ key, id, name, data string }{
+		{"classic_csv", "a", "classic.csv", "c\n1\n"},
+		{"quantum_csv", "b", "quantum.csv", "q\n22\n"},
+	}
+	if len(got.Files) != len(want) {
+		t.Fatalf("files = %+v", got.Files)
+	}
+	for i, w := range want {
+		f := got.Files[i]
+		sum := sha256.Sum256([]byte(w.data))
+		if f.Key != w.key || f.ID != w.id || f.Name != w.name || f.Size != int64(len(w.data)) ||
+			f.SHA256 != hex.EncodeToString(sum[:]) || f.DownloadURL != "/download?id="+w.id {
+			t.Errorf("files[%d] = %+v, want %s", i, f, w.key)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// metricsSink — приёмник счётчиков и таймеров. Места вызова не знают, куда
+// уходят метрики: по умолчанию никуда, с STATSD_ADDR — в StatsD по UDP.
+type metricsSink interface {
+	Count(name string, n int64)
+	Timing(name string, d time.Duration)
+	Gauge(name string, v int64)
+}
+
+var stats metricsSink = noopMetrics{}
+
+type noopMetrics struct{}
+
+func (noopMetrics) Count(string, int64)          {}
+func (noopMetrics) Timing(string, time.Duration) {}
+func (noopMetrics) Gauge(string, int64)          {}
+
+// statsdMetrics шлёт каждую метрику отдельным UDP-пакетом в формате StatsD
+// (name:value|type). Ошибки отправки не мешают запросам и только логируются
+// один раз, чтобы недоступный агент не засыпал лог.
+type statsdMetrics struct {
+	conn   net.Conn
+	prefix string
+	warned atomic.Bool
+}
+
+func newStatsdMetrics(addr, prefix string) (*statsdMetrics, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdMetrics{conn: conn, prefix: prefix}, nil
+}
+
+func (s *statsdMetrics) send(name string, value int64, kind string) {
+	if _, err := fmt.Fprintf(s.conn, "%s%s:%d|%s", s.prefix, name, value, kind); err != nil && !s.warned.Swap(true) {
+		log.Printf("StatsD send failed: %v", err)
+	}
+}
+
+func (s *statsdMetrics) Count(name string, n int64) { s.send(name, n, "c") }
+
+func (s *statsdMetrics) Timing(name string, d time.Duration) { s.send(name, d.Milliseconds(), "ms") }
+
+func (s *statsdMetrics) Gauge(name string, v int64) { s.send(name, v, "g") }
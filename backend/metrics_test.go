@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingMetrics запоминает отправленные метрики.
+type recordingMetrics struct {
+	mu      sync.Mutex
+	counts  map[string]int64
+	timings map[string]int
+	gauges  map[string][]int64
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{counts: map[string]int64{}, timings: map[string]int{}, gauges: map[string][]int64{}}
+}
+
+func (m *recordingMetrics) Count(name string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[name] += n
+}
+
+func (m *recordingMetrics) Timing(name string, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timings[name]++
+}
+
+func (m *recordingMetrics) Gauge(name string, v int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[name] = append(m.gauges[name], v)
+}
+
+func TestOptimizeMetrics(t *testing.T) {
+	defer func(s metricsSink) { stats = s }(stats)
+	rec := newRecordingMetrics()
+	stats = rec
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/input.csv", []byte("a,b\n1,2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	spec := runSpec{
+		InputPath: dir + "/input.csv",
+		WorkDir:   dir,
+		Effective: newEffectiveParameters(solverParams{}),
+		Timeout:   time.Minute,
+	}
+
+	fakeRunner(t, echoRunner)
+	if _, err := optimize(context.Background(), spec); err != nil {
+		t.Fatal(err)
+	}
+	fakeRunner(t, "import sys\nsys.exit(1)\n")
+	if _, err := optimize(context.Background(), spec); err == nil {
+		t.Fatal("optimize succeeded, want runner failure")
+	}
+
+	if rec.counts["process.count"] != 2 || rec.counts["process.failures"] != 1 {
+		t.Errorf("counts = %v, want 2 runs and 1 failure", rec.counts)
+	}
+	if rec.timings["python.duration"] != 2 {
+		t.Errorf("python.duration sent %d times, want 2", rec.timings["python.duration"])
+	}
+	// Занятые слоты: 1 во время запуска, 0 после него.
+	if g := rec.gauges["process.running"]; len(g) != 4 || g[0] != 1 || g[1] != 0 {
+		t.Errorf("process.running = %v, want [1 0 1 0]", g)
+	}
+}
+
+func TestStatsdWireFormat(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	sink, err := newStatsdMetrics(pc.LocalAddr().String(), "qbit.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Count("process.count", 1)
+	sink.Timing("python.duration", 1500*time.Millisecond)
+	sink.Gauge("process.running", 2)
+
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var got []string
+	buf := make([]byte, 512)
+	for range 3 {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(buf[:n]))
+	}
+	want := "qbit.process.count:1|c qbit.python.duration:1500|ms qbit.process.running:2|g"
+	if strings.Join(got, " ") != want {
+		t.Errorf("packets = %q, want %q", got, want)
+	}
+}
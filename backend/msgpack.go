@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+)
+
+const mimeMsgpack = "application/msgpack"
+
+// prefersMsgpack — клиент в Accept ставит application/msgpack выше JSON.
+// Без заголовка или при равных q остаётся JSON.
+func prefersMsgpack(accept string) bool {
+	if accept == "" {
+		return false
+	}
+	q := acceptWeights(accept)
+	mp, ok := q[mimeMsgpack]
+	if !ok {
+		mp = q["application/x-msgpack"]
+	}
+	js, ok := q["application/json"]
+	if !ok {
+		js = q["*/*"]
+	}
+	return mp > 0 && mp > js
+}
+
+// msgpackWriter помечает запрос, на который writeJSON отвечает MessagePack
+// (см. prettyWriter).
+type msgpackWriter struct {
+	http.ResponseWriter
+}
+
+func (m *msgpackWriter) Unwrap() http.ResponseWriter { return m.ResponseWriter }
+
+func wantsMsgpack(w http.ResponseWriter) bool {
+	for {
+		switch x := w.(type) {
+		case *msgpackWriter:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = x.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// marshalMsgpack кодирует v в MessagePack через JSON-представление, поэтому
+// структура ответа (теги json, omitempty) та же, что и в JSON.
+func marshalMsgpack(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encodeMsgpack(&buf, generic)
+	return buf.Bytes(), nil
+}
+
+// encodeMsgpack пишет значение, полученное из encoding/json с UseNumber.
+// Ключи объектов сортируются, как в JSON.
+func encodeMsgpack(buf *bytes.Buffer, v any) {
+	switch x := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if x {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			encodeMsgpackInt(buf, n)
+			return
+		}
+		f, _ := x.Float64()
+		buf.WriteByte(0xcb)
+		_ = binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	case string:
+		switch n := len(x); {
+		case n < 32:
+			buf.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buf.Write([]byte{0xd9, byte(n)})
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xda)
+			_ = binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdb)
+			_ = binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		buf.WriteString(x)
+	case []any:
+		writeMsgpackHeader(buf, len(x), 0x90, 0xdc)
+		for _, item := range x {
+			encodeMsgpack(buf, item)
+		}
+	case map[string]any:
+		writeMsgpackHeader(buf, len(x), 0x80, 0xde)
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encodeMsgpack(buf, k)
+			encodeMsgpack(buf, x[k])
+		}
+	}
+}
+
+// writeMsgpackHeader — заголовок массива или карты: fix-форма до 15
+// элементов, иначе 16- или 32-битная длина (code16, code16+1).
+func writeMsgpackHeader(buf *bytes.Buffer, n int, fix, code16 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(code16)
+		_ = binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(code16 + 1)
+		_ = binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+func encodeMsgpackInt(buf *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0 && n < 128:
+		buf.WriteByte(byte(n))
+	case n < 0 && n >= -32:
+		buf.WriteByte(byte(int8(n)))
+	default:
+		buf.WriteByte(0xd3)
+		_ = binary.Write(buf, binary.BigEndian, n)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPrefersMsgpack(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"*/*", false},
+		{"application/msgpack", true},
+		{"application/x-msgpack", true},
+		{"application/msgpack, application/json", false},
+		{"application/msgpack, application/json;q=0.5", true},
+		{"application/msgpack;q=0.5, */*;q=0.9", false},
+		{"application/msgpack;q=0", false},
+	}
+	for _, tt := range tests {
+		if got := prefersMsgpack(tt.accept); got != tt.want {
+			t.Errorf("prefersMsgpack(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestMarshalMsgpack(t *testing.T) {
+	long := make([]int, 16)
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"scalars", map[string]any{"a": 1, "b": []any{true, nil}, "c": "x", "d": 1.5, "e": -1, "f": 300},
+			"86" + "a161" + "01" + "a162" + "92c3c0" + "a163" + "a178" + "a164" + "cb3ff8000000000000" +
+				"a165" + "ff" + "a166" + "d3000000000000012c"},
+		// Теги json и omitempty действуют так же, как в JSON-ответе.
+		{"struct", struct {
+			ID   string `json:"id"`
+			Note string `json:"note,omitempty"`
+		}{ID: "j"}, "81" + "a26964" + "a16a"},
+		{"array16", long, "dc0010" + "00000000000000000000000000000000"},
+		{"str8", string(bytes.Repeat([]byte("s"), 32)), "d920" + hex.EncodeToString(bytes.Repeat([]byte("s"), 32))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := marshalMsgpack(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(b); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSONMsgpack(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeJSON(&msgpackWriter{&statusRecorder{ResponseWriter: rec}}, http.StatusCreated, map[string]any{"ok": true})
+	if rec.Code != http.StatusCreated || rec.Header().Get("Content-Type") != mimeMsgpack {
+		t.Fatalf("got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if got := hex.EncodeToString(rec.Body.Bytes()); got != "81a26f6bc3" {
+		t.Errorf("body = %s", got)
+	}
+	if rec.Header().Get("Vary") != "Accept" {
+		t.Errorf("Vary = %q", rec.Header().Get("Vary"))
+	}
+
+	rec = httptest.NewRecorder()
+	writeJSON(rec, http.StatusOK, map[string]any{"ok": true})
+	if rec.Header().Get("Content-Type") != "application/json" || rec.Header().Get("Vary") != "Accept" {
+		t.Errorf("plain request: %v", rec.Header())
+	}
+}
@@ -0,0 +1,11 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// setNice понижает приоритет только что запущенного процесса. Потоки,
+// которые он создаст позже, наследуют niceness.
+func setNice(pid, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestSubprocessNice(t *testing.T) {
+	defer func(n int) { subprocessNice = n }(subprocessNice)
+	// Niceness выставляется сразу после старта; скрипт ждёт, чтобы её увидеть.
+	script := writeScript(t, "import os, time\ntime.sleep(0.3)\nprint(os.nice(0))\n")
+
+	// getpriority возвращает 20-nice.
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := 20 - prio
+	if base >= 7 {
+		t.Skipf("test process already runs at niceness %d", base)
+	}
+	for _, nice := range []int{0, 7} {
+		subprocessNice = nice
+		var stdout bytes.Buffer
+		if err := runPython(context.Background(), snapshotSettings(), []string{script}, &stdout, nil); err != nil {
+			t.Fatal(err)
+		}
+		want := base
+		if nice != 0 {
+			want = nice
+		}
+		if got, _ := strconv.Atoi(strings.TrimSpace(stdout.String())); got != want {
+			t.Errorf("SUBPROCESS_NICE=%d: runner niceness %d, want %d", nice, got, want)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func setNice(pid, nice int) error {
+	return errors.New("SUBPROCESS_NICE is only supported on Linux")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Коды выхода one-shot режима.
+const (
+	exitOK      = 0
+	exitFailed  = 1 // запуск оптимизатора не удался
+	exitInvalid = 2 // неверные аргументы, параметры или входной файл
+)
+
+// paramFlags собирает повторяющиеся --param key=value в форму запроса,
+// чтобы параметры проверялись тем же parseParams, что и в /process.
+type paramFlags url.Values
+
+func (p paramFlags) String() string { return url.Values(p).Encode() }
+
+func (p paramFlags) Set(v string) error {
+	k, val, ok := strings.Cut(v, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value, got %q", v)
+	}
+	url.Values(p).Add(k, val)
+	return nil
+}
+
+// runOnce — режим --process для CI: один запуск без HTTP-сервера, файлы
+// результата и result.json пишутся в outDir. Возвращает код выхода.
+func runOnce(input, outDir string, form url.Values) int {
+	if outDir == "" {
+		log.Printf("--out is required with --process")
+		return exitInvalid
+	}
+	params, err := parseParams(&http.Request{Form: form})
+	if err != nil {
+		log.Printf("%v", err)
+		return exitInvalid
+	}
+	if params.Async {
+		log.Printf("sync=false is not supported with --process")
+		return exitInvalid
+	}
+	if len(params.RerouteFractions) > 1 {
+		log.Printf("reroute_fractions sweeps are not supported with --process")
+		return exitInvalid
+	}
+	filename := filepath.Base(input)
+	if !allowedExtension(filepath.Ext(filename)) {
+		log.Printf("only .csv or .txt files are allowed")
+		return exitInvalid
+	}
+
+	src, err := os.Open(input)
+	if err != nil {
+		log.Printf("open input: %v", err)
+		return exitInvalid
+	}
+	defer src.Close()
+	tmpDir, err := makeTempDir("upload-*")
+	if err != nil {
+		log.Printf("temp dir error: %v", err)
+		return exitFailed
+	}
+	defer os.RemoveAll(tmpDir)
+	dstPath := filepath.Join(tmpDir, filename)
+	dst, err := createTempFile(dstPath)
+	if err != nil {
+		log.Printf("create file error: %v", err)
+		return exitFailed
+	}
+	counted := &countingReader{r: src}
+	if params.Dedupe {
+		_, err = dedupeRows(counted, dst, params.config.getInt("DEDUPE_MAX_ROWS", 1_000_000))
+	} else {
+		_, err = io.Copy(dst, counted)
+	}
+	_ = dst.Close()
+	if err != nil {
+		log.Printf("save file error: %v", err)
+		return exitFailed
+	}
+	if counted.n == 0 {
+		log.Printf("empty file")
+		return exitInvalid
+	}
+
+	ctx, cancel := requestContext(time.Now(), params)
+	defer cancel()
+	inputPath, err := preprocessInput(ctx, params.config, dstPath, tmpDir)
+	if err != nil {
+		log.Printf("Preprocessing failed: %v", err)
+		return exitFailed
+	}
+	spec := runSpec{
+		InputPath: inputPath,
+		WorkDir:   tmpDir,
+		Params:    params,
+		Effective: newEffectiveParameters(params),
+		Timeout:   params.Timeout,
+		Source:    &jobSource{Filename: filename, Size: counted.n, UploadedAt: time.Now()},
+	}
+	var (
+		out      runOutcome
+		decision *quantumDecision
+	)
+	if params.QuantumTarget != nil {
+		out, decision, err = optimizeConditional(ctx, spec)
+	} else {
+		out, err = optimize(ctx, spec)
+	}
+	if err != nil {
+		log.Printf("Optimization failed: %v", err)
+		return exitFailed
+	}
+
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		log.Printf("create output dir: %v", err)
+		return exitFailed
+	}
+	for _, f := range bundleFiles(out.JobID, out.Downloads) {
+		if err := writeRecordFile(filepath.Join(outDir, f.name), f.rec); err != nil {
+			log.Printf("write %s: %v", f.name, err)
+			return exitFailed
+		}
+	}
+	record := map[string]any{
+		"ok":        out.Result["ok"],
+		"job_id":    out.JobID,
+		"results":   out.Result["results"],
+		"summary":   out.Result["summary"],
+		"downloads": out.Downloads,
+	}
+	if decision != nil {
+		record["conditional_quantum"] = decision
+	}
+	summary, err := json.MarshalIndent(record, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(outDir, "result.json"), summary, 0o644)
+	}
+	if err != nil {
+		log.Printf("write result.json: %v", err)
+		return exitFailed
+	}
+	if ok, _ := out.Result["ok"].(bool); !ok {
+		log.Printf("Runner reported ok=false")
+		return exitFailed
+	}
+	log.Printf("Results written to %s", outDir)
+	return exitOK
+}
+
+func writeRecordFile(path string, rec csvRecord) error {
+	src, err := rec.reader()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
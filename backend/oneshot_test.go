@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunOnceExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.csv")
+	os.WriteFile(input, []byte("a,b\n1,2\n"), 0o600)
+	empty := filepath.Join(dir, "empty.csv")
+	os.WriteFile(empty, nil, 0o600)
+	xlsx := filepath.Join(dir, "in.xlsx")
+	os.WriteFile(xlsx, []byte("a,b\n1,2\n"), 0o600)
+
+	tests := []struct {
+		name, runner, input string
+		noOut               bool
+		form                url.Values
+		want                int
+	}{
+		{"ok", echoRunner, input, false, nil, exitOK},
+		{"no --out", echoRunner, input, true, nil, exitInvalid},
+		{"bad param", echoRunner, input, false, url.Values{"p_layers": {"0"}}, exitInvalid},
+		{"sweep", echoRunner, input, false, url.Values{"reroute_fractions": {"0.1,0.2"}}, exitInvalid},
+		{"extension", echoRunner, xlsx, false, nil, exitInvalid},
+		{"missing input", echoRunner, filepath.Join(dir, "nope.csv"), false, nil, exitInvalid},
+		{"empty input", echoRunner, empty, false, nil, exitInvalid},
+		{"runner crash", "import sys\nsys.exit(3)\n", input, false, nil, exitFailed},
+		{"ok=false", `print('{"ok": false, "results": [], "summary": {}}')`, input, false, nil, exitFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeRunner(t, tt.runner)
+			out := filepath.Join(t.TempDir(), "out")
+			if tt.noOut {
+				out = ""
+			}
+			if got := runOnce(tt.input, out, tt.form); got != tt.want {
+				t.Fatalf("runOnce = %d, want %d", got, tt.want)
+			}
+			if tt.want != exitOK {
+				return
+			}
+			for _, name := range []string{"classic.csv", "quantum.csv"} {
+				if b, err := os.ReadFile(filepath.Join(out, name)); err != nil || len(b) == 0 {
+					t.Errorf("%s: %v", name, err)
+				}
+			}
+			var record map[string]any
+			b, _ := os.ReadFile(filepath.Join(out, "result.json"))
+			if err := json.Unmarshal(b, &record); err != nil || record["ok"] != true {
+				t.Errorf("result.json = %s (%v)", b, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runSpec описывает один запуск runner.py.
+type runSpec struct {
+	InputPath string
+	WorkDir   string
+	Params    solverParams
+	// Effective — параметры запуска, из которых строится argv.
+	Effective effectiveParameters
+	Timeout   time.Duration
+	Tenant    string
+	RequestID string
+	Source    *jobSource
+	// JobID задаётся заранее для асинхронных запусков; пусто — новый id.
+	JobID string
+	// Fail — имитируемый сбой (CHAOS=1, ?fail=); runner.py не запускается.
+	Fail string
+}
+
+type runOutcome struct {
+	JobID     string
+	Result    map[string]any
+	Downloads map[string]string
+	// Convergence — история сходимости (формат runner.py или []convergencePoint).
+	Convergence any
+	// Comparison — только с MIN_IMPROVEMENT_PCT и квантовой стоимостью в summary.
+	Comparison *quantumComparison
+}
+
+// runError — ошибка запуска с HTTP-статусом и сообщением для клиента.
+// С непустым Code ответ отдаётся структурированным JSON с Details.
+type runError struct {
+	Status  int
+	Message string
+	Code    string
+	Details map[string]any
+}
+
+func (e *runError) Error() string { return e.Message }
+
+// optimize выполняет один запуск runner.py как отдельную задачу: регистрирует
+// её в jobs, разбирает вывод и сохраняет файлы результатов в store.
+func optimize(ctx context.Context, spec runSpec) (out runOutcome, err error) {
+	stats.Count("process.count", 1)
+	defer func() {
+		if err != nil {
+			stats.Count("process.failures", 1)
+		}
+	}()
+	if spec.Fail != "" {
+		return injectFailure(ctx, spec)
+	}
+	cfg := spec.Params.config
+	runnerPath := runnerScript(cfg)
+	if !fileExists(runnerPath) {
+		log.Printf("Optimizer runner unavailable: %s not found", runnerPath)
+		return runOutcome{}, &runError{Status: http.StatusServiceUnavailable, Message: "optimizer unavailable"}
+	}
+	args := spec.Effective.args(runnerPath, spec.InputPath)
+	// Runner пишет CSV в outDir и возвращает пути вместо base64 в JSON.
+	outDir, err := os.MkdirTemp(spec.WorkDir, "out-*")
+	if err != nil {
+		return runOutcome{}, &runError{Status: http.StatusInternalServerError, Message: "temp dir error: " + err.Error()}
+	}
+	if cfg.get("RESULT_FILES_ON_DISK", "") == "1" {
+		args = append(args, "--output-dir", outDir)
+	}
+
+	jobID := spec.JobID
+	if jobID == "" {
+		jobID = genID()
+	}
+	command := redactArgs(append([]string{"python3"}, args...))
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	jobs.Start(&jobRecord{ID: jobID, Tenant: spec.Tenant, Command: command, Source: spec.Source, Labels: spec.Params.Labels, requestID: spec.RequestID}, cancel)
+	slog.Debug("runner invocation",
+		"job_id", jobID,
+		"request_id", spec.RequestID,
+		"params", spec.Effective,
+		"argv", command,
+	)
+
+	started := time.Now()
+	release, err := acquireRunSlot(ctx)
+	if err != nil {
+		return runOutcome{JobID: jobID}, runFailure(ctx, jobID, spec, started, err, nil)
+	}
+	jobs.Running(jobID)
+	stats.Gauge("process.running", int64(len(runSlots)))
+	log.Printf("Running hybrid optimization (job %s)...", jobID)
+	tracker := &convergenceTracker{jobID: jobID, graphs: countGraphs(spec.InputPath), iterations: spec.Effective.SolverIterations}
+	outputMax := cfg.getInt("JOB_OUTPUT_MAX_BYTES", 1<<20)
+	stderr := &cappedBuffer{max: outputMax}
+	// JOB_ID/REQUEST_ID позволяют сопоставить логи runner.py с логами сервера.
+	pythonStarted := time.Now()
+	tracker.started = pythonStarted
+	// Большие base64-поля декодируются в файлы outDir по ходу чтения stdout.
+	var stdout bytes.Buffer
+	spool := newStdoutSpool(&stdout, outDir, cfg.getInt("BASE64_SPOOL_MIN_BYTES", 4<<20))
+	env := append(spec.Effective.environ(), "JOB_ID="+jobID, "REQUEST_ID="+spec.RequestID)
+	err = runPython(ctx, cfg, args, spool, io.MultiWriter(&lineWriter{fn: tracker.Line}, stderr), env...)
+	spoolErr := spool.Close()
+	output := stdout.Bytes()
+	stats.Timing("python.duration", time.Since(pythonStarted))
+	release()
+	stats.Gauge("process.running", int64(len(runSlots)))
+	jobs.Update(jobID, func(job *jobRecord) {
+		job.output = &jobOutput{
+			Stdout:          bytes.Clone(output[:min(len(output), outputMax)]),
+			StdoutBytes:     int64(len(output)),
+			StdoutTruncated: len(output) > outputMax,
+			Stderr:          stderr.Bytes(),
+			StderrBytes:     stderr.total,
+			StderrTruncated: stderr.Truncated(),
+		}
+	})
+	if err != nil {
+		return runOutcome{JobID: jobID}, runFailure(ctx, jobID, spec, started, err, output)
+	}
+	if spoolErr != nil {
+		log.Printf("Failed to decode result payload of job %s: %v", jobID, spoolErr)
+		jobs.Fail(jobID, "failed to decode result payload")
+		return runOutcome{JobID: jobID}, &runError{Status: http.StatusInternalServerError, Message: "Failed to decode result payload: " + spoolErr.Error()}
+	}
+
+	// Парсим JSON как map; UseNumber сохраняет большие целые (id, стоимости)
+	// точно — json.Number сериализуется обратно тем же литералом.
+	var result map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(output))
+	dec.UseNumber()
+	if err := dec.Decode(&result); err != nil {
+		log.Printf("Failed to parse python results: %v", err)
+		log.Printf("Output: %s", truncate(string(output), 1000))
+		jobs.Fail(jobID, "failed to parse python results")
+		return runOutcome{JobID: jobID}, &runError{Status: http.StatusInternalServerError, Message: "Failed to parse python results"}
+	}
+
+	if errs := validateResult(result); len(errs) > 0 {
+		log.Printf("Runner output of job %s does not match the result schema (%d issues): %s",
+			jobID, len(errs), truncate(strings.Join(errs, "; "), 1000))
+		if cfg.get("STRICT_SCHEMA", "") == "1" {
+			jobs.Fail(jobID, "runner output does not match the result schema")
+			return runOutcome{JobID: jobID}, &runError{
+				Status:  http.StatusBadGateway,
+				Code:    "schema",
+				Message: "runner output does not match the expected result schema",
+				Details: map[string]any{"violations": errs[:min(len(errs), 50)]},
+			}
+		}
+	}
+
+	collector := &resultCollector{
+		tenant:         spec.Tenant,
+		submissionName: submissionName(cfg, spec.Params.Team, time.Now()),
+		primaryKey:     primaryDownloadKey(cfg),
+		jobID:          jobID,
+		workers:        cfg.getInt("RESULT_WORKERS", 4),
+		maxFiles:       cfg.getInt("MAX_RESULT_FILES", 32),
+		downloads:      map[string]string{},
+		ctx:            ctx,
+		workDir:        outDir,
+		config:         cfg,
+	}
+	if spec.Params.Retain > 0 {
+		collector.expiresAt = time.Now().Add(spec.Params.Retain)
+	}
+	downloads, err := collector.collect(result, outDir)
+	if err != nil {
+		log.Printf("Failed to collect result files: %v", err)
+		jobs.Fail(jobID, "failed to collect result files")
+		var rerr *runError
+		if errors.As(err, &rerr) {
+			return runOutcome{JobID: jobID}, rerr
+		}
+		return runOutcome{JobID: jobID}, &runError{Status: http.StatusInternalServerError, Message: "Failed to collect result files: " + err.Error()}
+	}
+
+	metrics := resultMetrics(result)
+	var comparison *quantumComparison
+	if minPct := spec.Effective.MinImprovementPct; minPct != nil && spec.Effective.MireaEnabled {
+		comparison = compareQuantum(metrics, *minPct)
+		if comparison != nil && !comparison.QuantumWorthwhile && cfg.get("OMIT_UNWORTHWHILE_QUANTUM", "") == "1" {
+			if id, ok := downloads["quantum_csv"]; ok {
+				store.Delete(id)
+				maps.DeleteFunc(downloads, func(_, v string) bool { return v == id })
+				comparison.QuantumOmitted = true
+			}
+		}
+	}
+	jobs.Update(jobID, func(job *jobRecord) {
+		job.Metrics = metrics
+		job.summary = result["summary"]
+	})
+	jobs.Finish(jobID, downloads)
+	out = runOutcome{JobID: jobID, Result: result, Downloads: downloads, Comparison: comparison}
+	// История сходимости: из JSON runner.py, если он её отдаёт, иначе —
+	// собранная из строк прогресса на stderr.
+	if conv, ok := result["convergence"]; ok {
+		out.Convergence = conv
+	} else if job, ok := jobs.Get(jobID, spec.Tenant); ok && len(job.Convergence) > 0 {
+		out.Convergence = job.Convergence
+	}
+	return out, nil
+}
+
+// runDetached выполняет асинхронный запуск после ответа 202: результат
+// забирается через /status и /download. Владеет tmpDir и контекстом.
+func runDetached(ctx context.Context, cancel context.CancelFunc, tmpDir string, spec runSpec) {
+	defer os.RemoveAll(tmpDir)
+	defer cancel()
+	if _, err := optimize(ctx, spec); err != nil {
+		// optimize не успел зарегистрировать задачу (например, нет runner.py).
+		if job, ok := jobs.Lookup(spec.JobID); ok && job.State == jobQueued {
+			jobs.Fail(spec.JobID, err.Error())
+		}
+		log.Printf("Async job %s failed: %v", spec.JobID, err)
+	}
+}
+
+// requestContext — контекст запуска: timeout запроса отсчитывается с
+// момента, когда файл сохранён, и покрывает ожидание слота и работу
+// runner.py. TOTAL_DEADLINE дополнительно ограничивает всё время от
+// начала запроса (start), включая загрузку.
+func requestContext(start time.Time, params solverParams) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), params.Timeout)
+	total := params.config.getDuration("TOTAL_DEADLINE", 0)
+	if total <= 0 {
+		return ctx, cancel
+	}
+	ctx, cancelTotal := context.WithDeadline(ctx, start.Add(total))
+	return ctx, func() { cancelTotal(); cancel() }
+}
+
+// runFailure определяет причину неудачного запуска (отмена, таймаут,
+// зависание или ошибка Python), помечает задачу и готовит ответ клиенту.
+func runFailure(ctx context.Context, jobID string, spec runSpec, started time.Time, err error, output []byte) *runError {
+	switch {
+	case errors.Is(err, errQueueDeadline):
+		waited := time.Since(started)
+		log.Printf("Job %s not started: deadline exceeded after %s in queue", jobID, waited.Round(time.Second))
+		jobs.Fail(jobID, "deadline exceeded while queued")
+		return &runError{
+			Status:  http.StatusGatewayTimeout,
+			Code:    "queue_deadline",
+			Message: "deadline exceeded while queued; the optimizer was not started",
+			Details: map[string]any{"queued_seconds": waited.Seconds()},
+		}
+	case errors.Is(context.Cause(ctx), errQuantumNotNeeded):
+		log.Printf("Job %s cancelled: quantum pass not needed", jobID)
+		jobs.Cancelled(jobID)
+		return &runError{Status: http.StatusConflict, Code: "cancelled", Message: "quantum pass was not needed"}
+	case errors.Is(context.Cause(ctx), errJobCancelled):
+		log.Printf("Job %s cancelled", jobID)
+		jobs.Cancelled(jobID)
+		return &runError{Status: http.StatusConflict, Code: "cancelled", Message: "job was cancelled by an administrator"}
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		elapsed := time.Since(started)
+		log.Printf("Optimizer timeout: job %s exceeded %s (elapsed %s)", jobID, spec.Timeout, elapsed.Round(time.Second))
+		jobs.Fail(jobID, "timeout")
+		return &runError{
+			Status:  http.StatusGatewayTimeout,
+			Code:    "timeout",
+			Message: fmt.Sprintf("optimizer did not finish within %s; pass a larger timeout (up to the server's PROCESSING_TIMEOUT)", spec.Timeout),
+			Details: map[string]any{
+				"timeout_seconds": spec.Timeout.Seconds(),
+				"elapsed_seconds": elapsed.Seconds(),
+			},
+		}
+	case errors.Is(err, errStalled):
+		log.Printf("Optimizer stalled: no output for %s", stallTimeout)
+		jobs.Fail(jobID, "stalled")
+		return &runError{Status: http.StatusGatewayTimeout, Message: fmt.Sprintf("optimizer stalled: no output for %s", stallTimeout)}
+	}
+	// Вывод runner.py клиенту не отдаётся: он остаётся в логе и в выводе
+	// задачи (/admin/job-output).
+	log.Printf("Quantum error: job %s: %v", jobID, err)
+	log.Printf("Output: %s", truncate(string(output), 1000))
+	jobs.Fail(jobID, err.Error())
+	return &runError{Status: http.StatusInternalServerError, Message: fmt.Sprintf("optimizer failed (job %s); see server logs", jobID)}
+}
+
+func writeRunError(w http.ResponseWriter, r *http.Request, err error) {
+	var rerr *runError
+	if errors.As(err, &rerr) {
+		if rerr.Code == "" {
+			http.Error(w, rerr.Message, rerr.Status)
+			return
+		}
+		body := map[string]any{"code": rerr.Code, "message": localize(r, rerr.Code, rerr.Message)}
+		for k, v := range rerr.Details {
+			body[k] = v
+		}
+		writeJSON(w, rerr.Status, map[string]any{"error": body})
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// quantumDecision — отчёт режима conditional_quantum.
+type quantumDecision struct {
+	TargetCost float64 `json:"target_cost"`
+	// ClassicCost — null, если runner.py не вернул final_cost_total; тогда
+	// цель считается недостигнутой.
+	ClassicCost    *float64 `json:"classic_cost"`
+	QuantumSkipped bool     `json:"quantum_skipped"`
+	ClassicJobID   string   `json:"classic_job_id"`
+}
+
+// errQuantumNotNeeded — причина отмены квантового прохода, запущенного
+// параллельно с классическим, когда классический уже достиг цели.
+var errQuantumNotNeeded = errors.New("quantum pass not needed")
+
+// optimizeConditional — режим conditional_quantum: runner.py запускается без
+// MIREA; если final_cost_total уже не выше цели, квантовый проход
+// пропускается и возвращается классический результат, иначе — результат
+// обычного полного запуска, а файлы классического удаляются из store.
+//
+// CONDITIONAL_PASS_SLOTS — сколько проходов запроса могут работать
+// одновременно (каждому ещё нужен слот runSlots). При 1 полный запуск
+// начинается только после классического и только если он нужен; при 2 оба
+// стартуют сразу: когда цель не достигнута, ответ приходит раньше, а когда
+// достигнута, квантовый проход отменяется (вызовы MIREA, сделанные до
+// этого, тратятся впустую).
+func optimizeConditional(ctx context.Context, spec runSpec) (runOutcome, *quantumDecision, error) {
+	passes := make(chan struct{}, max(1, spec.Params.config.getInt("CONDITIONAL_PASS_SLOTS", 1)))
+	qctx, stopQuantum := context.WithCancelCause(ctx)
+	defer stopQuantum(nil)
+
+	// Классический проход занимает слот первым, поэтому при ёмкости 1
+	// квантовый ждёт его решения.
+	passes <- struct{}{}
+	type passResult struct {
+		out runOutcome
+		err error
+	}
+	quantum := make(chan passResult, 1)
+	go func() {
+		select {
+		case passes <- struct{}{}:
+		case <-qctx.Done():
+			quantum <- passResult{err: context.Cause(qctx)}
+			return
+		}
+		defer func() { <-passes }()
+		// Слот мог освободиться уже после решения классического прохода.
+		if err := context.Cause(qctx); err != nil {
+			quantum <- passResult{err: err}
+			return
+		}
+		out, err := optimize(qctx, spec)
+		quantum <- passResult{out, err}
+	}()
+
+	classic := spec
+	classic.Effective.MireaEnabled = false
+	out, err := optimize(ctx, classic)
+	d := &quantumDecision{TargetCost: *spec.Params.QuantumTarget, ClassicJobID: out.JobID}
+	skip := false
+	if err == nil {
+		if cost, ok := resultMetrics(out.Result)["final_cost_total"]; ok {
+			d.ClassicCost = &cost
+			skip = cost <= d.TargetCost
+		}
+	}
+	if err != nil || skip {
+		stopQuantum(errQuantumNotNeeded)
+	}
+	<-passes
+	if err != nil {
+		<-quantum
+		return out, nil, err
+	}
+
+	if skip {
+		d.QuantumSkipped = true
+		log.Printf("Job %s: classic cost %.4g meets target %.4g, quantum pass skipped", out.JobID, *d.ClassicCost, d.TargetCost)
+		// Параллельный проход мог успеть завершиться — его файлы не нужны.
+		if q := <-quantum; q.err == nil {
+			discardDownloads(q.out)
+		}
+		return out, d, nil
+	}
+	if d.ClassicCost != nil {
+		log.Printf("Job %s: classic cost %.4g misses target %.4g, running quantum pass", out.JobID, *d.ClassicCost, d.TargetCost)
+	} else {
+		log.Printf("Job %s: runner reported no final_cost_total, running quantum pass", out.JobID)
+	}
+	// Клиент получит результат полного запуска; файлы классического
+	// прохода ни в один ответ не попадут.
+	discardDownloads(out)
+	q := <-quantum
+	return q.out, d, q.err
+}
+
+// discardDownloads удаляет из store файлы запуска, который не попадёт в
+// ответ, и убирает их из его задачи.
+func discardDownloads(out runOutcome) {
+	for _, id := range out.Downloads {
+		store.Delete(id)
+	}
+	jobs.Update(out.JobID, func(job *jobRecord) { job.Downloads = nil })
+}
+
+// sweepPoint — результат одного значения reroute_fraction в серии запусков.
+type sweepPoint struct {
+	RerouteFraction float64           `json:"reroute_fraction"`
+	OK              bool              `json:"ok"`
+	JobID           string            `json:"job_id,omitempty"`
+	Results         any               `json:"results,omitempty"`
+	Summary         any               `json:"summary,omitempty"`
+	Downloads       map[string]string `json:"downloads,omitempty"`
+	Convergence     any               `json:"convergence,omitempty"`
+	Error           string            `json:"error,omitempty"`
+
+	err error
+}
+
+// sweep запускает runner.py для каждого значения reroute_fraction; реальный
+// параллелизм ограничен общим лимитом запусков (runSlots). ok == false,
+// только если не удалась ни одна точка.
+func sweep(ctx context.Context, spec runSpec, fractions []float64, annotate func(map[string]any)) ([]sweepPoint, bool) {
+	points := make([]sweepPoint, len(fractions))
+	var wg sync.WaitGroup
+	for i, f := range fractions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := spec
+			s.Effective = spec.Effective.withFraction(f)
+			out, err := optimize(ctx, s)
+			p := sweepPoint{RerouteFraction: f, JobID: out.JobID, err: err}
+			if err != nil {
+				p.Error = err.Error()
+			} else {
+				annotate(out.Result)
+				p.OK = true
+				p.Results = out.Result["results"]
+				p.Summary = out.Result["summary"]
+				p.Downloads = out.Downloads
+				p.Convergence = out.Convergence
+			}
+			points[i] = p
+		}()
+	}
+	wg.Wait()
+
+	for _, p := range points {
+		if p.OK {
+			return points, true
+		}
+	}
+	return points, false
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunFailureHidesRunnerOutput(t *testing.T) {
+	fakeRunner(t, `import sys
+print("SECRET-STDOUT /srv/data/users.csv")
+print("Traceback: SECRET-STDERR password=hunter2", file=sys.stderr)
+sys.exit(1)
+`)
+	spec := runSpec{
+		InputPath: "input.csv",
+		WorkDir:   t.TempDir(),
+		Effective: newEffectiveParameters(solverParams{}),
+		Timeout:   time.Minute,
+	}
+	out, err := optimize(context.Background(), spec)
+	if err == nil {
+		t.Fatal("optimize succeeded, want runner failure")
+	}
+	rec := httptest.NewRecorder()
+	writeRunError(rec, httptest.NewRequest(http.MethodPost, "/process", nil), err)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, leak := range []string{"SECRET", "hunter2", "/srv/data"} {
+		if strings.Contains(body, leak) {
+			t.Errorf("response leaks runner output %q: %s", leak, body)
+		}
+	}
+	if !strings.Contains(body, out.JobID) {
+		t.Errorf("response %q does not mention job %s", body, out.JobID)
+	}
+
+	// Сырой вывод остаётся доступен через /admin/job-output.
+	rec = httptest.NewRecorder()
+	adminJobOutput(rec, httptest.NewRequest(http.MethodGet, "/admin/job-output?id="+out.JobID, nil))
+	var got struct{ Stdout, Stderr string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("admin job output: %v (%s)", err, rec.Body)
+	}
+	if !strings.Contains(got.Stdout, "SECRET-STDOUT") || !strings.Contains(got.Stderr, "SECRET-STDERR") {
+		t.Errorf("admin job output lost runner output: %+v", got)
+	}
+}
+
+func TestMissingRunner(t *testing.T) {
+	t.Setenv("RUNNER_PATH", t.TempDir()+"/missing.py")
+	rec := postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil)
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "optimizer unavailable") {
+		t.Errorf("POST /process without runner: %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	capabilities(rec, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	if caps := decodeBody(t, rec, http.StatusOK); caps["optimizer_available"] != false {
+		t.Errorf("optimizer_available = %v, want false", caps["optimizer_available"])
+	}
+
+	fakeRunner(t, echoRunner)
+	got := decodeBody(t, postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil), http.StatusOK)
+	if got["ok"] != true {
+		t.Errorf("POST /process with runner: %v", got)
+	}
+}
+
+// sweepRunner отмечает себя файлом в SWEEP_DIR и сообщает, сколько
+// запусков шло одновременно с ним.
+const sweepRunner = `import json, os, sys, time
+args = sys.argv[1:]
+d = os.environ["SWEEP_DIR"]
+me = os.path.join(d, str(os.getpid()))
+open(me, "w").close()
+time.sleep(0.3)
+running = len(os.listdir(d))
+os.remove(me)
+print(json.dumps({"ok": True, "results": [], "summary": {
+    "fraction": float(args[args.index("--reroute-fraction") + 1]),
+    "running": running,
+}}))
+`
+
+func TestRerouteSweep(t *testing.T) {
+	fakeRunner(t, sweepRunner)
+	t.Setenv("SWEEP_DIR", t.TempDir())
+	t.Setenv("PYTHON_ENV_PASSTHROUGH", "SWEEP_DIR")
+	t.Setenv("SWEEP_MAX_POINTS", "4")
+
+	got := decodeBody(t, postProcess(t, url.Values{"reroute_fractions": {"0.1, 0.25,0.5,1"}}, "in.csv", "a,b\n1,2\n", nil), http.StatusOK)
+	points, _ := got["sweep"].([]any)
+	if len(points) != 4 {
+		t.Fatalf("sweep = %v, want 4 points", got["sweep"])
+	}
+	for i, want := range []float64{0.1, 0.25, 0.5, 1} {
+		p := points[i].(map[string]any)
+		summary, _ := p["summary"].(map[string]any)
+		if p["ok"] != true || p["reroute_fraction"] != want || summary["fraction"] != want {
+			t.Errorf("point %d = %v, want fraction %g passed to the runner", i, p, want)
+		}
+		// Точки делят общий лимит MAX_CONCURRENT_RUNS (2 в тестах).
+		if n, _ := summary["running"].(float64); n > float64(cap(runSlots)) {
+			t.Errorf("point %d saw %g concurrent runs, limit %d", i, n, cap(runSlots))
+		}
+	}
+
+	for _, bad := range []string{"0.1,0.2,0.3,0.4,0.5", "0.1,0", "0.1,1.5", "0.1,x"} {
+		rec := postProcess(t, url.Values{"reroute_fractions": {bad}}, "in.csv", "a,b\n1,2\n", nil)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "reroute_fractions") {
+			t.Errorf("reroute_fractions=%s: %d %s, want 400", bad, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestRunnerNumbersExact(t *testing.T) {
+	fakeRunner(t, `print('{"ok": true, "results": [{"graph_index": 12345678901234567890, "stats": {"final_cost": 2.5}}], "summary": {"id": 9007199254740993, "final_cost_total": 0.1}}')`)
+	rec := postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("process: %d %s", rec.Code, rec.Body)
+	}
+	// Целые больше 2^53 не проходят через float64 и не округляются.
+	for _, literal := range []string{`"graph_index":12345678901234567890`, `"id":9007199254740993`, `"final_cost_total":0.1`} {
+		if !strings.Contains(rec.Body.String(), literal) {
+			t.Errorf("response lost %s: %s", literal, rec.Body)
+		}
+	}
+	got := decodeBody(t, rec, http.StatusOK)
+	statusRec := httptest.NewRecorder()
+	status(statusRec, httptest.NewRequest(http.MethodGet, "/status?id="+got["job_id"].(string), nil))
+	metrics, _ := decodeBody(t, statusRec, http.StatusOK)["metrics"].(map[string]any)
+	// Метрики по-прежнему считаются из json.Number.
+	if metrics["final_cost_total"] != 2.6 {
+		t.Errorf("metrics = %v, want final_cost_total 0.1 + 2.5", metrics)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	fakeRunner(t, "import time\ntime.sleep(10)\n")
+	t.Setenv("MIN_TIMEOUT", "100ms")
+	t.Setenv("PROCESSING_TIMEOUT", "1m")
+
+	for _, tt := range []struct{ timeout, want string }{
+		{"50ms", "at least 100ms"},
+		{"2m", "at most 1m0s"},
+		{"soon", "must be a duration"},
+	} {
+		rec := postProcess(t, url.Values{"timeout": {tt.timeout}}, "in.csv", "a,b\n1,2\n", nil)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("timeout=%s: %d %s, want 400 %q", tt.timeout, rec.Code, rec.Body, tt.want)
+		}
+	}
+
+	start := time.Now()
+	rec := postProcess(t, url.Values{"timeout": {"300ms"}}, "in.csv", "a,b\n1,2\n", nil)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("run took %s with a 300ms timeout", elapsed)
+	}
+	e, _ := decodeBody(t, rec, http.StatusGatewayTimeout)["error"].(map[string]any)
+	if e["code"] != "timeout" || e["timeout_seconds"] != 0.3 || !strings.Contains(e["message"].(string), "300ms") {
+		t.Errorf("timeout error = %v", e)
+	}
+	if elapsed, _ := e["elapsed_seconds"].(float64); elapsed < 0.3 {
+		t.Errorf("elapsed_seconds = %v, want at least the timeout", e["elapsed_seconds"])
+	}
+}
+
+func TestEmptyUpload(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	fakeRunner(t, "open("+strconv.Quote(marker)+", 'w').close()\nprint('{\"ok\": true, \"results\": [], \"summary\": {}}')\n")
+	for _, name := range []string{"empty.csv", "empty.txt"} {
+		rec := postProcess(t, nil, name, "", nil)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "empty file") {
+			t.Errorf("%s: %d %s, want 400 empty file", name, rec.Code, rec.Body)
+		}
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("runner.py was started for an empty upload")
+	}
+	// Тот же запрос с данными доходит до runner.py.
+	if rec := postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil); rec.Code != http.StatusOK {
+		t.Fatalf("non-empty upload: %d %s", rec.Code, rec.Body)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("runner.py did not run for a non-empty upload: %v", err)
+	}
+}
+
+// passRunner — заглушка runner.py для conditional_quantum: в summary и
+// classic.csv пишет, какой это проход; FAKE_COST — final_cost_total
+// классического прохода (пусто — не сообщается).
+const passRunner = `import base64, json, os, sys
+name = "quantum" if "--use-mirea" in sys.argv else "classic"
+summary = {"pass": name}
+if name == "classic" and os.environ.get("FAKE_COST"):
+    summary["final_cost_total"] = float(os.environ["FAKE_COST"])
+data = base64.b64encode(("pass\n" + name + "\n").encode()).decode()
+print(json.dumps({"ok": True, "results": [], "summary": summary,
+                  "csv_files": [{"name": "classic.csv", "base64": data}]}))
+`
+
+func TestConditionalQuantum(t *testing.T) {
+	fakeRunner(t, passRunner)
+	t.Setenv("PYTHON_ENV_PASSTHROUGH", "FAKE_COST")
+	form := url.Values{"conditional_quantum": {"1"}, "quantum_target_cost": {"10"}}
+	tests := []struct {
+		name    string
+		cost    string
+		skipped bool
+	}{
+		{"classic meets target", "5", true},
+		{"classic misses target", "20", false},
+		{"no cost reported", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FAKE_COST", tt.cost)
+			got := decodeBody(t, postProcess(t, form, "in.csv", "a\n1\n", nil), http.StatusOK)
+			d := got["conditional_quantum"].(map[string]any)
+			if d["quantum_skipped"] != tt.skipped {
+				t.Fatalf("decision = %v", d)
+			}
+			if tt.cost == "" && d["classic_cost"] != nil {
+				t.Errorf("classic_cost = %v, want null", d["classic_cost"])
+			}
+			want := "quantum"
+			if tt.skipped {
+				want = "classic"
+			}
+			if pass := got["summary"].(map[string]any)["pass"]; pass != want {
+				t.Errorf("returned the %v pass, want %s", pass, want)
+			}
+			rec, ok := store.Peek(got["downloads"].(map[string]any)["classic_csv"].(string))
+			if !ok || string(rec.Data) != "pass\n"+want+"\n" {
+				t.Errorf("download = %q", rec.Data)
+			}
+
+			classicID := d["classic_job_id"].(string)
+			if tt.skipped {
+				if classicID != got["job_id"] {
+					t.Errorf("classic_job_id %s, job_id %v", classicID, got["job_id"])
+				}
+				return
+			}
+			// Файлы классического прохода после полного запуска не хранятся.
+			classic, _ := jobs.Lookup(classicID)
+			if len(classic.Downloads) != 0 {
+				t.Errorf("classic job still lists downloads %v", classic.Downloads)
+			}
+			for _, rec := range store.Search("classic", 1000) {
+				if rec.JobID == classicID {
+					t.Errorf("classic result %s still stored", rec.ID)
+				}
+			}
+		})
+	}
+}
+
+// timedPassRunner — passRunner, который отмечает в PASS_LOG начало и конец
+// каждого прохода; квантовый работает PASS_SLEEP_QUANTUM секунд.
+const timedPassRunner = `import base64, json, os, sys, time
+name = "quantum" if "--use-mirea" in sys.argv else "classic"
+def mark(event):
+    with open(os.environ["PASS_LOG"], "a") as f:
+        f.write(event + " " + name + "\n")
+mark("start")
+time.sleep(float(os.environ.get("PASS_SLEEP_" + name.upper(), "0.5")))
+mark("end")
+summary = {"pass": name}
+if name == "classic":
+    summary["final_cost_total"] = float(os.environ["FAKE_COST"])
+data = base64.b64encode(("pass\n" + name + "\n").encode()).decode()
+print(json.dumps({"ok": True, "results": [], "summary": summary,
+                  "csv_files": [{"name": "classic.csv", "base64": data}]}))
+`
+
+func TestConditionalPassConcurrency(t *testing.T) {
+	defer func(j *jobRegistry) { jobs = j }(jobs)
+	fakeRunner(t, timedPassRunner)
+	t.Setenv("PYTHON_ENV_PASSTHROUGH", "FAKE_COST,PASS_LOG,PASS_SLEEP_QUANTUM")
+	form := url.Values{"conditional_quantum": {"1"}, "quantum_target_cost": {"10"}}
+	tests := []struct {
+		name, concurrency, cost string
+		overlap                 bool   // квантовый проход начался до конца классического
+		quantumState            string // пусто — квантовый проход не запускался
+	}{
+		{"serial", "1", "20", false, jobDone},
+		{"concurrent", "2", "20", true, jobDone},
+		// Классический проход достиг цели — параллельный квантовый отменён.
+		{"concurrent, target met", "2", "5", true, jobCancelled},
+		{"serial, target met", "1", "5", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+			passLog := filepath.Join(t.TempDir(), "passes.log")
+			t.Setenv("PASS_LOG", passLog)
+			t.Setenv("FAKE_COST", tt.cost)
+			t.Setenv("CONDITIONAL_PASS_SLOTS", tt.concurrency)
+			sleep := "0.5"
+			if tt.quantumState == jobCancelled {
+				sleep = "30"
+			}
+			t.Setenv("PASS_SLEEP_QUANTUM", sleep)
+
+			started := time.Now()
+			got := decodeBody(t, postProcess(t, form, "in.csv", "a\n1\n", nil), http.StatusOK)
+			if tt.quantumState == jobCancelled && time.Since(started) > 10*time.Second {
+				t.Errorf("response waited %s for the unneeded quantum pass", time.Since(started))
+			}
+			want := "quantum"
+			if tt.cost == "5" {
+				want = "classic"
+			}
+			if pass := got["summary"].(map[string]any)["pass"]; pass != want {
+				t.Errorf("returned the %v pass, want %s", pass, want)
+			}
+			b, _ := os.ReadFile(passLog)
+			events := strings.Split(strings.TrimSpace(string(b)), "\n")
+			classicEnd := slices.Index(events, "end classic")
+			quantumStart := slices.Index(events, "start quantum")
+			if classicEnd < 0 || (quantumStart >= 0) != (tt.quantumState != "") || (quantumStart >= 0 && quantumStart < classicEnd) != tt.overlap {
+				t.Errorf("passes ran as %q", events)
+			}
+
+			var quantum []jobRecord
+			for _, job := range jobs.List("") {
+				if slices.Contains(job.Command, "--use-mirea") {
+					quantum = append(quantum, job)
+				}
+			}
+			if tt.quantumState == "" {
+				if len(quantum) != 0 {
+					t.Errorf("quantum pass started: %+v", quantum)
+				}
+				return
+			}
+			if len(quantum) != 1 || quantum[0].State != tt.quantumState {
+				t.Fatalf("quantum jobs %+v, want one %s", quantum, tt.quantumState)
+			}
+		})
+	}
+}
+
+func TestQueueDeadline(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "started")
+	fakeRunner(t, "open("+strconv.Quote(marker)+", \"w\").close()\n"+echoRunner)
+	t.Setenv("TOTAL_DEADLINE", "200ms")
+	// Все слоты заняты — запуск так и не начнётся.
+	for range cap(runSlots) {
+		runSlots <- struct{}{}
+	}
+	defer func() {
+		for range cap(runSlots) {
+			<-runSlots
+		}
+	}()
+
+	rec := postProcess(t, nil, "in.csv", "a\n1\n", nil)
+	e := decodeBody(t, rec, http.StatusGatewayTimeout)["error"].(map[string]any)
+	if e["code"] != "queue_deadline" {
+		t.Fatalf("error = %v, want queue_deadline", e)
+	}
+	if queued, _ := e["queued_seconds"].(float64); queued <= 0 || queued > 1 {
+		t.Errorf("queued_seconds = %v", e["queued_seconds"])
+	}
+	if fileExists(marker) {
+		t.Error("runner.py was started")
+	}
+}
+
+func TestRequestContextTotalDeadline(t *testing.T) {
+	start := time.Now().Add(-time.Second)
+	tests := []struct {
+		total string
+		want  time.Time
+	}{
+		{"", time.Now().Add(time.Minute)},
+		{"10s", start.Add(10 * time.Second)},
+		// TOTAL_DEADLINE длиннее timeout — действует timeout.
+		{"1h", time.Now().Add(time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.total, func(t *testing.T) {
+			t.Setenv("TOTAL_DEADLINE", tt.total)
+			params, err := parseForm(url.Values{"timeout": {"60"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := requestContext(start, params)
+			defer cancel()
+			deadline, _ := ctx.Deadline()
+			if d := deadline.Sub(tt.want); d < -time.Second || d > time.Second {
+				t.Errorf("deadline off by %s", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// solverParams — параметры запуска, которые клиент может задать в форме /process.
+type solverParams struct {
+	PLayers int
+	Dedupe  bool
+	Team    string
+	// Seed == nil — runner.py использует случайное состояние.
+	Seed *int64
+	// RerouteFractions — одно значение или серия для sweep-запуска.
+	RerouteFractions []float64
+	// Timeout — предел времени работы runner.py для этого запроса.
+	Timeout time.Duration
+	// Preview — вернуть первые строки файлов результата в ответе.
+	Preview bool
+	// MaxRoutes — --max-routes для runner.py, не больше MAX_ROUTES_CEILING.
+	MaxRoutes int
+	// Retain — срок хранения файлов результата; 0 — без срока (только LRU).
+	Retain time.Duration
+	// QuantumTarget != nil — режим conditional_quantum: сначала только
+	// классика, квантовый проход — если final_cost_total выше цели.
+	QuantumTarget *float64
+	// Async — вернуть job_id сразу (202), а не ждать результата; поле
+	// sync=false, по умолчанию — ASYNC_BY_DEFAULT.
+	Async bool
+	// Labels — произвольные метки задачи (поле labels) для /jobs?label=.
+	Labels map[string]string
+	// EnvOverrides — переменные окружения для runner.py этой задачи поверх
+	// серверных (поле env_overrides, ключи из ENV_OVERRIDE_ALLOWLIST).
+	EnvOverrides map[string]string
+
+	// config — снимок настроек, взятый при разборе запроса: из него задача
+	// читает настройки до конца работы, даже если по SIGHUP файл сменится.
+	config settings
+}
+
+// maxRoutesCeiling — потолок max_routes: runner.py держит маршруты в памяти,
+// и абсурдное значение раздувает процесс.
+func maxRoutesCeiling(cfg settings) int { return cfg.getInt("MAX_ROUTES_CEILING", 999999) }
+
+func defaultParams(cfg settings) solverParams {
+	return solverParams{
+		PLayers:          cfg.getInt("DEFAULT_P_LAYERS", 1),
+		RerouteFractions: []float64{cfg.getFloat("DEFAULT_REROUTE_FRACTION", 0.1)},
+		Timeout:          cfg.getDuration("PROCESSING_TIMEOUT", 30*time.Minute),
+		Retain:           cfg.getDuration("RESULT_TTL", 0),
+		MaxRoutes:        min(999999, maxRoutesCeiling(cfg)),
+		config:           cfg,
+	}
+}
+
+// validationError собирает ошибки всех полей сразу, чтобы клиент увидел
+// их одним ответом, а не исправлял по одной.
+type validationError struct {
+	Fields map[string]string
+}
+
+func (e *validationError) add(field, msg string) {
+	if e.Fields == nil {
+		e.Fields = map[string]string{}
+	}
+	e.Fields[field] = msg
+}
+
+func (e *validationError) Error() string {
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + ": " + e.Fields[k]
+	}
+	return "invalid parameters: " + strings.Join(parts, "; ")
+}
+
+func writeValidationError(w http.ResponseWriter, r *http.Request, verr *validationError) {
+	writeJSON(w, http.StatusBadRequest, map[string]any{
+		"error": map[string]any{
+			"code":    "validation",
+			"message": localize(r, "validation", "invalid parameters"),
+			"fields":  verr.Fields,
+		},
+	})
+}
+
+func parseParams(r *http.Request) (solverParams, error) {
+	cfg := snapshotSettings()
+	p := defaultParams(cfg)
+	verr := &validationError{}
+	field := func(k string) string { return strings.TrimSpace(r.FormValue(k)) }
+
+	if v := field("p_layers"); v != "" {
+		// Глубина QAOA-схемы растёт линейно с p, а вместе с ней время и
+		// стоимость каждого вызова MIREA, поэтому потолок настраиваемый.
+		max := cfg.getInt("P_LAYERS_MAX", 10)
+		n, err := strconv.Atoi(v)
+		switch {
+		case err != nil:
+			verr.add("p_layers", "must be an integer")
+		case n < 1 || n > max:
+			verr.add("p_layers", fmt.Sprintf("must be 1..%d: every extra layer deepens the quantum circuit and increases MIREA execution cost", max))
+		default:
+			p.PLayers = n
+		}
+	}
+
+	if v := field("dedupe"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			verr.add("dedupe", "must be a boolean")
+		} else {
+			p.Dedupe = b
+		}
+	}
+
+	if v := field("preview"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			verr.add("preview", "must be a boolean")
+		} else {
+			p.Preview = b
+		}
+	}
+
+	if v := field("team"); v != "" {
+		if len(v) > 64 {
+			verr.add("team", "must be at most 64 characters")
+		} else {
+			p.Team = v
+		}
+	}
+
+	if v := field("seed"); v != "" {
+		// numpy принимает seed только в диапазоне uint32.
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 || n > math.MaxUint32 {
+			verr.add("seed", fmt.Sprintf("must be an integer 0..%d", uint32(math.MaxUint32)))
+		} else {
+			p.Seed = &n
+		}
+	} else if cfg.get("AUTO_SEED", "") == "1" {
+		n := rand.Int64N(math.MaxUint32 + 1)
+		p.Seed = &n
+	}
+
+	if v := field("reroute_fractions"); v != "" {
+		max := cfg.getInt("SWEEP_MAX_POINTS", 5)
+		var fractions []float64
+		for _, item := range splitList(v) {
+			f, err := strconv.ParseFloat(item, 64)
+			if err != nil || f <= 0 || f > 1 {
+				verr.add("reroute_fractions", "each value must be a number in (0, 1]")
+				fractions = nil
+				break
+			}
+			fractions = append(fractions, f)
+		}
+		switch {
+		case len(fractions) > max:
+			verr.add("reroute_fractions", fmt.Sprintf("at most %d values are allowed", max))
+		case len(fractions) > 0:
+			p.RerouteFractions = fractions
+		}
+	}
+
+	if v := field("timeout"); v != "" {
+		// Слишком маленький таймаут гарантированно убьёт запуск — отсекаем
+		// его сразу; сверху ограничивает серверный PROCESSING_TIMEOUT.
+		min := cfg.getDuration("MIN_TIMEOUT", time.Minute)
+		max := cfg.getDuration("PROCESSING_TIMEOUT", 30*time.Minute)
+		d, err := parseDuration(v)
+		switch {
+		case err != nil:
+			verr.add("timeout", "must be a duration (e.g. 600 or 10m)")
+		case d < min:
+			verr.add("timeout", fmt.Sprintf("must be at least %s", min))
+		case d > max:
+			verr.add("timeout", fmt.Sprintf("must be at most %s", max))
+		default:
+			p.Timeout = d
+		}
+	}
+
+	if v := field("max_routes"); v != "" {
+		ceiling := maxRoutesCeiling(cfg)
+		n, err := strconv.Atoi(v)
+		switch {
+		case err != nil || n < 1:
+			verr.add("max_routes", "must be a positive integer")
+		case n > ceiling:
+			verr.add("max_routes", fmt.Sprintf("must be at most %d (MAX_ROUTES_CEILING)", ceiling))
+		default:
+			p.MaxRoutes = n
+		}
+	}
+
+	if v := field("retain"); v != "" {
+		// Больше RETAIN_MAX не храним: значение молча урезается до потолка.
+		max := cfg.getDuration("RETAIN_MAX", 7*24*time.Hour)
+		d, err := parseDuration(v)
+		switch {
+		case err != nil || d <= 0:
+			verr.add("retain", "must be a positive duration (e.g. 3600 or 24h)")
+		case max > 0 && d > max:
+			p.Retain = max
+		default:
+			p.Retain = d
+		}
+	}
+
+	conditional := false
+	if v := field("conditional_quantum"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			verr.add("conditional_quantum", "must be a boolean")
+		}
+		conditional = b
+	}
+	target := field("quantum_target_cost")
+	switch {
+	case conditional && target == "":
+		verr.add("quantum_target_cost", "is required with conditional_quantum")
+	case conditional && len(p.RerouteFractions) > 1:
+		verr.add("conditional_quantum", "cannot be combined with a reroute_fractions sweep")
+	case conditional:
+		f, err := strconv.ParseFloat(target, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			verr.add("quantum_target_cost", "must be a number")
+		} else {
+			p.QuantumTarget = &f
+		}
+	case target != "":
+		verr.add("quantum_target_cost", "is only used with conditional_quantum")
+	}
+
+	if labels, err := parseLabels(cfg, r.Form["labels"]); err != nil {
+		verr.add("labels", err.Error())
+	} else {
+		p.Labels = labels
+	}
+
+	if env, err := parseEnvOverrides(cfg, r.Form["env_overrides"]); err != nil {
+		verr.add("env_overrides", err.Error())
+	} else {
+		p.EnvOverrides = env
+	}
+
+	p.Async = cfg.get("ASYNC_BY_DEFAULT", "") == "1"
+	if v := field("sync"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			verr.add("sync", "must be a boolean")
+		}
+		p.Async = !b
+	}
+	if p.Async && (len(p.RerouteFractions) > 1 || p.QuantumTarget != nil) {
+		verr.add("sync", "async mode supports single runs only (no sweep or conditional_quantum)")
+	}
+
+	// strict_params (или STRICT_PARAMS=1) — незнакомые поля формы считаются
+	// ошибкой, чтобы опечатки вроде "itterations" не терялись молча.
+	strict := cfg.get("STRICT_PARAMS", "") == "1"
+	if v := field("strict_params"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			verr.add("strict_params", "must be a boolean")
+		}
+		strict = strict || b
+	}
+	if strict {
+		for _, k := range formFields(r) {
+			if !slices.Contains(knownFormFields, k) {
+				verr.add(k, "unknown parameter")
+			}
+		}
+	}
+
+	if len(verr.Fields) > 0 {
+		return p, verr
+	}
+	return p, nil
+}
+
+// knownFormFields — все поля формы, которые понимает /process.
+var knownFormFields = []string{
+	"file", "source_url", "p_layers", "dedupe", "preview", "team", "seed",
+	"reroute_fractions", "timeout", "max_routes", "retain",
+	"conditional_quantum", "quantum_target_cost", "strict_params", "sync",
+	"labels", "env_overrides",
+}
+
+// parseEnvOverrides разбирает поле env_overrides (см. parseKeyValues):
+// переменные окружения runner.py для одной задачи. Разрешены только ключи
+// из ENV_OVERRIDE_ALLOWLIST; значения известных настроек проверяются по
+// их типу, как в CONFIG_FILE.
+func parseEnvOverrides(cfg settings, values []string) (map[string]string, error) {
+	env, err := parseKeyValues(values)
+	if err != nil || len(env) == 0 {
+		return nil, err
+	}
+	allowed := splitList(cfg.get("ENV_OVERRIDE_ALLOWLIST", ""))
+	keys := slices.Sorted(maps.Keys(env))
+	for _, k := range keys {
+		if !slices.Contains(allowed, k) {
+			return nil, fmt.Errorf("%s is not allowed (ENV_OVERRIDE_ALLOWLIST)", truncate(k, 64))
+		}
+		if kind, ok := configKeys[k]; ok {
+			if err := checkConfigValue(kind, env[k]); err != nil {
+				return nil, fmt.Errorf("%s: %v", k, err)
+			}
+		}
+	}
+	return env, nil
+}
+
+var labelKeyRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// parseKeyValues разбирает поле формы вида «JSON-объект со строковыми
+// значениями или повторяющиеся key=value».
+func parseKeyValues(values []string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		switch {
+		case v == "":
+			continue
+		case strings.HasPrefix(v, "{"):
+			var obj map[string]string
+			if err := json.Unmarshal([]byte(v), &obj); err != nil {
+				return nil, fmt.Errorf("must be a JSON object of strings or key=value")
+			}
+			maps.Copy(out, obj)
+		default:
+			k, val, ok := strings.Cut(v, "=")
+			if !ok {
+				return nil, fmt.Errorf("%q is not key=value", truncate(v, 64))
+			}
+			out[strings.TrimSpace(k)] = strings.TrimSpace(val)
+		}
+	}
+	return out, nil
+}
+
+// parseLabels разбирает поле labels (см. parseKeyValues). Число меток
+// ограничено MAX_LABELS, длина значения — LABEL_VALUE_MAX_BYTES.
+func parseLabels(cfg settings, values []string) (map[string]string, error) {
+	labels, err := parseKeyValues(values)
+	if err != nil {
+		return nil, err
+	}
+	if max := cfg.getInt("MAX_LABELS", 16); len(labels) > max {
+		return nil, fmt.Errorf("at most %d labels are allowed", max)
+	}
+	maxValue := cfg.getInt("LABEL_VALUE_MAX_BYTES", 256)
+	for k, v := range labels {
+		if !labelKeyRe.MatchString(k) {
+			return nil, fmt.Errorf("label key %q must be 1..64 characters of A-Z, a-z, 0-9, _ . -", truncate(k, 64))
+		}
+		if len(v) > maxValue {
+			return nil, fmt.Errorf("label %s is longer than %d bytes", k, maxValue)
+		}
+	}
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return labels, nil
+}
+
+// formFields — имена полей тела запроса (без query-параметров вроде
+// ?pretty=1). В режиме --process формы тела нет, берётся r.Form.
+func formFields(r *http.Request) []string {
+	var keys []string
+	if r.MultipartForm != nil {
+		for k := range r.MultipartForm.Value {
+			keys = append(keys, k)
+		}
+		for k := range r.MultipartForm.File {
+			keys = append(keys, k)
+		}
+	} else if r.PostForm != nil {
+		for k := range r.PostForm {
+			keys = append(keys, k)
+		}
+	} else {
+		for k := range r.Form {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
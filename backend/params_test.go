@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// parseForm вызывает parseParams с полями формы, как oneshot.
+func parseForm(form url.Values) (solverParams, error) {
+	return parseParams(&http.Request{Form: form})
+}
+
+func TestParsePLayers(t *testing.T) {
+	t.Setenv("P_LAYERS_MAX", "4")
+	tests := []struct {
+		value string
+		want  int // 0 — значение отклоняется
+	}{
+		{"", 1},
+		{"1", 1},
+		{"3", 3},
+		{"4", 4},
+		{"5", 0},
+		{"0", 0},
+		{"-1", 0},
+		{"two", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			p, err := parseForm(url.Values{"p_layers": {tt.value}})
+			if tt.want == 0 {
+				var verr *validationError
+				if !errors.As(err, &verr) || verr.Fields["p_layers"] == "" {
+					t.Fatalf("parseParams = %v, want a p_layers error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := newEffectiveParameters(p)
+			args := e.args("runner.py", "in.csv")
+			if p.PLayers != tt.want || e.PLayers != tt.want {
+				t.Errorf("PLayers = %d (effective %d), want %d", p.PLayers, e.PLayers, tt.want)
+			}
+			if i := slices.Index(args, "--p-layers"); i < 0 || args[i+1] != strconv.Itoa(tt.want) {
+				t.Errorf("args = %q, want --p-layers %d", args, tt.want)
+			}
+		})
+	}
+
+	_, err := parseForm(url.Values{"p_layers": {"9"}})
+	if err == nil || !strings.Contains(err.Error(), "1..4") || !strings.Contains(err.Error(), "quantum circuit") {
+		t.Errorf("over-ceiling error = %v, want the limit and the quantum cost explanation", err)
+	}
+}
+
+func TestParseParamsAggregatesErrors(t *testing.T) {
+	t.Setenv("P_LAYERS_MAX", "4")
+	t.Setenv("MAX_ROUTES_CEILING", "500")
+	tests := []struct {
+		name   string
+		form   url.Values
+		fields []string
+	}{
+		{"single", url.Values{"p_layers": {"0"}}, []string{"p_layers"}},
+		{
+			"several",
+			url.Values{"p_layers": {"11"}, "max_routes": {"1000"}, "dedupe": {"maybe"}, "timeout": {"soon"}},
+			[]string{"dedupe", "max_routes", "p_layers", "timeout"},
+		},
+		{
+			"valid fields are not reported",
+			url.Values{"p_layers": {"2"}, "max_routes": {"abc"}, "seed": {"-1"}},
+			[]string{"max_routes", "seed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseForm(tt.form)
+			var verr *validationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("parseParams = %v, want *validationError", err)
+			}
+			got := make([]string, 0, len(verr.Fields))
+			for k := range verr.Fields {
+				got = append(got, k)
+			}
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.fields) {
+				t.Errorf("fields = %v, want %v", got, tt.fields)
+			}
+			for _, f := range tt.fields {
+				if !strings.Contains(err.Error(), f+": ") {
+					t.Errorf("error %q does not mention %s", err, f)
+				}
+			}
+		})
+	}
+
+	t.Run("http", func(t *testing.T) {
+		rec := postProcess(t, url.Values{"p_layers": {"0"}, "seed": {"x"}}, "in.csv", "a,b\n1,2\n", nil)
+		body := decodeBody(t, rec, http.StatusBadRequest)
+		e, _ := body["error"].(map[string]any)
+		fields, _ := e["fields"].(map[string]any)
+		if e["code"] != "validation" || fields["p_layers"] == nil || fields["seed"] == nil {
+			t.Errorf("body = %v, want a validation error with p_layers and seed", body)
+		}
+	})
+}
+
+func TestSeedPassthrough(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	tests := []struct {
+		name, seed, autoSeed string
+		want                 any // nil — без --seed
+	}{
+		{"explicit", "42", "", "42"},
+		{"zero", "0", "", "0"},
+		{"max uint32", "4294967295", "", "4294967295"},
+		{"absent", "", "", nil},
+		{"auto", "", "1", ""}, // любое сгенерированное значение
+		{"explicit beats auto", "7", "1", "7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AUTO_SEED", tt.autoSeed)
+			form := url.Values{}
+			if tt.seed != "" {
+				form.Set("seed", tt.seed)
+			}
+			got := decodeBody(t, postProcess(t, form, "in.csv", "a,b\n1,2\n", nil), http.StatusOK)
+			var argv []string
+			for _, a := range got["summary"].(map[string]any)["argv"].([]any) {
+				argv = append(argv, a.(string))
+			}
+			reported := got["parameters"].(map[string]any)["seed"]
+			i := slices.Index(argv, "--seed")
+			if tt.want == nil {
+				if i >= 0 || reported != nil {
+					t.Errorf("argv %q, reported seed %v, want no seed", argv, reported)
+				}
+				return
+			}
+			if i < 0 {
+				t.Fatalf("argv %q has no --seed", argv)
+			}
+			// Сообщённый seed совпадает с переданным runner.py.
+			if reported == nil || strconv.FormatFloat(reported.(float64), 'f', -1, 64) != argv[i+1] {
+				t.Errorf("reported seed %v, argv seed %s", reported, argv[i+1])
+			}
+			if tt.want != "" && argv[i+1] != tt.want {
+				t.Errorf("--seed %s, want %s", argv[i+1], tt.want)
+			}
+		})
+	}
+
+	for _, bad := range []string{"-1", "4294967296", "1.5", "x"} {
+		if _, err := parseForm(url.Values{"seed": {bad}}); err == nil {
+			t.Errorf("seed=%s accepted", bad)
+		}
+	}
+}
+
+// TestFieldOrder: поля формы действуют и до, и после части с файлом.
+func TestFieldOrder(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("p_layers", "3")
+	fw, _ := mw.CreateFormFile("file", "in.csv")
+	io.WriteString(fw, "a,b\n1,2\n")
+	mw.WriteField("seed", "9")
+	mw.WriteField("max_routes", "17")
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/process", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	process(rec, req)
+
+	got := decodeBody(t, rec, http.StatusOK)
+	var argv []string
+	for _, a := range got["summary"].(map[string]any)["argv"].([]any) {
+		argv = append(argv, a.(string))
+	}
+	for flag, want := range map[string]string{"--p-layers": "3", "--seed": "9", "--max-routes": "17"} {
+		if i := slices.Index(argv, flag); i < 0 || argv[i+1] != want {
+			t.Errorf("argv %q: want %s %s", argv, flag, want)
+		}
+	}
+}
+
+func TestParseMaxRoutes(t *testing.T) {
+	t.Setenv("MAX_ROUTES_CEILING", "500")
+	tests := []struct {
+		value string
+		want  int // 0 — значение отклоняется
+	}{
+		{"", 500}, // без поля действует потолок, а не зашитые 999999
+		{"1", 1},
+		{"500", 500},
+		{"501", 0},
+		{"0", 0},
+		{"-3", 0},
+		{"many", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			p, err := parseForm(url.Values{"max_routes": {tt.value}})
+			if tt.want == 0 {
+				var verr *validationError
+				if !errors.As(err, &verr) || verr.Fields["max_routes"] == "" {
+					t.Fatalf("parseParams = %v, want a max_routes error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := newEffectiveParameters(p).args("runner.py", "in.csv")
+			if i := slices.Index(args, "--max-routes"); i < 0 || args[i+1] != strconv.Itoa(tt.want) {
+				t.Errorf("args = %q, want --max-routes %d", args, tt.want)
+			}
+		})
+	}
+
+	_, err := parseForm(url.Values{"max_routes": {"1000"}})
+	if err == nil || !strings.Contains(err.Error(), "at most 500") {
+		t.Errorf("over-ceiling error = %v, want the ceiling in the message", err)
+	}
+	rec := httptest.NewRecorder()
+	capabilities(rec, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	if limits := decodeBody(t, rec, http.StatusOK)["limits"].(map[string]any); limits["max_routes_ceiling"] != float64(500) {
+		t.Errorf("capabilities max_routes_ceiling = %v", limits["max_routes_ceiling"])
+	}
+}
+
+func TestStrictParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		form    url.Values
+		unknown string // "" — запрос принимается
+	}{
+		{"lenient by default", "", url.Values{"itterations": {"5"}}, ""},
+		{"strict field", "", url.Values{"itterations": {"5"}, "strict_params": {"1"}}, "itterations"},
+		{"strict setting", "1", url.Values{"itterations": {"5"}}, "itterations"},
+		{"known fields pass", "1", url.Values{"p_layers": {"1"}, "team": {"x"}}, ""},
+		// Поле не может ослабить STRICT_PARAMS сервера.
+		{"field cannot relax setting", "1", url.Values{"foo": {"1"}, "strict_params": {"0"}}, "foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STRICT_PARAMS", tt.env)
+			_, err := parseForm(tt.form)
+			var verr *validationError
+			errors.As(err, &verr)
+			if tt.unknown == "" {
+				if err != nil {
+					t.Fatalf("rejected: %v", err)
+				}
+				return
+			}
+			if verr == nil || verr.Fields[tt.unknown] != "unknown parameter" {
+				t.Errorf("err = %v, want %s reported as unknown", err, tt.unknown)
+			}
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	t.Setenv("MAX_LABELS", "2")
+	t.Setenv("LABEL_VALUE_MAX_BYTES", "8")
+	tests := []struct {
+		name   string
+		values []string
+		want   map[string]string
+		err    bool
+	}{
+		{"none", nil, nil, false},
+		{"pairs", []string{"team=ops", " env = prod "}, map[string]string{"team": "ops", "env": "prod"}, false},
+		{"json", []string{`{"team":"ops"}`, "env=prod"}, map[string]string{"team": "ops", "env": "prod"}, false},
+		{"empty value", []string{"team="}, map[string]string{"team": ""}, false},
+		{"not a pair", []string{"team"}, nil, true},
+		{"bad json", []string{`{"team":1}`}, nil, true},
+		{"bad key", []string{"te am=ops"}, nil, true},
+		{"too many", []string{"a=1", "b=2", "c=3"}, nil, true},
+		{"value too long", []string{"team=operations"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLabels(settings{}, tt.values)
+			if (err != nil) != tt.err || !maps.Equal(got, tt.want) {
+				t.Errorf("parseLabels(%q) = %v, %v", tt.values, got, err)
+			}
+		})
+	}
+
+	// Ошибка меток попадает в общий список ошибок полей.
+	_, err := parseForm(url.Values{"labels": {"team"}})
+	var verr *validationError
+	if !errors.As(err, &verr) || !strings.Contains(err.Error(), "labels") {
+		t.Errorf("parseParams error = %v, want a labels field error", err)
+	}
+}
+
+func TestParseEnvOverrides(t *testing.T) {
+	t.Setenv("ENV_OVERRIDE_ALLOWLIST", "MIREA_SHOTS, FEATURE_X")
+	tests := []struct {
+		name    string
+		values  []string
+		want    map[string]string
+		wantErr string // пусто — ошибки быть не должно
+	}{
+		{"empty", nil, nil, ""},
+		{"key=value", []string{"MIREA_SHOTS=256"}, map[string]string{"MIREA_SHOTS": "256"}, ""},
+		{"json", []string{`{"MIREA_SHOTS":"64","FEATURE_X":"on"}`}, map[string]string{"MIREA_SHOTS": "64", "FEATURE_X": "on"}, ""},
+		{"not allowlisted", []string{"MIREA_PASSWORD=x"}, nil, "MIREA_PASSWORD is not allowed"},
+		{"one bad key rejects all", []string{"MIREA_SHOTS=1", "PATH=/tmp"}, nil, "PATH is not allowed"},
+		{"bad int", []string{"MIREA_SHOTS=lots"}, nil, "MIREA_SHOTS: "},
+		{"malformed", []string{"MIREA_SHOTS"}, nil, "key=value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEnvOverrides(snapshotSettings(), tt.values)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseEnvOverrides = %v, %v; want error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("parseEnvOverrides = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("form field", func(t *testing.T) {
+		_, err := parseForm(url.Values{"env_overrides": {"MIREA_EMAIL=a@b"}})
+		var verr *validationError
+		if !errors.As(err, &verr) || verr.Fields["env_overrides"] == "" {
+			t.Fatalf("parseParams = %v, want an env_overrides error", err)
+		}
+	})
+	t.Run("empty allowlist", func(t *testing.T) {
+		t.Setenv("ENV_OVERRIDE_ALLOWLIST", "")
+		if _, err := parseEnvOverrides(snapshotSettings(), []string{"MIREA_SHOTS=1"}); err == nil {
+			t.Error("override accepted with an empty allowlist")
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// preprocessInput прогоняет входной файл через PREPROCESS_CMD, если он
+// задан: команда получает путь к файлу последним аргументом, пишет
+// преобразованный файл и печатает его путь последней строкой stdout
+// (относительный путь — от рабочего каталога задачи). Возвращает путь,
+// который станет входом оптимизатора. Работает под тем же таймаутом и
+// занимает слот runSlots, как и сам runner.
+func preprocessInput(ctx context.Context, cfg settings, inputPath, workDir string) (string, error) {
+	command := strings.Fields(cfg.get("PREPROCESS_CMD", ""))
+	if len(command) == 0 {
+		return inputPath, nil
+	}
+	out, err := runFileHook(ctx, cfg, "preprocess", command, inputPath, workDir)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Preprocessed %s -> %s", filepath.Base(inputPath), filepath.Base(out))
+	return out, nil
+}
+
+// postprocessResult прогоняет файл результата через POSTPROCESS_CMD до
+// сохранения в store — по тому же протоколу, что и PREPROCESS_CMD.
+// Данные пишутся во временный файл в workDir; возвращается содержимое
+// файла, путь к которому напечатала команда.
+func postprocessResult(ctx context.Context, cfg settings, name string, data []byte, workDir string) ([]byte, error) {
+	command := strings.Fields(cfg.get("POSTPROCESS_CMD", ""))
+	if len(command) == 0 {
+		return data, nil
+	}
+	dir, err := os.MkdirTemp(workDir, "post-*")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, safeName(name, "result.csv"))
+	if err := os.WriteFile(path, data, tempFileMode); err != nil {
+		return nil, err
+	}
+	out, err := runFileHook(ctx, cfg, "postprocess", command, path, dir)
+	if err != nil {
+		return nil, err
+	}
+	return readResultFile(out)
+}
+
+// runFileHook запускает команду-хук с путём к файлу последним аргументом
+// и возвращает путь из последней строки её stdout.
+func runFileHook(ctx context.Context, cfg settings, stage string, command []string, path, workDir string) (string, error) {
+	release, err := acquireRunSlot(ctx)
+	if err != nil {
+		return "", hookError(ctx, stage, err)
+	}
+	defer release()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], append(command[1:], path)...)
+	cmd.Dir = workDir
+	cmd.Env = subprocessEnv(cfg, os.Environ())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		log.Printf("Hook command (%s) failed: %v: %s", stage, err, truncate(stderr.String(), 1000))
+		return "", hookError(ctx, stage, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	out := strings.TrimSpace(lines[len(lines)-1])
+	if out == "" {
+		return "", &runError{Status: http.StatusInternalServerError, Message: stage + " command printed no output path"}
+	}
+	if !filepath.IsAbs(out) {
+		out = filepath.Join(workDir, out)
+	}
+	if !fileExists(out) {
+		return "", &runError{Status: http.StatusInternalServerError, Message: fmt.Sprintf("%s output %s not found", stage, filepath.Base(out))}
+	}
+	return out, nil
+}
+
+func hookError(ctx context.Context, stage string, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &runError{Status: http.StatusGatewayTimeout, Code: "timeout", Message: stage + " did not finish within the request timeout"}
+	}
+	return &runError{Status: http.StatusInternalServerError, Message: stage + " failed: " + err.Error()}
+}
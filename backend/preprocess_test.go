@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPreprocessCmd(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	// Хук пишет рядом файл в верхнем регистре и печатает его имя.
+	hook := writeScript(t, `import sys
+src = sys.argv[1]
+open("upper.csv", "w").write(open(src).read().upper())
+print("log line")
+print("upper.csv")
+`)
+	tests := []struct {
+		name   string
+		cmd    string
+		status int
+		want   string
+	}{
+		{"no hook", "", http.StatusOK, "a,b\n1,2\n"},
+		{"relative output", "python3 " + hook, http.StatusOK, "A,B\n1,2\n"},
+		{"hook fails", "false", http.StatusInternalServerError, ""},
+		{"no output path", "true", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PREPROCESS_CMD", tt.cmd)
+			rec := postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil)
+			if tt.status != http.StatusOK {
+				if rec.Code != tt.status {
+					t.Errorf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+				}
+				return
+			}
+			got := decodeBody(t, rec, tt.status)
+			stored, ok := store.Peek(got["downloads"].(map[string]any)["classic_csv"].(string))
+			if !ok || string(stored.Data) != tt.want {
+				t.Errorf("runner input = %q, want %q", stored.Data, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostprocessCmd(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	hook := writeScript(t, `import os, sys
+src = sys.argv[1]
+dst = os.path.join(os.path.dirname(src), "out.csv")
+open(dst, "w").write(os.path.basename(src) + ":" + open(src).read().upper())
+print(dst)
+`)
+	t.Setenv("POSTPROCESS_CMD", "python3 "+hook)
+	got := decodeBody(t, postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil), http.StatusOK)
+	downloads := got["downloads"].(map[string]any)
+	// Хук получает каждый файл под его именем; имя в store остаётся прежним.
+	for key, want := range map[string]string{
+		"classic_csv": "classic.csv:A,B\n1,2\n",
+		"quantum_csv": "quantum.csv:ROUTE,COST\n1,2\n",
+	} {
+		rec, ok := store.Peek(downloads[key].(string))
+		if !ok || string(rec.Data) != want {
+			t.Errorf("%s = %q, want %q", key, rec.Data, want)
+		}
+	}
+
+	t.Setenv("POSTPROCESS_CMD", "false")
+	if rec := postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil); rec.Code != http.StatusInternalServerError {
+		t.Errorf("failing hook: status %d, want 500", rec.Code)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Ограничения превью, чтобы ответ /process оставался маленьким;
+// постраничный /preview отдаёт окна побольше.
+const (
+	previewMaxRows     = 100
+	previewPageMaxRows = 1000
+	previewMaxColumns  = 50
+	previewMaxCell     = 200
+)
+
+// csvPreview — окно строк файла результата для показа до скачивания.
+type csvPreview struct {
+	Columns   []string   `json:"columns"`
+	Rows      [][]string `json:"rows"`
+	Truncated bool       `json:"truncated"`
+	// NextOffset — смещение следующего окна, если строки ещё есть.
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+// buildPreviews читает начало каждого сохранённого файла; ключи те же,
+// что в карте downloads.
+func buildPreviews(downloads map[string]string, n int) map[string]csvPreview {
+	n = min(max(n, 1), previewMaxRows)
+	out := map[string]csvPreview{}
+	for key, id := range downloads {
+		rec, ok := store.Peek(id)
+		if !ok {
+			continue
+		}
+		src, err := rec.reader()
+		if err != nil {
+			continue
+		}
+		p, err := previewCSV(src, n)
+		src.Close()
+		if err == nil {
+			out[key] = p
+		}
+	}
+	return out
+}
+
+func previewCSV(src io.Reader, n int) (csvPreview, error) {
+	return previewWindow(src, 0, n)
+}
+
+// previewWindow разбирает заголовок и n строк данных начиная с offset
+// (строки до offset читаются и отбрасываются, файл в память целиком не
+// загружается).
+func previewWindow(src io.Reader, offset, n int) (csvPreview, error) {
+	cr := csv.NewReader(src)
+	cr.ReuseRecord = true
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	p := csvPreview{Rows: [][]string{}}
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		p.Columns = []string{}
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+	p.Columns = p.clip(header)
+	for i := 0; ; i++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return p, nil
+		}
+		if err != nil {
+			return p, err
+		}
+		if i < offset {
+			continue
+		}
+		if len(p.Rows) == n {
+			next := offset + n
+			p.Truncated, p.NextOffset = true, &next
+			return p, nil
+		}
+		p.Rows = append(p.Rows, p.clip(row))
+	}
+}
+
+// previewPage — GET /preview?id=&offset=&limit=: окно строк сохранённого
+// CSV в JSON для постраничного просмотра больших результатов.
+func previewPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	id := q.Get("id")
+	if !downloadIDRe.MatchString(id) {
+		http.Error(w, "malformed id", http.StatusBadRequest)
+		return
+	}
+	offset, limit := 0, getenvInt("PREVIEW_ROWS", 20)
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	limit = min(limit, previewPageMaxRows)
+
+	rec, ok := store.Peek(id)
+	if !ok || rec.Tenant != tenantOf(r) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	src, err := rec.reader()
+	if err != nil {
+		http.Error(w, "malformed stored csv: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer src.Close()
+	p, err := previewWindow(src, offset, limit)
+	if err != nil {
+		http.Error(w, "malformed stored csv: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Offset int    `json:"offset"`
+		Limit  int    `json:"limit"`
+		csvPreview
+	}{id, rec.Name, offset, limit, p})
+}
+
+// clip обрезает слишком широкие строки и длинные ячейки.
+func (p *csvPreview) clip(row []string) []string {
+	if len(row) > previewMaxColumns {
+		row = row[:previewMaxColumns]
+		p.Truncated = true
+	}
+	out := make([]string, len(row))
+	for i, c := range row {
+		if len(c) > previewMaxCell {
+			c = strings.ToValidUTF8(c[:previewMaxCell], "")
+			p.Truncated = true
+		}
+		out[i] = c
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPreviewInResponse(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	t.Setenv("PREVIEW_ROWS", "2")
+	input := "a,b\n1,2\n3,4\n5,6\n"
+
+	got := decodeBody(t, postProcess(t, nil, "in.csv", input, nil), http.StatusOK)
+	if _, ok := got["previews"]; ok {
+		t.Fatal("previews returned without preview=1")
+	}
+
+	got = decodeBody(t, postProcess(t, url.Values{"preview": {"1"}}, "in.csv", input, nil), http.StatusOK)
+	previews := got["previews"].(map[string]any)
+	for key := range got["downloads"].(map[string]any) {
+		if _, ok := previews[key]; !ok {
+			t.Errorf("no preview for download %s", key)
+		}
+	}
+	p := previews["classic_csv"].(map[string]any)
+	if cols := p["columns"].([]any); len(cols) != 2 || cols[0] != "a" {
+		t.Errorf("columns = %v", cols)
+	}
+	if rows := p["rows"].([]any); len(rows) != 2 || p["truncated"] != true {
+		t.Errorf("rows = %v, truncated = %v; want 2 rows, truncated", rows, p["truncated"])
+	}
+}
+
+func TestPreviewCSVClip(t *testing.T) {
+	wide := strings.Repeat("c,", previewMaxColumns+5) + "c\n"
+	long := "x\n" + strings.Repeat("я", previewMaxCell) + "\n"
+	tests := []struct {
+		name      string
+		in        string
+		cols      int
+		cell      int
+		truncated bool
+	}{
+		{"small", "a,b\n1,2\n", 2, 0, false},
+		{"empty", "", 0, 0, false},
+		{"too many columns", wide, previewMaxColumns, 0, true},
+		{"long cell", long, 1, previewMaxCell, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := previewCSV(strings.NewReader(tt.in), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(p.Columns) != tt.cols || p.Truncated != tt.truncated {
+				t.Errorf("columns %d truncated %v, want %d %v", len(p.Columns), p.Truncated, tt.cols, tt.truncated)
+			}
+			if tt.cell > 0 {
+				// Ячейка обрезается по байтам, но остаётся валидным UTF-8.
+				cell := p.Rows[0][0]
+				if len(cell) > tt.cell || !strings.HasPrefix(strings.Repeat("я", previewMaxCell), cell) {
+					t.Errorf("cell of %d bytes not clipped cleanly", len(cell))
+				}
+			}
+		})
+	}
+}
+
+func TestPreviewPage(t *testing.T) {
+	defer func(s *resultStore) { store = s }(store)
+	store = newResultStore(10)
+	id, other := genID(), genID()
+	store.Store(id, newRecord("classic.csv", []byte("n\n0\n1\n2\n3\n4\n"), ""))
+	store.Store(other, newRecord("classic.csv", []byte("n\n0\n"), "team-a"))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		previewPage(rec, httptest.NewRequest(http.MethodGet, "/preview?"+query, nil))
+		return rec
+	}
+	tests := []struct {
+		query string
+		rows  []string
+		next  any
+	}{
+		{"limit=2", []string{"0", "1"}, 2.0},
+		{"offset=2&limit=2", []string{"2", "3"}, 4.0},
+		{"offset=4&limit=2", []string{"4"}, nil},
+		{"offset=10", []string{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := decodeBody(t, get("id="+id+"&"+tt.query), http.StatusOK)
+			var rows []string
+			for _, r := range got["rows"].([]any) {
+				rows = append(rows, r.([]any)[0].(string))
+			}
+			if strings.Join(rows, ",") != strings.Join(tt.rows, ",") || got["next_offset"] != tt.next {
+				t.Errorf("rows %v next %v, want %v next %v", rows, got["next_offset"], tt.rows, tt.next)
+			}
+		})
+	}
+
+	for query, want := range map[string]int{
+		"id=bad":                  http.StatusBadRequest,
+		"id=" + id + "&offset=-1": http.StatusBadRequest,
+		"id=" + id + "&limit=0":   http.StatusBadRequest,
+		"id=" + genID():           http.StatusNotFound,
+		"id=" + other:             http.StatusNotFound, // чужой tenant
+	} {
+		if rec := get(query); rec.Code != want {
+			t.Errorf("%s: status %d, want %d", query, rec.Code, want)
+		}
+	}
+}
@@ -94,8 +94,19 @@ def main():
     parser.add_argument('--p-layers', type=int, default=1)
     parser.add_argument('--max-routes', type=int, default=999999)
     parser.add_argument('--workers', type=int, default=4)
+    parser.add_argument('--output-dir', default='')
+    parser.add_argument('--seed', type=int, default=None)
     args = parser.parse_args()
 
+    # Идентификаторы задачи от сервера — для сопоставления логов
+    job_id = os.environ.get('JOB_ID', '')
+    if job_id:
+        print(f"[job {job_id} request {os.environ.get('REQUEST_ID', '-')}] runner started", file=sys.stderr)
+
+    if args.seed is not None:
+        random.seed(args.seed)
+        np.random.seed(args.seed)
+
     mirea_client = None
     if args.use_mirea and MIREAQuantumAdapter and args.mirea_email and args.mirea_password:
         mc = MIREAQuantumAdapter(email=args.mirea_email, password=args.mirea_password)
@@ -108,6 +119,7 @@ def main():
     results = []
     classic_records = []   # для classic.csv
     quantum_records = []   # для quantum.csv
+    convergence = []       # история стоимости по итерациям для каждого графа
     total_mirea_calls = 0
 
     optimizer = EnhancedTrafficOptimizer()
@@ -126,6 +138,14 @@ def main():
             reroute_fraction=args.reroute_fraction
         )
 
+        convergence.append({
+            "graph_index": graph_original_index,
+            "history": [
+                {"iteration": h['iteration'], "cost": float(h['cost']) if np.isfinite(h['cost']) else None}
+                for h in classical_result.get('cost_history', [])
+            ],
+        })
+
         # classic.csv записи
         for driver_idx, path in enumerate(classical_result['final_paths']):
             classic_records.append({
@@ -201,26 +221,30 @@ def main():
         df.to_csv(io_obj, index=False)
         return base64.b64encode(io_obj.getvalue().encode('utf-8')).decode('utf-8')
 
-    csv_files = [
-        {"name": "classic.csv", "base64": to_b64_csv(classic_df)},
-        {"name": "quantum.csv", "base64": to_b64_csv(quantum_df)},
-    ]
+    outputs = [("classic.csv", classic_df), ("quantum.csv", quantum_df)]
 
     output_json = {
         'ok': True,
         'mode': 'hybrid_with_full_graph',
         'results': results,
+        'convergence': convergence,
         'summary': {
             'total_graphs': len(results),
             'solver_iterations': args.iterations,
             'mirea_samples_requested': args.mirea_samples,
             'total_mirea_calls_made': total_mirea_calls
         },
-        # новый массив файлов (обратная совместимость поддерживается в Go)
-        'csv_files': csv_files,
-        # старые поля можно опустить; main.go обрабатывает новый формат
     }
 
+    if args.output_dir:
+        # файлы на диске, в JSON только относительные пути (main.go читает их сам)
+        for name, df in outputs:
+            df.to_csv(os.path.join(args.output_dir, name), index=False)
+        output_json['results_files'] = [name for name, _ in outputs]
+    else:
+        # новый массив файлов (обратная совместимость поддерживается в Go)
+        output_json['csv_files'] = [{"name": name, "base64": to_b64_csv(df)} for name, df in outputs]
+
     print(json.dumps(output_json, ensure_ascii=False, allow_nan=False))
     return 0
 
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// missLimiter считает неудачные скачивания (400/404) по IP и временно
+// блокирует клиентов, перебирающих id.
+type missLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	block  time.Duration
+	byIP   map[string]*missEntry
+}
+
+type missEntry struct {
+	count        int
+	windowStart  time.Time
+	blockedUntil time.Time
+}
+
+func newMissLimiter(limit int, window, block time.Duration) *missLimiter {
+	return &missLimiter{limit: limit, window: window, block: block, byIP: make(map[string]*missEntry)}
+}
+
+// SetLimits меняет лимит и окна; уже накопленные промахи сохраняются.
+func (l *missLimiter) SetLimits(limit int, window, block time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit, l.window, l.block = limit, window, block
+}
+
+func (l *missLimiter) Blocked(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit <= 0 {
+		return false
+	}
+	e, ok := l.byIP[ip]
+	return ok && time.Now().Before(e.blockedUntil)
+}
+
+// Miss фиксирует промах; при превышении лимита в окне IP блокируется.
+func (l *missLimiter) Miss(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit <= 0 {
+		return
+	}
+	now := time.Now()
+	if len(l.byIP) > 1024 {
+		for k, e := range l.byIP {
+			if now.Sub(e.windowStart) > l.window && now.After(e.blockedUntil) {
+				delete(l.byIP, k)
+			}
+		}
+	}
+	e, ok := l.byIP[ip]
+	if !ok {
+		e = &missEntry{windowStart: now}
+		l.byIP[ip] = e
+	} else if now.Sub(e.windowStart) > l.window {
+		e.count = 0
+		e.windowStart = now
+	}
+	e.count++
+	if e.count >= l.limit {
+		e.blockedUntil = now.Add(l.block)
+		e.count = 0
+		e.windowStart = now
+	}
+}
+
+// ipSlots ограничивает число одновременных скачиваний с одного IP,
+// независимо от частоты запросов. max <= 0 — без ограничения.
+type ipSlots struct {
+	mu     sync.Mutex
+	max    int
+	active map[string]int
+}
+
+func newIPSlots(max int) *ipSlots {
+	return &ipSlots{max: max, active: make(map[string]int)}
+}
+
+// SetMax меняет лимит; занятые слоты освобождаются как обычно.
+func (s *ipSlots) SetMax(max int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.max = max
+}
+
+// Acquire занимает слот; release нужно вызвать по окончании скачивания.
+func (s *ipSlots) Acquire(ip string) (release func(), ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.max <= 0 {
+		return func() {}, true
+	}
+	if s.active[ip] >= s.max {
+		return nil, false
+	}
+	s.active[ip]++
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.active[ip]--; s.active[ip] <= 0 {
+			delete(s.active, ip)
+		}
+	}, true
+}
+
+// pollLimiter — token bucket на пару (IP, job) для /status: клиент может
+// опрашивать задачу не чаще rate раз в секунду с запасом burst.
+// rate <= 0 — без ограничения.
+type pollLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	byPoll map[pollKey]*pollBucket
+}
+
+type pollKey struct{ ip, job string }
+
+type pollBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newPollLimiter(rate float64, burst int) *pollLimiter {
+	return &pollLimiter{rate: rate, burst: float64(max(burst, 1)), byPoll: make(map[pollKey]*pollBucket)}
+}
+
+// SetRate меняет частоту и запас; накопленные токены урезаются до burst.
+func (l *pollLimiter) SetRate(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate, l.burst = rate, float64(max(burst, 1))
+	for _, b := range l.byPoll {
+		b.tokens = min(b.tokens, l.burst)
+	}
+}
+
+// Allow списывает один опрос; false — лимит исчерпан.
+func (l *pollLimiter) Allow(ip, job string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	if len(l.byPoll) > 4096 {
+		for k, b := range l.byPoll {
+			if now.Sub(b.last).Seconds()*l.rate >= l.burst {
+				delete(l.byPoll, k)
+			}
+		}
+	}
+	k := pollKey{ip, job}
+	b, ok := l.byPoll[k]
+	if !ok {
+		b = &pollBucket{tokens: l.burst, last: now}
+		l.byPoll[k] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDownloadIDValidation(t *testing.T) {
+	defer func(s *resultStore, m *missLimiter) { store, downloadMiss = s, m }(store, downloadMiss)
+	store = newResultStore(10)
+	downloadMiss = newMissLimiter(100, time.Minute, time.Minute)
+	id := genID()
+	store.Store(id, newRecord("classic.csv", []byte("a\n"), ""))
+	tests := []struct {
+		id   string
+		want int
+	}{
+		{id, http.StatusOK},
+		{genID(), http.StatusNotFound},
+		{"", http.StatusBadRequest},
+		{"abc", http.StatusBadRequest},
+		{id + "0", http.StatusBadRequest},
+		{"18DEADC0CAC3BB02C884E155", http.StatusBadRequest},
+		{"../../etc/passwd00000000", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if rec := getDownload(t, "id="+tt.id); rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadMissBlocking(t *testing.T) {
+	defer func(s *resultStore, m *missLimiter) { store, downloadMiss = s, m }(store, downloadMiss)
+	store = newResultStore(10)
+	downloadMiss = newMissLimiter(3, time.Minute, time.Hour)
+	id := genID()
+	store.Store(id, newRecord("classic.csv", []byte("a\n"), ""))
+
+	get := func(id, addr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/download?id="+id, nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		download(rec, req)
+		return rec.Code
+	}
+	steps := []struct {
+		id, addr string
+		want     int
+	}{
+		{"bad", "10.0.0.1:1000", http.StatusBadRequest},
+		{genID(), "10.0.0.1:1001", http.StatusNotFound},
+		{id, "10.0.0.1:1002", http.StatusOK},
+		// Третий промах блокирует IP, в том числе для существующих id.
+		{"bad", "10.0.0.1:1003", http.StatusBadRequest},
+		{id, "10.0.0.1:1004", http.StatusTooManyRequests},
+		{id, "10.0.0.2:1000", http.StatusOK},
+	}
+	for i, s := range steps {
+		if code := get(s.id, s.addr); code != s.want {
+			t.Errorf("step %d: GET %s from %s = %d, want %d", i, s.id, s.addr, code, s.want)
+		}
+	}
+}
+
+func TestMissLimiterWindow(t *testing.T) {
+	l := newMissLimiter(2, 50*time.Millisecond, time.Hour)
+	l.Miss("a")
+	time.Sleep(80 * time.Millisecond)
+	// Промах вне окна начинает отсчёт заново.
+	l.Miss("a")
+	if l.Blocked("a") {
+		t.Fatal("blocked after misses in different windows")
+	}
+	l.Miss("a")
+	if !l.Blocked("a") {
+		t.Fatal("not blocked after the limit within a window")
+	}
+	if newMissLimiter(0, time.Minute, time.Hour).Blocked("a") {
+		t.Error("limit 0 blocks")
+	}
+}
+
+func TestDownloadSlotsPerIP(t *testing.T) {
+	defer func(s *resultStore, d *ipSlots) { store, downloadSlots = s, d }(store, downloadSlots)
+	store = newResultStore(10)
+	downloadSlots = newIPSlots(1)
+	id := genID()
+	store.Store(id, newRecord("classic.csv", []byte("a\n"), ""))
+
+	// httptest.NewRequest приходит с 192.0.2.1 — занимаем его единственный слот.
+	release, ok := downloadSlots.Acquire(clientIP(httptest.NewRequest(http.MethodGet, "/", nil)))
+	if !ok {
+		t.Fatal("first slot refused")
+	}
+	if rec := getDownload(t, "id="+id); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second concurrent download: status %d, want 429", rec.Code)
+	}
+	if _, ok := downloadSlots.Acquire("198.51.100.7"); !ok {
+		t.Error("other client refused")
+	}
+	release()
+	if rec := getDownload(t, "id="+id); rec.Code != http.StatusOK {
+		t.Errorf("download after release: status %d", rec.Code)
+	}
+	// Слот освобождается и после успешного скачивания.
+	if rec := getDownload(t, "id="+id); rec.Code != http.StatusOK {
+		t.Errorf("repeated download: status %d", rec.Code)
+	}
+}
+
+func TestStatusPollLimit(t *testing.T) {
+	defer func(p *pollLimiter, j *jobRegistry) { statusPolls, jobs = p, j }(statusPolls, jobs)
+	jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+	statusPolls = newPollLimiter(20, 2)
+	a, b := genID(), genID()
+	jobs.Start(&jobRecord{ID: a}, nil)
+	jobs.Start(&jobRecord{ID: b}, nil)
+
+	poll := func(id, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/status?id="+id, nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		status(rec, req)
+		return rec
+	}
+	for i := range 2 {
+		if rec := poll(a, "192.0.2.1"); rec.Code != http.StatusOK {
+			t.Fatalf("poll %d within burst: %d", i, rec.Code)
+		}
+	}
+	rec := poll(a, "192.0.2.1")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("poll over burst: %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	// Лимит — на пару (IP, задача).
+	if rec := poll(b, "192.0.2.1"); rec.Code != http.StatusOK {
+		t.Errorf("other job: %d", rec.Code)
+	}
+	if rec := poll(a, "198.51.100.7"); rec.Code != http.StatusOK {
+		t.Errorf("other client: %d", rec.Code)
+	}
+	// 20 токенов в секунду: через 100 мс снова можно.
+	time.Sleep(100 * time.Millisecond)
+	if rec := poll(a, "192.0.2.1"); rec.Code != http.StatusOK {
+		t.Errorf("poll after refill: %d", rec.Code)
+	}
+}
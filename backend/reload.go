@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// startupOnlyKeys — настройки с флагом startupOnly в configKeys.
+func startupOnlyKeys() []string {
+	var keys []string
+	for k, kind := range configKeys {
+		if kind&startupOnly != 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// applyLimits применяет текущие лимиты хранилища результатов и
+// ограничителей скачиваний и опросов; вызывается при старте и после
+// каждого перечитывания CONFIG_FILE. Уменьшение MAX_STORED_RESULTS сразу
+// вытесняет лишние записи, уже идущие скачивания свои слоты сохраняют.
+func applyLimits() {
+	store.SetMax(getenvInt("MAX_STORED_RESULTS", 200))
+	downloadMiss.SetLimits(
+		getenvInt("DOWNLOAD_MISS_LIMIT", 20),
+		getenvDuration("DOWNLOAD_MISS_WINDOW", time.Minute),
+		getenvDuration("DOWNLOAD_BLOCK_DURATION", 5*time.Minute),
+	)
+	downloadSlots.SetMax(getenvInt("DOWNLOAD_MAX_PER_IP", 8))
+	statusPolls.SetRate(getenvFloat("STATUS_POLL_RATE", 5), getenvInt("STATUS_POLL_BURST", 10))
+}
+
+// reloadOnSIGHUP перечитывает CONFIG_FILE по SIGHUP. Новые запросы видят
+// новые значения; уже идущие задачи до конца работают со снимком настроек,
+// взятым при их приёме. Файл с ошибками отклоняется целиком, старый остаётся.
+func reloadOnSIGHUP(path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if path == "" {
+			log.Printf("SIGHUP ignored: CONFIG_FILE is not set")
+			continue
+		}
+		if err := reloadConfig(path); err != nil {
+			log.Printf("Config reload failed, keeping previous settings: %v", err)
+		}
+	}
+}
+
+func reloadConfig(path string) error {
+	cfg, err := loadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	var old map[string]string
+	if p := fileConfig.Swap(&cfg); p != nil {
+		old = *p
+	}
+	applyLimits()
+	log.Printf("Reloaded %d settings from %s", len(cfg), path)
+	for _, k := range startupOnlyKeys() {
+		if old[k] != cfg[k] && os.Getenv(k) == "" {
+			log.Printf("Setting %s changed; it takes effect after a restart", k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// resultCollector сохраняет файлы результатов одной задачи в store и
+// собирает карту ключ -> id для фронта.
+type resultCollector struct {
+	tenant string
+	// submissionName, если задано, заменяет имя основного (classic) файла.
+	submissionName string
+	// primaryKey — ключ основного файла в downloads (PRIMARY_DOWNLOAD_KEY).
+	primaryKey string
+	jobID      string
+	// workers ограничивает число файлов, декодируемых/сохраняемых параллельно.
+	workers int
+	// maxFiles — предел числа файлов от runner.py (защита от runaway-вывода).
+	maxFiles int
+	// expiresAt — срок хранения файлов (retain); нулевое значение — без срока.
+	expiresAt time.Time
+	// ctx и workDir нужны POSTPROCESS_CMD; ctx == nil — без постобработки.
+	ctx     context.Context
+	workDir string
+	// config — снимок настроек задачи (solverParams.config).
+	config settings
+
+	mu        sync.Mutex
+	downloads map[string]string
+}
+
+// collect поддерживает три протокола runner.py: results_files (пути внутри
+// outDir), csv_files (массив base64) и устаревшие csv_base64/csv_filename.
+// Большие base64-значения к этому моменту уже декодированы в файлы outDir
+// (spoolBase64Fields) и приходят как base64_path/csv_base64_path.
+// Если runner отдаёт и новый, и старый формат (переходный период), поведение
+// задаёт RESULT_FORMAT_CONFLICT: merge (по умолчанию; при совпадении ключей
+// побеждает массив) или error.
+func (c *resultCollector) collect(result map[string]any, outDir string) (map[string]string, error) {
+	pathsAny, hasPaths := result["results_files"].([]any)
+	filesAny, hasFiles := result["csv_files"].([]any)
+	csvBase64, _ := result["csv_base64"].(string)
+	csvSpooled, _ := result["csv_base64_path"].(string)
+	csvFilename, _ := result["csv_filename"].(string)
+	legacy := csvBase64 != "" || csvSpooled != ""
+
+	if (hasPaths || hasFiles) && legacy {
+		log.Printf("Runner returned both a file array and legacy csv_base64")
+		if c.config.get("RESULT_FORMAT_CONFLICT", "merge") == "error" {
+			return nil, fmt.Errorf("runner returned both a file array and legacy csv_base64 (RESULT_FORMAT_CONFLICT=error)")
+		}
+	}
+
+	switch {
+	case hasPaths:
+		if err := c.collectPaths(pathsAny, outDir); err != nil {
+			return nil, err
+		}
+	case hasFiles:
+		if err := c.collectFiles(filesAny, outDir); err != nil {
+			return nil, err
+		}
+	}
+
+	// Старый формат: одно поле csv_base64/csv_filename
+	if legacy {
+		if _, taken := c.downloads[c.primaryKey]; taken {
+			return c.downloads, nil
+		}
+		name := safeName(csvFilename, "submission.csv")
+		if c.submissionName != "" {
+			name = c.submissionName
+		}
+		if csvSpooled != "" {
+			if !filepath.IsLocal(csvSpooled) {
+				return nil, fmt.Errorf("result path %q escapes the output directory", csvSpooled)
+			}
+			id, err := c.putFile(name, filepath.Join(outDir, csvSpooled))
+			if err != nil {
+				return nil, err
+			}
+			c.downloads[c.primaryKey] = id
+			return c.downloads, nil
+		}
+		b, err := base64.StdEncoding.DecodeString(csvBase64)
+		if err != nil {
+			return nil, fmt.Errorf("decode csv_base64: %w", err)
+		}
+		if b, err = c.transform(csvFilename, b); err != nil {
+			return nil, err
+		}
+		c.downloads[c.primaryKey] = c.put(name, b)
+	}
+	return c.downloads, nil
+}
+
+func (c *resultCollector) collectPaths(pathsAny []any, outDir string) error {
+	if err := c.checkCount(len(pathsAny)); err != nil {
+		return err
+	}
+	// Пути проверяются до запуска воркеров, как в collectFiles.
+	paths := make([]string, len(pathsAny))
+	for i, p := range pathsAny {
+		rel, _ := p.(string)
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("result path %q escapes the output directory", rel)
+		}
+		paths[i] = rel
+	}
+	g := c.group()
+	for _, rel := range paths {
+		g.Go(func() error {
+			return c.storeFile(filepath.Base(rel), filepath.Join(outDir, rel))
+		})
+	}
+	return g.Wait()
+}
+
+// collectFiles — новый формат: массив файлов [{name, base64}].
+func (c *resultCollector) collectFiles(filesAny []any, outDir string) error {
+	if err := c.checkCount(len(filesAny)); err != nil {
+		return err
+	}
+	// Все записи проверяются до запуска воркеров: иначе ошибка в середине
+	// массива вернулась бы, пока уже запущенные воркеры пишут в store.
+	type resultFile struct{ name, b64, spooled string }
+	files := make([]resultFile, 0, len(filesAny))
+	for _, f := range filesAny {
+		m, _ := f.(map[string]any)
+		name, _ := m["name"].(string)
+		b64, _ := m["base64"].(string)
+		spooled, _ := m["base64_path"].(string)
+		if name == "" || (b64 == "" && spooled == "") {
+			continue
+		}
+		if spooled != "" && !filepath.IsLocal(spooled) {
+			return fmt.Errorf("result path %q escapes the output directory", spooled)
+		}
+		files = append(files, resultFile{name, b64, spooled})
+	}
+	g := c.group()
+	for _, f := range files {
+		name, b64 := f.name, f.b64
+		if f.spooled != "" {
+			g.Go(func() error { return c.storeFile(name, filepath.Join(outDir, f.spooled)) })
+			continue
+		}
+		g.Go(func() error {
+			b, err := base64.StdEncoding.DecodeString(b64)
+			if err != nil {
+				return fmt.Errorf("decode %s: %w", name, err)
+			}
+			if b, err = c.transform(name, b); err != nil {
+				return err
+			}
+			c.store(name, b)
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// transform применяет POSTPROCESS_CMD к файлу до сохранения.
+func (c *resultCollector) transform(name string, data []byte) ([]byte, error) {
+	if c.ctx == nil {
+		return data, nil
+	}
+	return postprocessResult(c.ctx, c.config, filepath.Base(name), data, c.workDir)
+}
+
+func (c *resultCollector) checkCount(n int) error {
+	if c.maxFiles > 0 && n > c.maxFiles {
+		return fmt.Errorf("runner returned %d result files, limit is %d (MAX_RESULT_FILES)", n, c.maxFiles)
+	}
+	return nil
+}
+
+func (c *resultCollector) group() *errgroup.Group {
+	g := new(errgroup.Group)
+	if c.workers > 0 {
+		g.SetLimit(c.workers)
+	}
+	return g
+}
+
+func (c *resultCollector) store(name string, data []byte) {
+	_ = c.storeWith(name, func(stored string) (string, error) { return c.put(stored, data), nil })
+}
+
+// storeFile сохраняет файл результата с диска; см. putFile.
+func (c *resultCollector) storeFile(name, path string) error {
+	return c.storeWith(name, func(stored string) (string, error) { return c.putFile(stored, path) })
+}
+
+// storeWith сохраняет файл через put под итоговым именем и раскладывает
+// полученный id по ключам downloads. put (копирование, постобработка,
+// сжатие, запись на диск) выполняется без c.mu, чтобы воркеры RESULT_WORKERS
+// не ждали друг друга; под c.mu — только обновление downloads.
+func (c *resultCollector) storeWith(name string, put func(stored string) (string, error)) error {
+	stored := name
+	if name == "classic.csv" && c.submissionName != "" {
+		stored = c.submissionName
+	}
+	id, err := put(stored)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Ключи для фронта
+	switch name {
+	case "classic.csv":
+		if _, dup := c.downloads["classic_csv"]; !dup && c.primaryKey != "classic_csv" {
+			c.downloads[c.primaryKey] = id // обратная совместимость
+		}
+		c.downloads[c.uniqueKey("classic_csv")] = id
+	case "quantum.csv":
+		c.downloads[c.uniqueKey("quantum_csv")] = id
+	default:
+		c.downloads[c.uniqueKey(name)] = id
+	}
+	return nil
+}
+
+// uniqueKey не даёт файлу с повторяющимся именем затереть предыдущий:
+// второй получает ключ key_2, третий key_3 и т.д. Вызывать под c.mu.
+func (c *resultCollector) uniqueKey(key string) string {
+	if _, ok := c.downloads[key]; !ok {
+		return key
+	}
+	for i := 2; ; i++ {
+		k := fmt.Sprintf("%s_%d", key, i)
+		if _, ok := c.downloads[k]; !ok {
+			return k
+		}
+	}
+}
+
+func (c *resultCollector) put(name string, data []byte) string {
+	id := genID()
+	rec := newRecord(safeName(name, "file.csv"), data, c.tenant)
+	rec.ExpiresAt = c.expiresAt
+	rec.JobID = c.jobID
+	if storeDir != "" {
+		disk, err := persistRecord(storeDir, id, rec, data)
+		if err != nil {
+			log.Printf("Failed to persist result %s, keeping it in memory: %v", id, err)
+		} else {
+			rec = disk
+		}
+	}
+	store.Store(id, rec)
+	return id
+}
+
+// putFile сохраняет файл результата, лежащий на диске. С STORE_DIR и без
+// POSTPROCESS_CMD файл переносится в хранилище потоком, не читаясь в память
+// целиком; иначе — как put.
+func (c *resultCollector) putFile(name, path string) (string, error) {
+	if storeDir == "" || (c.ctx != nil && c.config.get("POSTPROCESS_CMD", "") != "") {
+		b, err := readResultFile(path)
+		if err != nil {
+			return "", err
+		}
+		if b, err = c.transform(name, b); err != nil {
+			return "", err
+		}
+		return c.put(name, b), nil
+	}
+	id := genID()
+	rec, err := persistFile(storeDir, id, path)
+	if err != nil {
+		return "", err
+	}
+	rec.Name = safeName(name, "file.csv")
+	rec.Tenant = c.tenant
+	rec.ExpiresAt = c.expiresAt
+	rec.JobID = c.jobID
+	store.Store(id, rec)
+	return id, nil
+}
+
+// primaryDownloadKey — ключ основного файла результата в downloads;
+// по умолчанию submission_csv, как было всегда.
+func primaryDownloadKey(cfg settings) string {
+	if k := strings.TrimSpace(cfg.get("PRIMARY_DOWNLOAD_KEY", "")); k != "" {
+		return k
+	}
+	return "submission_csv"
+}
+
+// submissionName рендерит SUBMISSION_NAME_TEMPLATE ({team}, {ts}) для
+// основного файла результата; пустая строка — оставить имя от runner.py.
+func submissionName(cfg settings, team string, now time.Time) string {
+	tmpl := cfg.get("SUBMISSION_NAME_TEMPLATE", "")
+	if tmpl == "" {
+		return ""
+	}
+	if team == "" {
+		team = "team"
+	}
+	name := strings.NewReplacer(
+		"{team}", team,
+		"{ts}", now.UTC().Format("20060102T150405Z"),
+	).Replace(tmpl)
+	return safeName(name, "submission.csv")
+}
+
+func readResultFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	if fi, err := f.Stat(); err == nil {
+		buf.Grow(int(fi.Size()))
+	}
+	if _, err := io.Copy(&buf, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStoreWithRunsPutConcurrently: put разных файлов не сериализуется на
+// c.mu — каждый put ждёт, пока стартуют все остальные.
+func TestStoreWithRunsPutConcurrently(t *testing.T) {
+	c := &resultCollector{primaryKey: "submission_csv", downloads: map[string]string{}}
+	names := []string{"classic.csv", "quantum.csv", "report.csv", "report.csv"}
+	var started sync.WaitGroup
+	started.Add(len(names))
+	all := make(chan struct{})
+	go func() { started.Wait(); close(all) }()
+
+	g := c.group()
+	for i, name := range names {
+		g.Go(func() error {
+			return c.storeWith(name, func(string) (string, error) {
+				started.Done()
+				select {
+				case <-all:
+				case <-time.After(5 * time.Second):
+					t.Error("put calls were serialized")
+				}
+				return string(rune('a' + i)), nil
+			})
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"submission_csv", "classic_csv", "quantum_csv", "report.csv", "report.csv_2"} {
+		if _, ok := c.downloads[key]; !ok {
+			t.Errorf("downloads = %v, missing %s", c.downloads, key)
+		}
+	}
+}
+
+// newTestCollector — коллектор без постобработки с отдельным store.
+func newTestCollector(t *testing.T) *resultCollector {
+	t.Helper()
+	s := store
+	t.Cleanup(func() { store = s })
+	store = newResultStore(100)
+	return &resultCollector{primaryKey: "submission_csv", workers: 2, downloads: map[string]string{}}
+}
+
+func TestCollectResultsFiles(t *testing.T) {
+	outDir := t.TempDir()
+	os.MkdirAll(filepath.Join(outDir, "sub"), 0o700)
+	os.WriteFile(filepath.Join(outDir, "classic.csv"), []byte("c\n1\n"), 0o600)
+	os.WriteFile(filepath.Join(outDir, "sub", "quantum.csv"), []byte("q\n2\n"), 0o600)
+
+	tests := []struct {
+		name    string
+		paths   []any
+		want    map[string]string // ключ downloads -> содержимое
+		wantErr string
+	}{
+		{"files", []any{"classic.csv", "sub/quantum.csv"}, map[string]string{"submission_csv": "c\n1\n", "classic_csv": "c\n1\n", "quantum_csv": "q\n2\n"}, ""},
+		{"escapes", []any{"classic.csv", "../etc/passwd"}, nil, "escapes the output directory"},
+		{"absolute", []any{"/etc/passwd"}, nil, "escapes the output directory"},
+		{"missing", []any{"nope.csv"}, nil, "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCollector(t)
+			downloads, err := c.collect(map[string]any{"results_files": tt.paths}, outDir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("collect = %v, want error %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkDownloads(t, downloads, tt.want)
+		})
+	}
+}
+
+func TestCollectCSVFiles(t *testing.T) {
+	outDir := t.TempDir()
+	os.WriteFile(filepath.Join(outDir, "spooled"), []byte("s\n3\n"), 0o600)
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name    string
+		files   []any
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			"inline and spooled",
+			[]any{
+				map[string]any{"name": "classic.csv", "base64": b64("c\n1\n")},
+				map[string]any{"name": "quantum.csv", "base64_path": "spooled"},
+				map[string]any{"name": "", "base64": b64("skipped")},
+			},
+			map[string]string{"classic_csv": "c\n1\n", "quantum_csv": "s\n3\n"},
+			"",
+		},
+		{"bad base64", []any{map[string]any{"name": "a.csv", "base64": "!!"}}, nil, "decode a.csv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCollector(t)
+			downloads, err := c.collect(map[string]any{"csv_files": tt.files}, outDir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("collect = %v, want error %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkDownloads(t, downloads, tt.want)
+		})
+	}
+}
+
+// TestCollectRejectsBeforeStoring: недопустимый путь в конце массива
+// отклоняет весь результат, и ни один файл не остаётся в store.
+func TestCollectRejectsBeforeStoring(t *testing.T) {
+	outDir := t.TempDir()
+	var paths, files []any
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("f%d.csv", i)
+		os.WriteFile(filepath.Join(outDir, name), []byte("x\n"), 0o600)
+		paths = append(paths, name)
+		files = append(files, map[string]any{"name": name, "base64_path": name})
+	}
+	paths = append(paths, "../escape.csv")
+	files = append(files, map[string]any{"name": "e.csv", "base64_path": "../escape.csv"})
+
+	for key, list := range map[string][]any{"results_files": paths, "csv_files": files} {
+		t.Run(key, func(t *testing.T) {
+			c := newTestCollector(t)
+			if _, err := c.collect(map[string]any{key: list}, outDir); err == nil {
+				t.Fatal("collect accepted a path outside the output directory")
+			}
+			// Воркеры, если бы они были запущены, успели бы сохранить файлы.
+			time.Sleep(50 * time.Millisecond)
+			if n := store.ll.Len(); n != 0 || len(c.downloads) != 0 {
+				t.Errorf("rejected result left %d records in the store, downloads %v", n, c.downloads)
+			}
+		})
+	}
+}
+
+func checkDownloads(t *testing.T, downloads map[string]string, want map[string]string) {
+	t.Helper()
+	for key, content := range want {
+		rec, ok := store.Peek(downloads[key])
+		if !ok {
+			t.Errorf("downloads[%s] = %q not stored (downloads %v)", key, downloads[key], downloads)
+			continue
+		}
+		if string(rec.Data) != content {
+			t.Errorf("downloads[%s] = %q, want %q", key, rec.Data, content)
+		}
+	}
+}
+
+func TestResultFilesOnDisk(t *testing.T) {
+	t.Setenv("RESULT_FILES_ON_DISK", "1")
+	fakeRunner(t, `import json, os, sys
+args = sys.argv[1:]
+out = args[args.index("--output-dir") + 1]
+open(os.path.join(out, "classic.csv"), "w").write("route\n1\n")
+print(json.dumps({"ok": True, "results": [], "summary": {}, "results_files": ["classic.csv"]}))
+`)
+	got := decodeBody(t, postProcess(t, nil, "in.csv", "a\n1\n", nil), http.StatusOK)
+	id, _ := got["downloads"].(map[string]any)["submission_csv"].(string)
+	if rec, ok := store.Peek(id); !ok || string(rec.Data) != "route\n1\n" {
+		t.Errorf("submission_csv = %q, %v", rec.Data, ok)
+	}
+}
+
+func TestSubmissionName(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 30, 5, 0, time.FixedZone("MSK", 3*3600))
+	tests := []struct {
+		tmpl, team, want string
+	}{
+		{"", "alpha", ""},
+		{"{team}_{ts}.csv", "alpha", "alpha_20260301T093005Z.csv"},
+		{"{team}.csv", "", "team.csv"},
+		{"submission-{team}.csv", "a/b", "submission-a_b.csv"},
+		{"fixed.csv", "alpha", "fixed.csv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tmpl, func(t *testing.T) {
+			t.Setenv("SUBMISSION_NAME_TEMPLATE", tt.tmpl)
+			if got := submissionName(snapshotSettings(), tt.team, now); got != tt.want {
+				t.Errorf("submissionName = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubmissionNameApplied(t *testing.T) {
+	t.Setenv("SUBMISSION_NAME_TEMPLATE", "{team}-result.csv")
+	fakeRunner(t, echoRunner)
+	got := decodeBody(t, postProcess(t, url.Values{"team": {"alpha"}}, "in.csv", "a\n1\n", nil), http.StatusOK)
+	downloads := got["downloads"].(map[string]any)
+	for key, want := range map[string]string{"submission_csv": "alpha-result.csv", "quantum_csv": "quantum.csv"} {
+		rec, ok := store.Peek(downloads[key].(string))
+		if !ok || rec.Name != want {
+			t.Errorf("%s name = %q, want %q", key, rec.Name, want)
+		}
+	}
+}
+
+func TestCollectorWorkerLimit(t *testing.T) {
+	tests := []struct {
+		workers, want int
+	}{
+		{1, 1},
+		{3, 3},
+		{0, 8}, // без ограничения
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.workers), func(t *testing.T) {
+			c := &resultCollector{workers: tt.workers}
+			var mu sync.Mutex
+			active, peak := 0, 0
+			g := c.group()
+			for i := 0; i < 8; i++ {
+				g.Go(func() error {
+					mu.Lock()
+					active++
+					peak = max(peak, active)
+					mu.Unlock()
+					time.Sleep(20 * time.Millisecond)
+					mu.Lock()
+					active--
+					mu.Unlock()
+					return nil
+				})
+			}
+			g.Wait()
+			// Нижняя граница мягкая: планировщик может не запустить все сразу.
+			if peak > tt.want || (tt.want > 1 && peak < 2) {
+				t.Errorf("peak concurrency = %d, want up to %d", peak, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxResultFiles(t *testing.T) {
+	outDir := t.TempDir()
+	var paths []any
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("f%d.csv", i)
+		os.WriteFile(filepath.Join(outDir, name), []byte("x\n"), 0o600)
+		paths = append(paths, name)
+	}
+	tests := []struct {
+		maxFiles int
+		ok       bool
+	}{
+		{0, true}, // без предела
+		{3, true},
+		{2, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.maxFiles), func(t *testing.T) {
+			c := newTestCollector(t)
+			c.maxFiles = tt.maxFiles
+			downloads, err := c.collect(map[string]any{"results_files": paths}, outDir)
+			if !tt.ok {
+				if err == nil || !strings.Contains(err.Error(), "MAX_RESULT_FILES") {
+					t.Fatalf("collect = %v, want the MAX_RESULT_FILES error", err)
+				}
+				if n := store.ll.Len(); n != 0 {
+					t.Errorf("rejected result left %d records in the store", n)
+				}
+				return
+			}
+			if err != nil || len(downloads) != 3 {
+				t.Errorf("collect = %v, %v", downloads, err)
+			}
+		})
+	}
+
+	// Через /process: echoRunner отдаёт два файла.
+	t.Setenv("MAX_RESULT_FILES", "1")
+	fakeRunner(t, echoRunner)
+	rec := postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil)
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "limit is 1") {
+		t.Errorf("process = %d %q, want 500 with the file limit", rec.Code, rec.Body.String())
+	}
+}
+
+// TestDuplicateResultNames: одинаковые имена файлов и запуски в одну
+// наносекунду не затирают друг друга ни в downloads, ни в store.
+func TestDuplicateResultNames(t *testing.T) {
+	c := newTestCollector(t)
+	c.workers = 0
+	for i, content := range []string{"first", "second", "third"} {
+		c.store("classic.csv", []byte(content))
+		c.store("report.csv", []byte(fmt.Sprint(i)))
+	}
+	checkDownloads(t, c.downloads, map[string]string{
+		"submission_csv": "first",
+		"classic_csv":    "first",
+		"classic_csv_2":  "second",
+		"classic_csv_3":  "third",
+		"report.csv":     "0",
+		"report.csv_2":   "1",
+		"report.csv_3":   "2",
+	})
+
+	ids := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				id := genID()
+				mu.Lock()
+				if ids[id] || !downloadIDRe.MatchString(id) {
+					t.Errorf("genID returned duplicate or malformed id %q", id)
+				}
+				ids[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestResultFormatConflict(t *testing.T) {
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	file := func(name, content string) map[string]any {
+		return map[string]any{"name": name, "base64": b64(content)}
+	}
+	tests := []struct {
+		name    string
+		mode    string
+		files   []any
+		want    map[string]string
+		wantErr bool
+	}{
+		{"merge adds legacy file", "", []any{file("quantum.csv", "q\n")},
+			map[string]string{"quantum_csv": "q\n", "submission_csv": "legacy\n"}, false},
+		{"array wins on same key", "merge", []any{file("classic.csv", "c\n")},
+			map[string]string{"classic_csv": "c\n", "submission_csv": "c\n"}, false},
+		{"error mode", "error", []any{file("quantum.csv", "q\n")}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RESULT_FORMAT_CONFLICT", tt.mode)
+			c := newTestCollector(t)
+			result := map[string]any{"csv_files": tt.files, "csv_base64": b64("legacy\n")}
+			downloads, err := c.collect(result, t.TempDir())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got downloads %v", downloads)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkDownloads(t, downloads, tt.want)
+		})
+	}
+}
+
+func TestPrimaryDownloadKey(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	for _, tt := range []struct{ setting, key string }{{"", "submission_csv"}, {" result ", "result"}} {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Setenv("PRIMARY_DOWNLOAD_KEY", tt.setting)
+			got := decodeBody(t, postProcess(t, nil, "in.csv", "a\n1\n", nil), http.StatusOK)
+			downloads := got["downloads"].(map[string]any)
+			if downloads[tt.key] == nil || downloads[tt.key] != downloads["classic_csv"] {
+				t.Errorf("downloads = %v, want %s pointing at classic_csv", downloads, tt.key)
+			}
+			if tt.key != "submission_csv" && downloads["submission_csv"] != nil {
+				t.Errorf("submission_csv still set: %v", downloads)
+			}
+		})
+	}
+}
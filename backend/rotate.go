@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile — файл лога с ротацией по размеру: при превышении maxSize
+// текущий файл становится path.1, прежние сдвигаются до path.<backups>,
+// самый старый удаляется. Write безопасен из нескольких горутин.
+// Если ротация не удалась, запись продолжается в path, а попытка
+// повторяется на следующем Write.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	f       *os.File
+	size    int64
+	// failing — о текущей серии неудачных ротаций уже сообщено в stderr.
+	failing bool
+}
+
+func openRotatingFile(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f, rf.size = f, info.Size()
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		err := rf.rotate()
+		if err != nil && !rf.failing {
+			fmt.Fprintf(os.Stderr, "Log rotation of %s failed: %v\n", rf.path, err)
+		}
+		rf.failing = err != nil
+	}
+	if rf.f == nil {
+		// path не удалось открыть заново после ротации
+		if err := rf.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate вызывается под rf.mu. При ошибке переименования path всё равно
+// открывается заново (файл продолжит расти); rf.f == nil, только если
+// не удалось и это.
+func (rf *rotatingFile) rotate() error {
+	err := rf.f.Close()
+	rf.f = nil
+	if err == nil {
+		if rf.backups > 0 {
+			for i := rf.backups - 1; i >= 1; i-- {
+				_ = os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+			}
+			err = os.Rename(rf.path, rf.path+".1")
+		} else {
+			err = os.Remove(rf.path)
+		}
+	}
+	return errors.Join(err, rf.open())
+}
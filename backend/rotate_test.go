@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	rf, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Каждая строка не влезает к предыдущей; старше path.2 не хранится.
+	for name, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		if got := readFile(t, name); got != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("extra backup kept: %v", err)
+	}
+}
+
+func TestRotatingFileRenameFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	rf, err := openRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// path.1 — непустой каталог: переименовать в него файл нельзя.
+	if err := os.MkdirAll(filepath.Join(path+".1", "x"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("write %q after failed rotation: %v", line, err)
+		}
+	}
+	if got := readFile(t, path); got != "first\nsecond\nthird\n" {
+		t.Errorf("log = %q, want all lines kept in place", got)
+	}
+
+	// Препятствие убрано — следующая запись ротирует как обычно.
+	os.RemoveAll(path + ".1")
+	if _, err := rf.Write([]byte("fourth\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "fourth\n" {
+		t.Errorf("log after recovery = %q", got)
+	}
+	if got := readFile(t, path+".1"); !strings.HasPrefix(got, "first\n") {
+		t.Errorf("backup after recovery = %q", got)
+	}
+}
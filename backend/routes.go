@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// routeAssignment — строка classic.csv: маршрут водителя в графе.
+type routeAssignment struct {
+	GraphIndex  int   `json:"graph_index"`
+	DriverIndex int   `json:"driver_index"`
+	Path        []int `json:"path"`
+}
+
+// Колонки classic.csv, из которых строится routeAssignment.
+var routeColumns = []string{"graph_index", "driver_index", "route"}
+
+// errMissingColumns — в файле нет колонок, нужных для ?as=routes
+// (например, это quantum.csv).
+type errMissingColumns struct {
+	Missing   []string
+	Available []string
+}
+
+func (e *errMissingColumns) Error() string {
+	return fmt.Sprintf("result file has no %s column(s), available: %s",
+		strings.Join(e.Missing, ","), strings.Join(e.Available, ","))
+}
+
+// parseRouteAssignments разбирает файл с маршрутами; route — номера узлов
+// через "-", как их пишет runner.py.
+func parseRouteAssignments(src io.Reader) ([]routeAssignment, error) {
+	cr := csv.NewReader(src)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, &errMissingColumns{Missing: routeColumns, Available: []string{}}
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, h := range header {
+		index[strings.TrimSpace(h)] = i
+	}
+	var missing []string
+	for _, c := range routeColumns {
+		if _, ok := index[c]; !ok {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &errMissingColumns{Missing: missing, Available: header}
+	}
+
+	out := []routeAssignment{}
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(row) != len(header) {
+			return nil, fmt.Errorf("line %d: expected %d fields, got %d", line, len(header), len(row))
+		}
+		var a routeAssignment
+		if a.GraphIndex, err = strconv.Atoi(row[index["graph_index"]]); err != nil {
+			return nil, fmt.Errorf("line %d: graph_index is not an integer", line)
+		}
+		if a.DriverIndex, err = strconv.Atoi(row[index["driver_index"]]); err != nil {
+			return nil, fmt.Errorf("line %d: driver_index is not an integer", line)
+		}
+		a.Path = []int{}
+		if route := strings.TrimSpace(row[index["route"]]); route != "" {
+			for _, node := range strings.Split(route, "-") {
+				n, err := strconv.Atoi(node)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: route node %q is not an integer", line, truncate(node, 32))
+				}
+				a.Path = append(a.Path, n)
+			}
+		}
+		out = append(out, a)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDownloadAsRoutes(t *testing.T) {
+	defer func(s *resultStore) { store = s }(store)
+	store = newResultStore(10)
+	classic, quantum, broken := genID(), genID(), genID()
+	store.Store(classic, newRecord("classic.csv", []byte("graph_index,driver_index,route\n0,0,1-2-3\n0,1,\n1,0,4\n"), ""))
+	store.Store(quantum, newRecord("quantum.csv", []byte("graph_index,route_index,start,end\n0,0,1,3\n"), ""))
+	store.Store(broken, newRecord("classic.csv", []byte("graph_index,driver_index,route\n0,0,1-x\n"), ""))
+
+	got := decodeBody(t, getDownload(t, "id="+classic+"&as=routes"), http.StatusOK)
+	want := []any{
+		map[string]any{"graph_index": 0.0, "driver_index": 0.0, "path": []any{1.0, 2.0, 3.0}},
+		map[string]any{"graph_index": 0.0, "driver_index": 1.0, "path": []any{}},
+		map[string]any{"graph_index": 1.0, "driver_index": 0.0, "path": []any{4.0}},
+	}
+	if got["name"] != "classic.csv" || !reflect.DeepEqual(got["routes"], want) {
+		t.Errorf("routes = %v", got)
+	}
+
+	rec := getDownload(t, "id="+quantum+"&as=routes")
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "driver_index") {
+		t.Errorf("quantum.csv: %d %s", rec.Code, rec.Body)
+	}
+	if rec := getDownload(t, "id="+broken+"&as=routes"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("malformed route: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var errStalled = errors.New("optimizer stalled")
+
+// errQueueDeadline — срок запроса истёк, пока запуск ждал слота: процесс
+// так и не стартовал.
+var errQueueDeadline = errors.New("deadline exceeded while queued")
+
+// stallTimeout — сколько runner.py может молчать (ни stdout, ни stderr),
+// прежде чем watchdog его убьёт. 0 отключает watchdog.
+var stallTimeout time.Duration
+
+// subprocessNice — niceness для runner.py (SUBPROCESS_NICE, Linux), чтобы
+// тяжёлые запуски не отнимали CPU у соседних сервисов. 0 — не менять.
+var subprocessNice int
+
+// killGrace — сколько runner.py даётся на завершение после SIGTERM
+// (таймаут, отмена, watchdog), прежде чем он будет убит SIGKILL
+// (KILL_GRACE_PERIOD). 0 — сразу SIGKILL.
+var killGrace time.Duration
+
+// runSlots ограничивает число одновременно работающих процессов runner.py
+// (MAX_CONCURRENT_RUNS); остальные ждут свободного слота.
+var runSlots chan struct{}
+
+// queuedRuns — сколько запусков сейчас ждут слота (для /load).
+var queuedRuns atomic.Int64
+
+func acquireRunSlot(ctx context.Context) (release func(), err error) {
+	queuedRuns.Add(1)
+	defer queuedRuns.Add(-1)
+	select {
+	case runSlots <- struct{}{}:
+		return func() { <-runSlots }, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, errQueueDeadline
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// runPython запускает runner.py; stdout получает вывод процесса, stderr,
+// если задан, — поток stderr (прогресс итераций, захват для
+// /admin/job-output). env — дополнительные переменные KEY=VALUE поверх
+// subprocessEnv.
+func runPython(ctx context.Context, cfg settings, args []string, stdout, stderr io.Writer, env ...string) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	activity := make(chan struct{}, 1)
+	cmd := exec.CommandContext(ctx, "python3", args...)
+	cmd.Env = append(subprocessEnv(cfg, os.Environ()), env...)
+	if killGrace > 0 {
+		// Сначала SIGTERM, чтобы runner.py успел сбросить частичный
+		// результат; по истечении WaitDelay exec добивает процесс SIGKILL.
+		// WaitDelay ограничивает и копирование stdout/stderr: вывод
+		// runner.py, завершившегося в срок, дочитывается целиком, но если
+		// процесс (или унаследовавший его pipe дочерний процесс) жив
+		// дольше killGrace, вывод обрывается и итоговый JSON не разберётся.
+		cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+		cmd.WaitDelay = killGrace
+	}
+	cmd.Stdout = &activityWriter{w: stdout, activity: activity}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	cmd.Stderr = &activityWriter{w: stderr, activity: activity}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if subprocessNice != 0 {
+		if err := setNice(cmd.Process.Pid, subprocessNice); err != nil {
+			log.Printf("Failed to set niceness %d for runner (pid %d): %v", subprocessNice, cmd.Process.Pid, err)
+		}
+	}
+	if cpus := assignCPUSet(); cpus != nil {
+		if err := setAffinity(cmd.Process.Pid, cpus); err != nil {
+			log.Printf("Failed to pin runner (pid %d) to CPUs %v: %v", cmd.Process.Pid, cpus, err)
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	if stallTimeout > 0 {
+		go watchdog(stallTimeout, activity, done, func() { cancel(errStalled) })
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if errors.Is(context.Cause(ctx), errStalled) {
+			return errStalled
+		}
+		return err
+	}
+	return nil
+}
+
+// watchdog вызывает kill, если за timeout не пришло ни одного сигнала активности.
+func watchdog(timeout time.Duration, activity <-chan struct{}, done <-chan struct{}, kill func()) {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-activity:
+			t.Reset(timeout)
+		case <-t.C:
+			kill()
+			return
+		}
+	}
+}
+
+// activityWriter сообщает watchdog'у о каждой порции вывода процесса.
+type activityWriter struct {
+	w        io.Writer
+	activity chan<- struct{}
+}
+
+func (a *activityWriter) Write(p []byte) (int, error) {
+	select {
+	case a.activity <- struct{}{}:
+	default:
+	}
+	return a.w.Write(p)
+}
+
+// subprocessEnv оставляет только переменные, нужные runner.py:
+// PATH, PYTHON*, MIREA_* и перечисленные в PYTHON_ENV_PASSTHROUGH.
+func subprocessEnv(cfg settings, environ []string) []string {
+	passthrough := map[string]bool{"PATH": true}
+	for _, k := range strings.Split(cfg.get("PYTHON_ENV_PASSTHROUGH", ""), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			passthrough[k] = true
+		}
+	}
+	env := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		k, _, _ := strings.Cut(kv, "=")
+		if passthrough[k] || strings.HasPrefix(k, "PYTHON") || strings.HasPrefix(k, "MIREA_") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// cappedBuffer хранит не больше max байт, но считает всё, что было записано.
+type cappedBuffer struct {
+	mu    sync.Mutex
+	max   int
+	buf   []byte
+	total int64
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total += int64(len(p))
+	if room := c.max - len(c.buf); room > 0 {
+		c.buf = append(c.buf, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+func (c *cappedBuffer) Bytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bytes.Clone(c.buf)
+}
+
+func (c *cappedBuffer) Truncated() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total > int64(len(c.buf))
+}
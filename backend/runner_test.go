@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubprocessEnv(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin", "HOME=/root", "PYTHONPATH=/py", "MIREA_EMAIL=a@b",
+		"AWS_SECRET_ACCESS_KEY=x", "SECRET_TOKEN=t", "LANG=C.UTF-8",
+	}
+	tests := []struct {
+		passthrough string
+		want        []string
+	}{
+		{"", []string{"PATH=/usr/bin", "PYTHONPATH=/py", "MIREA_EMAIL=a@b"}},
+		{"LANG", []string{"PATH=/usr/bin", "PYTHONPATH=/py", "MIREA_EMAIL=a@b", "LANG=C.UTF-8"}},
+		{" SECRET_TOKEN , LANG,", []string{"PATH=/usr/bin", "PYTHONPATH=/py", "MIREA_EMAIL=a@b", "SECRET_TOKEN=t", "LANG=C.UTF-8"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.passthrough, func(t *testing.T) {
+			t.Setenv("PYTHON_ENV_PASSTHROUGH", tt.passthrough)
+			if got := subprocessEnv(snapshotSettings(), environ); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("subprocessEnv = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunnerEnvAllowlist(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	t.Setenv("HOME", "/home/server")
+	t.Setenv("SECRET_TOKEN", "hunter2")
+	tests := []struct {
+		passthrough string
+		want        map[string]any
+	}{
+		{"", map[string]any{"HOME": nil, "SECRET_TOKEN": nil}},
+		{"SECRET_TOKEN", map[string]any{"HOME": nil, "SECRET_TOKEN": "hunter2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.passthrough, func(t *testing.T) {
+			t.Setenv("PYTHON_ENV_PASSTHROUGH", tt.passthrough)
+			got := decodeBody(t, postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil), http.StatusOK)
+			env := got["summary"].(map[string]any)["env"].(map[string]any)
+			for k, v := range tt.want {
+				if env[k] != v {
+					t.Errorf("runner saw %s=%v, want %v", k, env[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestStallWatchdog(t *testing.T) {
+	defer func(s, k time.Duration) { stallTimeout, killGrace = s, k }(stallTimeout, killGrace)
+	stallTimeout, killGrace = 300*time.Millisecond, 0
+	tests := []struct {
+		name    string
+		script  string
+		wantErr error
+	}{
+		{"silent", "import time\ntime.sleep(30)\n", errStalled},
+		{"steady output", "import sys, time\nfor i in range(10):\n    print(i, file=sys.stderr, flush=True)\n    time.sleep(0.1)\n", nil},
+		{"quick exit", "print('{}')\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeScript(t, tt.script)
+			start := time.Now()
+			err := runPython(context.Background(), settings{}, []string{path}, io.Discard, io.Discard)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("runPython = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && time.Since(start) > 5*time.Second {
+				t.Errorf("stalled runner killed after %v", time.Since(start))
+			}
+		})
+	}
+
+	t.Run("process", func(t *testing.T) {
+		fakeRunner(t, "import time\ntime.sleep(30)\n")
+		rec := postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil)
+		if rec.Code != http.StatusGatewayTimeout || !strings.Contains(rec.Body.String(), "stalled") {
+			t.Errorf("POST /process with a stalled runner: %d %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestEnvOverridesReachRunner(t *testing.T) {
+	t.Setenv("ENV_OVERRIDE_ALLOWLIST", "MIREA_SHOTS,FEATURE_X")
+	t.Setenv("MIREA_SHOTS", "1024")
+	path := writeScript(t, `import os
+print(os.environ.get("MIREA_SHOTS"), os.environ.get("FEATURE_X"))
+`)
+	tests := []struct {
+		name      string
+		overrides []string
+		want      string
+	}{
+		{"server environment", nil, "1024 None"},
+		{"override", []string{"MIREA_SHOTS=32", "FEATURE_X=on"}, "32 on"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseForm(url.Values{"env_overrides": tt.overrides})
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := newEffectiveParameters(p)
+			var stdout bytes.Buffer
+			if err := runPython(context.Background(), p.config, []string{path}, &stdout, nil, e.environ()...); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(stdout.String()); got != tt.want {
+				t.Errorf("child saw %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Через /process: значение доходит до runner.py, в ответе — только ключ.
+	t.Run("process", func(t *testing.T) {
+		fakeRunner(t, echoRunner)
+		form := url.Values{"env_overrides": {`{"MIREA_SHOTS":"48"}`}}
+		got := decodeBody(t, postProcess(t, form, "in.csv", "a,b\n1,2\n", nil), http.StatusOK)
+		if env := got["summary"].(map[string]any)["env"].(map[string]any); env["MIREA_SHOTS"] != "48" {
+			t.Errorf("runner saw MIREA_SHOTS=%v, want 48", env["MIREA_SHOTS"])
+		}
+		params := got["parameters"].(map[string]any)
+		if !reflect.DeepEqual(params["env_overrides"], []any{"MIREA_SHOTS"}) || params["mirea_shots"] != 48.0 {
+			t.Errorf("parameters = %v", params)
+		}
+	})
+}
+
+// readyWriter сигналит, когда скрипт напечатал "ready" — после этого его
+// обработчик SIGTERM уже установлен.
+type readyWriter struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	ready chan struct{}
+	once  sync.Once
+}
+
+func (w *readyWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	if strings.Contains(w.buf.String(), "ready") {
+		w.once.Do(func() { close(w.ready) })
+	}
+	return len(p), nil
+}
+
+func (w *readyWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+const (
+	// По SIGTERM скрипт называет полученный сигнал и, не торопясь,
+	// печатает итог больше буфера pipe — он должен дойти целиком.
+	trapsTerm = `import signal, sys, time
+def term(signum, _):
+    print("signal", signum, flush=True)
+    time.sleep(0.2)
+    sys.stdout.write("partial:" + "x" * 200000 + "\n")
+    sys.exit(0)
+signal.signal(signal.SIGTERM, term)
+print("ready", flush=True)
+time.sleep(60)
+`
+	ignoresTerm = `import signal, time
+signal.signal(signal.SIGTERM, signal.SIG_IGN)
+print("ready", flush=True)
+time.sleep(60)
+`
+)
+
+func TestRunPythonKillGrace(t *testing.T) {
+	defer func(d time.Duration) { killGrace = d }(killGrace)
+	tests := []struct {
+		name        string
+		script      string
+		grace       time.Duration
+		wantPartial bool
+		minElapsed  time.Duration
+		maxElapsed  time.Duration
+	}{
+		// Скрипт успевает сохранить частичный результат задолго до SIGKILL.
+		{"traps SIGTERM", trapsTerm, 10 * time.Second, true, 0, 5 * time.Second},
+		// SIGTERM проигнорирован — процесс добивается по истечении grace.
+		{"ignores SIGTERM", ignoresTerm, 300 * time.Millisecond, false, 300 * time.Millisecond, 5 * time.Second},
+		// Без grace — сразу SIGKILL, обработчик не вызывается.
+		{"no grace", trapsTerm, 0, false, 0, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			killGrace = tt.grace
+			path := writeScript(t, tt.script)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			out := &readyWriter{ready: make(chan struct{})}
+			done := make(chan error, 1)
+			go func() { done <- runPython(ctx, settings{}, []string{path}, out, nil) }()
+
+			select {
+			case <-out.ready:
+			case err := <-done:
+				t.Fatalf("script exited before ready: %v", err)
+			case <-time.After(10 * time.Second):
+				t.Fatal("script did not start")
+			}
+			cancelled := time.Now()
+			cancel()
+			var err error
+			select {
+			case err = <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("runPython did not return after cancel")
+			}
+			elapsed := time.Since(cancelled)
+
+			stdout := out.String()
+			if got := strings.Contains(stdout, "signal 15\n"); got != tt.wantPartial {
+				t.Errorf("SIGTERM handled = %v, want %v (stdout %q, err %v)", got, tt.wantPartial, truncate(stdout, 100), err)
+			}
+			if got := strings.Contains(stdout, "partial:"+strings.Repeat("x", 200000)+"\n"); got != tt.wantPartial {
+				t.Errorf("complete partial result = %v, want %v (%d bytes of stdout)", got, tt.wantPartial, len(stdout))
+			}
+			if !tt.wantPartial && err == nil {
+				t.Error("runPython returned nil for a killed process")
+			}
+			if elapsed < tt.minElapsed || elapsed > tt.maxElapsed {
+				t.Errorf("returned %v after cancel, want %v..%v", elapsed, tt.minElapsed, tt.maxElapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Ожидаемая фронтом структура вывода runner.py. Поддерживается небольшое
+// подмножество JSON Schema: type, required, properties, items.
+//
+//go:embed result_schema.json
+var resultSchemaJSON []byte
+
+var resultSchema = mustParseSchema(resultSchemaJSON)
+
+func mustParseSchema(b []byte) map[string]any {
+	var s map[string]any
+	if err := json.Unmarshal(b, &s); err != nil {
+		panic("invalid embedded result schema: " + err.Error())
+	}
+	return s
+}
+
+// validateResult возвращает список расхождений результата со схемой.
+func validateResult(result map[string]any) []string {
+	var errs []string
+	checkSchema(resultSchema, result, "$", &errs)
+	return errs
+}
+
+func checkSchema(schema map[string]any, v any, path string, errs *[]string) {
+	if t, ok := schema["type"]; ok && !matchesType(t, v) {
+		*errs = append(*errs, fmt.Sprintf("%s: expected %v, got %s", path, t, jsonType(v)))
+		return
+	}
+
+	if obj, ok := v.(map[string]any); ok {
+		if req, ok := schema["required"].([]any); ok {
+			for _, k := range req {
+				if _, present := obj[k.(string)]; !present {
+					*errs = append(*errs, fmt.Sprintf("%s: missing required field %q", path, k))
+				}
+			}
+		}
+		if props, ok := schema["properties"].(map[string]any); ok {
+			keys := make([]string, 0, len(props))
+			for k := range props {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if child, present := obj[k]; present {
+					checkSchema(props[k].(map[string]any), child, path+"."+k, errs)
+				}
+			}
+		}
+	}
+
+	if arr, ok := v.([]any); ok {
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range arr {
+				checkSchema(items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	}
+}
+
+func matchesType(t any, v any) bool {
+	switch t := t.(type) {
+	case string:
+		return isType(t, v)
+	case []any:
+		for _, alt := range t {
+			if s, ok := alt.(string); ok && isType(s, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isType(t string, v any) bool {
+	actual := jsonType(v)
+	return actual == t || (t == "number" && actual == "integer")
+}
+
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const validRunnerOutput = `{"ok": true, "results": [{"graph_index": 1, "graph_node_count": 2,
+	"stats": {"total_routes": 3, "iterations": 10, "final_cost": 1.5, "time_ms": 12},
+	"graph_edges": [{"from": 0, "to": 1, "weight": 0.5, "usage": 2}]}], "summary": {}}`
+
+// decodeRunnerOutput разбирает JSON так же, как optimize (UseNumber).
+func decodeRunnerOutput(t *testing.T, s string) map[string]any {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestValidateResult(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(m map[string]any)
+		want []string
+	}{
+		{"valid", func(map[string]any) {}, nil},
+		{"missing summary", func(m map[string]any) { delete(m, "summary") }, []string{`$: missing required field "summary"`}},
+		{"ok as string", func(m map[string]any) { m["ok"] = "yes" }, []string{"$.ok: expected boolean, got string"}},
+		{"float graph_index", func(m map[string]any) {
+			m["results"].([]any)[0].(map[string]any)["graph_index"] = json.Number("1.5")
+		}, []string{"$.results[0].graph_index: expected integer, got number"}},
+		{"null final_cost allowed", func(m map[string]any) {
+			m["results"].([]any)[0].(map[string]any)["stats"].(map[string]any)["final_cost"] = nil
+		}, nil},
+		{"edge without usage", func(m map[string]any) {
+			edge := m["results"].([]any)[0].(map[string]any)["graph_edges"].([]any)[0].(map[string]any)
+			delete(edge, "usage")
+		}, []string{`$.results[0].graph_edges[0]: missing required field "usage"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := decodeRunnerOutput(t, validRunnerOutput)
+			tt.edit(m)
+			if got := validateResult(m); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateResult = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStrictSchema(t *testing.T) {
+	var out bytes.Buffer
+	json.Compact(&out, []byte(`{"ok": true, "results": [{"graph_index": "one"}], "summary": {}}`))
+	fakeRunner(t, "print('"+out.String()+"')\n")
+	for _, strict := range []string{"", "1"} {
+		t.Run("STRICT_SCHEMA="+strict, func(t *testing.T) {
+			t.Setenv("STRICT_SCHEMA", strict)
+			rec := postProcess(t, nil, "in.csv", "a,b\n1,2\n", nil)
+			if strict == "" {
+				// Без STRICT_SCHEMA расхождения только логируются.
+				if rec.Code != http.StatusOK {
+					t.Errorf("lenient mode: %d %s", rec.Code, rec.Body)
+				}
+				return
+			}
+			e, _ := decodeBody(t, rec, http.StatusBadGateway)["error"].(map[string]any)
+			violations, _ := e["violations"].([]any)
+			if e["code"] != "schema" || len(violations) != 4 {
+				t.Errorf("strict mode error = %v", e)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Подписанные ссылки на скачивание: HMAC-SHA256 от id и срока действия
+// ключом DOWNLOAD_SIGNING_KEY. Такая ссылка открывает файл без проверки
+// tenant'а (ей можно поделиться), но только до expires — независимо от
+// срока хранения самой записи.
+var (
+	errSignatureInvalid = errors.New("invalid download signature")
+	errSignatureExpired = errors.New("download link has expired")
+)
+
+func signingKey() []byte { return []byte(getenv("DOWNLOAD_SIGNING_KEY", "")) }
+
+func downloadSignature(key []byte, id string, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedDownloadURL возвращает ссылку и её срок; ok == false, если ключ
+// подписи не задан.
+func signedDownloadURL(id string, now time.Time) (link string, expiresAt time.Time, ok bool) {
+	key := signingKey()
+	if len(key) == 0 {
+		return "", time.Time{}, false
+	}
+	expiresAt = now.Add(getenvDuration("SIGNED_URL_TTL", 24*time.Hour)).Truncate(time.Second)
+	expires := expiresAt.Unix()
+	q := url.Values{
+		"id":      {id},
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {downloadSignature(key, id, expires)},
+	}
+	return "/download?" + q.Encode(), expiresAt, true
+}
+
+// verifyDownloadSignature проверяет sig и expires из query.
+func verifyDownloadSignature(q url.Values, now time.Time) error {
+	key := signingKey()
+	if len(key) == 0 {
+		return errSignatureInvalid
+	}
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		return errSignatureInvalid
+	}
+	want := downloadSignature(key, q.Get("id"), expires)
+	if !hmac.Equal([]byte(want), []byte(q.Get("sig"))) {
+		return errSignatureInvalid
+	}
+	if now.Unix() > expires {
+		return errSignatureExpired
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedDownloadURL(t *testing.T) {
+	t.Setenv("DOWNLOAD_SIGNING_KEY", "secret")
+	t.Setenv("SIGNED_URL_TTL", "1h")
+	now := time.Unix(1_700_000_000, 0)
+	id := genID()
+	link, expiresAt, ok := signedDownloadURL(id, now)
+	if !ok {
+		t.Fatal("signedDownloadURL: ok = false with a signing key")
+	}
+	if !expiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("expiresAt = %v, want %v", expiresAt, now.Add(time.Hour))
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := u.Query()
+
+	with := func(k, v string) url.Values {
+		q := url.Values{}
+		for key, vs := range valid {
+			q[key] = append([]string(nil), vs...)
+		}
+		q.Set(k, v)
+		return q
+	}
+	tests := []struct {
+		name string
+		q    url.Values
+		now  time.Time
+		want error
+	}{
+		{"valid", valid, now, nil},
+		{"valid at expiry", valid, expiresAt, nil},
+		{"expired", valid, expiresAt.Add(time.Second), errSignatureExpired},
+		{"tampered id", with("id", genID()), now, errSignatureInvalid},
+		{"extended expiry", with("expires", "9999999999"), now, errSignatureInvalid},
+		{"tampered sig", with("sig", strings.Repeat("0", 64)), now, errSignatureInvalid},
+		{"missing expires", with("expires", ""), now, errSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyDownloadSignature(tt.q, tt.now); !errors.Is(err, tt.want) {
+				t.Errorf("verifyDownloadSignature = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("other key", func(t *testing.T) {
+		t.Setenv("DOWNLOAD_SIGNING_KEY", "rotated")
+		if err := verifyDownloadSignature(valid, now); !errors.Is(err, errSignatureInvalid) {
+			t.Errorf("verifyDownloadSignature = %v, want %v", err, errSignatureInvalid)
+		}
+	})
+	t.Run("no key", func(t *testing.T) {
+		t.Setenv("DOWNLOAD_SIGNING_KEY", "")
+		if _, _, ok := signedDownloadURL(id, now); ok {
+			t.Error("signedDownloadURL: ok = true without a signing key")
+		}
+		if err := verifyDownloadSignature(valid, now); !errors.Is(err, errSignatureInvalid) {
+			t.Errorf("verifyDownloadSignature = %v, want %v", err, errSignatureInvalid)
+		}
+	})
+}
+
+func TestDownloadSignedLink(t *testing.T) {
+	defer func(s *resultStore) { store = s }(store)
+	store = newResultStore(10)
+	t.Setenv("DOWNLOAD_SIGNING_KEY", "secret")
+	id := genID()
+	// Запись другого tenant'а: без подписи её не видно.
+	store.Store(id, newRecord("classic.csv", []byte("a\n1\n"), "team-a"))
+
+	fresh, _, _ := signedDownloadURL(id, time.Now())
+	stale, _, _ := signedDownloadURL(id, time.Now().Add(-48*time.Hour))
+	tests := []struct {
+		name   string
+		method string
+		target string
+		status int
+	}{
+		{"unsigned other tenant", http.MethodGet, "/download?id=" + id, http.StatusNotFound},
+		{"signed", http.MethodGet, fresh, http.StatusOK},
+		{"expired", http.MethodGet, stale, http.StatusForbidden},
+		{"tampered", http.MethodGet, strings.Replace(fresh, "sig=", "sig=0", 1), http.StatusForbidden},
+		{"signed delete", http.MethodDelete, fresh, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			download(rec, httptest.NewRequest(tt.method, tt.target, nil))
+			if rec.Code != tt.status {
+				t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, rec.Code, tt.status)
+			}
+		})
+	}
+}
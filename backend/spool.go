@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// spoolKeys — поля вывода runner.py с base64-содержимым файлов.
+var spoolKeys = map[string]bool{"base64": true, "csv_base64": true}
+
+// spoolBase64Fields копирует JSON из src в dst, по ходу чтения декодируя
+// строковые значения полей base64/csv_base64 длиннее minSize прямо в файлы
+// dir/spool-N.bin. Значение заменяется пустой строкой, а рядом добавляется
+// поле <key>_path с именем файла, так что структура вывода для схемы не
+// меняется. Ни закодированная, ни декодированная строка целиком в памяти
+// не держится. Остальной текст (в том числе не-JSON) копируется как есть.
+func spoolBase64Fields(dst io.Writer, src io.Reader, dir string, minSize int) error {
+	br := bufio.NewReaderSize(src, 64<<10)
+	bw := bufio.NewWriterSize(dst, 64<<10)
+	var (
+		stack     []byte // открытые { и [
+		expectKey bool
+		spooled   int
+	)
+	for {
+		c, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return bw.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		switch c {
+		case '{':
+			stack = append(stack, c)
+			expectKey = true
+		case '[':
+			stack = append(stack, c)
+			expectKey = false
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			expectKey = false
+		case ',':
+			expectKey = len(stack) > 0 && stack[len(stack)-1] == '{'
+		case '"':
+			if !expectKey {
+				bw.WriteByte(c)
+				if err := copyJSONString(bw, br); err != nil {
+					return passEOF(bw, err)
+				}
+				continue
+			}
+			expectKey = false
+			raw, key, err := readJSONString(br)
+			if err != nil {
+				bw.Write(raw)
+				return passEOF(bw, err)
+			}
+			sep := readSeparator(br)
+			next, _ := br.Peek(1)
+			if !spoolKeys[key] || minSize <= 0 || !bytes.Contains(sep, []byte(":")) || len(next) == 0 || next[0] != '"' {
+				bw.Write(raw)
+				bw.Write(sep)
+				continue
+			}
+			_, _ = br.ReadByte()
+			name := fmt.Sprintf("spool-%d.bin", spooled+1)
+			inline, err := spoolString(br, filepath.Join(dir, name), minSize)
+			if err != nil {
+				return fmt.Errorf("decode %s: %w", key, err)
+			}
+			bw.Write(raw)
+			bw.Write(sep)
+			if inline != nil {
+				fmt.Fprintf(bw, `"%s"`, inline)
+				continue
+			}
+			spooled++
+			fmt.Fprintf(bw, `"","%s_path":"%s"`, key, name)
+			continue
+		}
+		bw.WriteByte(c)
+	}
+}
+
+// spoolString читает значение строки (открывающая кавычка уже прочитана).
+// Если строка короче minSize, возвращает её содержимое для вставки обратно
+// в JSON, иначе декодирует base64 в файл path и возвращает nil.
+func spoolString(br *bufio.Reader, path string, minSize int) ([]byte, error) {
+	sr := &jsonStringReader{br: br}
+	head := make([]byte, minSize)
+	n, err := io.ReadFull(sr, head)
+	if sr.done {
+		return head[:n], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := createTempFile(path)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, base64.NewDecoder(base64.StdEncoding, io.MultiReader(bytes.NewReader(head), sr)))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && !sr.done {
+		// Декодер остановился на паддинге раньше конца строки.
+		err = errors.New("trailing data after base64 padding")
+	}
+	return nil, err
+}
+
+// jsonStringReader отдаёт содержимое JSON-строки до закрывающей кавычки.
+// base64 не требует экранирования, допускается только \/.
+type jsonStringReader struct {
+	br   *bufio.Reader
+	done bool
+}
+
+func (s *jsonStringReader) Read(p []byte) (int, error) {
+	if s.done {
+		return 0, io.EOF
+	}
+	buf, err := s.br.Peek(max(1, min(len(p), s.br.Buffered())))
+	if len(buf) == 0 {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	i := bytes.IndexAny(buf, `"\`)
+	switch {
+	case i < 0:
+		n := copy(p, buf)
+		_, _ = s.br.Discard(n)
+		return n, nil
+	case i > 0:
+		n := copy(p, buf[:i])
+		_, _ = s.br.Discard(n)
+		return n, nil
+	case buf[0] == '"':
+		_, _ = s.br.Discard(1)
+		s.done = true
+		return 0, io.EOF
+	}
+	esc, _ := s.br.Peek(2)
+	if len(esc) < 2 || esc[1] != '/' {
+		return 0, errors.New("unexpected escape in base64 string")
+	}
+	_, _ = s.br.Discard(2)
+	p[0] = '/'
+	return 1, nil
+}
+
+// copyJSONString копирует строку до закрывающей кавычки включительно.
+func copyJSONString(bw *bufio.Writer, br *bufio.Reader) error {
+	escaped := false
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		bw.WriteByte(c)
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			return nil
+		}
+	}
+}
+
+// readJSONString читает строку-ключ (открывающая кавычка уже прочитана) и
+// возвращает её исходный текст с кавычками и значение. Некорректный ключ
+// не ошибка: такой текст просто не совпадёт со spoolKeys.
+func readJSONString(br *bufio.Reader) (raw []byte, key string, err error) {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	w := bufio.NewWriter(&buf)
+	err = copyJSONString(w, br)
+	_ = w.Flush()
+	if err == nil {
+		_ = json.Unmarshal(buf.Bytes(), &key)
+	}
+	return buf.Bytes(), key, err
+}
+
+// passEOF: обрыв ввода внутри строки — не ошибка разбора, вывод runner.py
+// может быть и не JSON; всё прочитанное уже скопировано.
+func passEOF(bw *bufio.Writer, err error) error {
+	if errors.Is(err, io.EOF) {
+		return bw.Flush()
+	}
+	return err
+}
+
+// readSeparator читает пробелы и двоеточие между ключом и значением.
+func readSeparator(br *bufio.Reader) []byte {
+	var sep []byte
+	for {
+		b, err := br.Peek(1)
+		if err != nil || !bytes.ContainsAny(b, " \t\r\n:") {
+			return sep
+		}
+		sep = append(sep, b[0])
+		_, _ = br.Discard(1)
+	}
+}
+
+// stdoutSpool — stdout runner.py, пропущенный через spoolBase64Fields в
+// отдельной горутине. Close дожидается конца разбора и возвращает его ошибку.
+type stdoutSpool struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func newStdoutSpool(dst io.Writer, dir string, minSize int) *stdoutSpool {
+	pr, pw := io.Pipe()
+	s := &stdoutSpool{pw: pw, done: make(chan error, 1)}
+	go func() {
+		err := spoolBase64Fields(dst, pr, dir, minSize)
+		// После ошибки дочитываем вывод, чтобы runner.py не встал на записи.
+		_, _ = io.Copy(io.Discard, pr)
+		s.done <- err
+	}()
+	return s
+}
+
+func (s *stdoutSpool) Write(p []byte) (int, error) { return s.pw.Write(p) }
+
+func (s *stdoutSpool) Close() error {
+	_ = s.pw.Close()
+	return <-s.done
+}
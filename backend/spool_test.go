@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// payload — детерминированные «бинарные» данные заданного размера.
+func payload(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+func TestSpoolBase64Fields(t *testing.T) {
+	big := payload(3001)
+	bigB64 := base64.StdEncoding.EncodeToString(big)
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		files   map[string][]byte
+		wantErr bool
+	}{
+		{
+			name: "short value stays inline",
+			in:   `{"csv_base64":"aGVsbG8=","csv_filename":"a.csv"}`,
+			want: `{"csv_base64":"aGVsbG8=","csv_filename":"a.csv"}`,
+		},
+		{
+			name:  "long value goes to file",
+			in:    `{"csv_base64": "` + bigB64 + `", "x": 1}`,
+			want:  `{"csv_base64": "","csv_base64_path":"spool-1.bin", "x": 1}`,
+			files: map[string][]byte{"spool-1.bin": big},
+		},
+		{
+			name:  "files array",
+			in:    `{"csv_files":[{"name":"a.csv","base64":"` + bigB64 + `"},{"name":"b.csv","base64":"` + bigB64 + `"}]}`,
+			want:  `{"csv_files":[{"name":"a.csv","base64":"","base64_path":"spool-1.bin"},{"name":"b.csv","base64":"","base64_path":"spool-2.bin"}]}`,
+			files: map[string][]byte{"spool-1.bin": big, "spool-2.bin": big},
+		},
+		{
+			name:  "escaped slash",
+			in:    `{"base64":"` + strings.ReplaceAll(bigB64, "/", `\/`) + `"}`,
+			want:  `{"base64":"","base64_path":"spool-1.bin"}`,
+			files: map[string][]byte{"spool-1.bin": big},
+		},
+		{
+			name: "other keys and array values untouched",
+			in:   `{"name":"` + bigB64 + `","list":["base64","` + bigB64 + `"],"k\"ey":"base64"}`,
+			want: `{"name":"` + bigB64 + `","list":["base64","` + bigB64 + `"],"k\"ey":"base64"}`,
+		},
+		{
+			name: "non-JSON output passes through",
+			in:   "Traceback (most recent call last):\n  File \"runner.py\n",
+			want: "Traceback (most recent call last):\n  File \"runner.py\n",
+		},
+		{
+			name:    "garbage after padding",
+			in:      `{"base64":"` + bigB64 + `AAAA"}`,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported escape",
+			in:      `{"base64":"` + bigB64[:2000] + `\n` + bigB64[2000:] + `"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var out bytes.Buffer
+			err := spoolBase64Fields(&out, strings.NewReader(tt.in), dir, 1024)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got output %q", out.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output:\n got %.200q\nwant %.200q", out.String(), tt.want)
+			}
+			for name, want := range tt.files {
+				got, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s: decoded %d bytes, want %d", name, len(got), len(want))
+				}
+			}
+			if names, _ := filepath.Glob(filepath.Join(dir, "spool-*")); len(names) != len(tt.files) {
+				t.Errorf("spool files = %v, want %d", names, len(tt.files))
+			}
+		})
+	}
+}
+
+// TestSpooledResultRoundTrip прогоняет вывод runner.py через spool и
+// resultCollector и сверяет то, что отдаёт store, с исходными данными.
+func TestSpooledResultRoundTrip(t *testing.T) {
+	classic, quantum := payload(200<<10), payload(50 << 10)[7:]
+	for _, dir := range []string{"", t.TempDir()} {
+		t.Run(fmt.Sprintf("STORE_DIR=%q", dir), func(t *testing.T) {
+			defer func(old string) { storeDir = old }(storeDir)
+			storeDir = dir
+			outDir := t.TempDir()
+			in := fmt.Sprintf(`{"csv_files":[{"name":"classic.csv","base64":%q},{"name":"quantum.csv","base64":%q}],"summary":{}}`,
+				base64.StdEncoding.EncodeToString(classic), base64.StdEncoding.EncodeToString(quantum))
+			var out bytes.Buffer
+			if err := spoolBase64Fields(&out, strings.NewReader(in), outDir, 4096); err != nil {
+				t.Fatal(err)
+			}
+			if out.Len() > 512 {
+				t.Fatalf("payload was not spooled: %d bytes of JSON left", out.Len())
+			}
+			var result map[string]any
+			if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			c := &resultCollector{primaryKey: "submission_csv", workers: 2, downloads: map[string]string{}}
+			downloads, err := c.collect(result, outDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range map[string][]byte{"classic_csv": classic, "submission_csv": classic, "quantum_csv": quantum} {
+				rec, ok := store.Load(downloads[key])
+				if !ok {
+					t.Fatalf("%s: not in store (downloads %v)", key, downloads)
+				}
+				rc, err := rec.reader()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := io.ReadAll(rc)
+				rc.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s: got %d bytes back, want %d", key, len(got), len(want))
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkResultPayload сравнивает память на разбор вывода runner.py с
+// большим файлом: через spool и целиком в памяти, как было раньше.
+func BenchmarkResultPayload(b *testing.B) {
+	in := []byte(`{"csv_base64":"` + base64.StdEncoding.EncodeToString(payload(16<<20)) + `","summary":{}}`)
+	b.Run("spool", func(b *testing.B) {
+		dir := b.TempDir()
+		b.ReportAllocs()
+		b.SetBytes(int64(len(in)))
+		for b.Loop() {
+			if err := spoolBase64Fields(io.Discard, bytes.NewReader(in), dir, 4<<20); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("in-memory", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(in)))
+		for b.Loop() {
+			var result map[string]any
+			if err := json.Unmarshal(in, &result); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := base64.StdEncoding.DecodeString(result["csv_base64"].(string)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
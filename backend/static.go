@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Текстовые ассеты SPA, которые имеет смысл сжимать на лету.
+var compressibleExts = map[string]bool{
+	".html": true, ".js": true, ".mjs": true, ".css": true,
+	".json": true, ".svg": true, ".txt": true, ".map": true,
+}
+
+// serveStatic отдаёт файл SPA. Если рядом лежит предсжатый path+".gz" и
+// клиент принимает gzip — отдаётся он; иначе текстовые файлы сжимаются
+// на лету, остальное идёт через http.ServeFile как раньше.
+func serveStatic(w http.ResponseWriter, r *http.Request, path string) {
+	accept := r.Header.Get("Accept-Encoding")
+	ext := strings.ToLower(filepath.Ext(path))
+	ctype := mime.TypeByExtension(ext)
+
+	if acceptsEncoding(accept, "gzip") {
+		if f, err := os.Open(path + ".gz"); err == nil {
+			defer f.Close()
+			if fi, err := f.Stat(); err == nil && !fi.IsDir() {
+				w.Header().Add("Vary", "Accept-Encoding")
+				w.Header().Set("Content-Encoding", "gzip")
+				if ctype != "" {
+					w.Header().Set("Content-Type", ctype)
+				}
+				// Имя без .gz, чтобы ServeContent не вывел тип application/gzip.
+				http.ServeContent(w, r, filepath.Base(path), fi.ModTime(), f)
+				return
+			}
+		}
+	}
+
+	enc := negotiateEncoding(accept)
+	if enc == "identity" || !compressibleExts[ext] || r.Header.Get("Range") != "" {
+		http.ServeFile(w, r, path)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.ServeFile(w, r, path)
+		return
+	}
+	defer f.Close()
+	if ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	body := encodeResponse(w, enc)
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		if _, err := io.Copy(body, f); err != nil {
+			log.Printf("Static %s interrupted: %v", path, err)
+		}
+	}
+	body.Close()
+}
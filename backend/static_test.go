@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	io.WriteString(zw, s)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestServeStatic(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>plain</html>"), 0o600)
+	// Предсжатая версия отличается содержимым, чтобы видеть, какая отдана.
+	os.WriteFile(filepath.Join(dir, "index.html.gz"), gzipBytes(t, "<html>precompressed</html>"), 0o600)
+	os.WriteFile(filepath.Join(dir, "app.js"), []byte(strings.Repeat("console.log(1);\n", 50)), 0o600)
+	os.WriteFile(filepath.Join(dir, "logo.png"), []byte("\x89PNG fake"), 0o600)
+
+	tests := []struct {
+		file, accept string
+		encoding     string
+		body         string
+		ctype        string
+	}{
+		{"index.html", "gzip, deflate", "gzip", "<html>precompressed</html>", "text/html; charset=utf-8"},
+		{"index.html", "", "", "<html>plain</html>", "text/html; charset=utf-8"},
+		{"app.js", "gzip", "gzip", strings.Repeat("console.log(1);\n", 50), "text/javascript; charset=utf-8"},
+		{"logo.png", "gzip", "", "\x89PNG fake", "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file+" "+tt.accept, func(t *testing.T) {
+			// index.html отдаётся на "/", как в обработчике SPA в main.
+			req := httptest.NewRequest(http.MethodGet, "/"+strings.TrimPrefix(tt.file, "index.html"), nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			serveStatic(rec, req, filepath.Join(dir, tt.file))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d", rec.Code)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.ctype {
+				t.Errorf("Content-Type = %q, want %q", got, tt.ctype)
+			}
+			body := rec.Body.Bytes()
+			if tt.encoding == "gzip" {
+				zr, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ = io.ReadAll(zr)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type csvRecord struct {
+	Name   string
+	Data   []byte
+	Tenant string
+	// Size — размер несжатых данных; при Gzipped Data хранится в gzip.
+	Size    int64
+	Gzipped bool
+	SHA256  string
+	// ExpiresAt — момент, после которого запись считается удалённой;
+	// нулевое значение — хранится, пока не вытеснит LRU.
+	ExpiresAt time.Time
+	// Path — файл в STORE_DIR с несжатыми данными; тогда Data пуст.
+	Path  string
+	JobID string
+}
+
+func (rec csvRecord) expired(now time.Time) bool {
+	return !rec.ExpiresAt.IsZero() && now.After(rec.ExpiresAt)
+}
+
+// compressStore включает хранение результатов в памяти в сжатом виде (COMPRESS_STORE).
+var compressStore bool
+
+// storeDir — каталог для хранения результатов на диске (STORE_DIR);
+// пустая строка — всё держится в памяти.
+var storeDir string
+
+func newRecord(name string, data []byte, tenant string) csvRecord {
+	sum := sha256.Sum256(data)
+	rec := csvRecord{Name: name, Data: data, Tenant: tenant, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+	if !compressStore {
+		return rec
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil || zw.Close() != nil {
+		return rec
+	}
+	if buf.Len() < len(data) {
+		rec.Data = bytes.Clone(buf.Bytes())
+		rec.Gzipped = true
+	}
+	return rec
+}
+
+// persistRecord переносит данные записи в файл dir/<id>.csv, чтобы не
+// держать их в памяти.
+func persistRecord(dir, id string, rec csvRecord, data []byte) (csvRecord, error) {
+	path := filepath.Join(dir, id+".csv")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return rec, err
+	}
+	rec.Data, rec.Gzipped, rec.Path = nil, false, path
+	return rec, nil
+}
+
+// persistFile копирует файл src в dir/<id>.csv, по дороге считая размер и
+// SHA-256, и удаляет src.
+func persistFile(dir, id, src string) (csvRecord, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return csvRecord{}, err
+	}
+	defer in.Close()
+	path := filepath.Join(dir, id+".csv")
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return csvRecord{}, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return csvRecord{}, err
+	}
+	_ = os.Remove(src)
+	return csvRecord{Path: path, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// cleanStoreDir удаляет файлы результатов, оставшиеся от прошлого запуска:
+// индекс хранится только в памяти, так что они уже недоступны.
+func cleanStoreDir(dir string) {
+	names, _ := filepath.Glob(filepath.Join(dir, "*.csv"))
+	for _, name := range names {
+		if downloadIDRe.MatchString(strings.TrimSuffix(filepath.Base(name), ".csv")) {
+			_ = os.Remove(name)
+		}
+	}
+}
+
+// reader возвращает несжатое содержимое записи, распаковывая на лету;
+// вызывающий закрывает его.
+func (rec csvRecord) reader() (io.ReadCloser, error) {
+	switch {
+	case rec.Path != "":
+		return os.Open(rec.Path)
+	case rec.Gzipped:
+		return gzip.NewReader(bytes.NewReader(rec.Data))
+	default:
+		return io.NopCloser(bytes.NewReader(rec.Data)), nil
+	}
+}
+
+// storedBytes — сколько места запись занимает в памяти или на диске.
+func (rec csvRecord) storedBytes() int64 {
+	if rec.Path != "" {
+		return rec.Size
+	}
+	return int64(len(rec.Data))
+}
+
+// resultStore — потокобезопасный LRU поверх map: при превышении max
+// вытесняется запись, к которой дольше всех не обращались.
+type resultStore struct {
+	mu    sync.Mutex
+	max   int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type storeEntry struct {
+	id  string
+	rec csvRecord
+}
+
+func newResultStore(max int) *resultStore {
+	return &resultStore{
+		max:   max,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (s *resultStore) Store(id string, rec csvRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[id]; ok {
+		el.Value.(*storeEntry).rec = rec
+		s.ll.MoveToFront(el)
+		return
+	}
+	s.items[id] = s.ll.PushFront(&storeEntry{id: id, rec: rec})
+	for s.max > 0 && s.ll.Len() > s.max {
+		s.remove(s.ll.Back())
+	}
+}
+
+// SetMax меняет ёмкость; лишние записи вытесняются сразу.
+func (s *resultStore) SetMax(max int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.max = max
+	for s.max > 0 && s.ll.Len() > s.max {
+		s.remove(s.ll.Back())
+	}
+}
+
+func (s *resultStore) Load(id string) (csvRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.live(id)
+	if !ok {
+		return csvRecord{}, false
+	}
+	s.ll.MoveToFront(el)
+	return el.Value.(*storeEntry).rec, true
+}
+
+// Peek читает запись, не меняя её позицию в LRU (не считается скачиванием).
+func (s *resultStore) Peek(id string) (csvRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.live(id)
+	if !ok {
+		return csvRecord{}, false
+	}
+	return el.Value.(*storeEntry).rec, true
+}
+
+// live находит запись, удаляя её, если срок хранения истёк. Вызывать под s.mu.
+func (s *resultStore) live(id string) (*list.Element, bool) {
+	el, ok := s.items[id]
+	if !ok {
+		return nil, false
+	}
+	if el.Value.(*storeEntry).rec.expired(time.Now()) {
+		s.remove(el)
+		return nil, false
+	}
+	return el, true
+}
+
+func (s *resultStore) remove(el *list.Element) {
+	e := el.Value.(*storeEntry)
+	s.ll.Remove(el)
+	delete(s.items, e.id)
+	if e.rec.Path != "" {
+		if err := os.Remove(e.rec.Path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove stored result %s: %v", e.id, err)
+		}
+	}
+}
+
+// Delete удаляет запись досрочно (DELETE /download).
+func (s *resultStore) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[id]
+	if ok {
+		s.remove(el)
+	}
+	return ok
+}
+
+// Sweep удаляет все записи с истёкшим сроком; возвращает их число и
+// освобождённый объём хранимых данных.
+func (s *resultStore) Sweep(now time.Time) (int, int64) {
+	return s.removeIf(func(rec csvRecord) bool { return rec.expired(now) })
+}
+
+// Clear удаляет все записи (POST /admin/flush).
+func (s *resultStore) Clear() (int, int64) {
+	return s.removeIf(func(csvRecord) bool { return true })
+}
+
+func (s *resultStore) removeIf(match func(csvRecord) bool) (n int, freed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for el := s.ll.Back(); el != nil; {
+		prev := el.Prev()
+		if rec := el.Value.(*storeEntry).rec; match(rec) {
+			s.remove(el)
+			n++
+			freed += rec.storedBytes()
+		}
+		el = prev
+	}
+	return n, freed
+}
+
+// searchHit — запись, найденная по имени файла.
+type searchHit struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	JobID     string     `json:"job_id,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Search ищет записи, в имени которых есть query (без учёта регистра),
+// начиная с недавно использованных; не больше limit совпадений.
+func (s *resultStore) Search(query string, limit int) []searchHit {
+	query = strings.ToLower(query)
+	now := time.Now()
+	hits := []searchHit{}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for el := s.ll.Front(); el != nil && len(hits) < limit; el = el.Next() {
+		e := el.Value.(*storeEntry)
+		if e.rec.expired(now) || !strings.Contains(strings.ToLower(e.rec.Name), query) {
+			continue
+		}
+		hit := searchHit{ID: e.id, Name: e.rec.Name, JobID: e.rec.JobID}
+		if !e.rec.ExpiresAt.IsZero() {
+			// Копия: запись может поменяться после снятия s.mu.
+			expiresAt := e.rec.ExpiresAt
+			hit.ExpiresAt = &expiresAt
+		}
+		hits = append(hits, hit)
+	}
+	return hits
+}
+
+func (s *resultStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
+
+// expireResults периодически вычищает записи с истёкшим сроком хранения,
+// чтобы они не занимали память до следующего обращения, и подрезает
+// историю задач по MAX_JOB_HISTORY / JOB_HISTORY_TTL.
+func expireResults(every time.Duration) {
+	for range time.Tick(every) {
+		now := time.Now()
+		if n, _ := store.Sweep(now); n > 0 {
+			log.Printf("Expired %d stored results", n)
+		}
+		if n := jobs.Prune(now, getenvInt("MAX_JOB_HISTORY", 1000), getenvDuration("JOB_HISTORY_TTL", 0)); n > 0 {
+			log.Printf("Pruned %d finished jobs from the history", n)
+		}
+	}
+}
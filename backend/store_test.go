@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSearchCopiesExpiresAt(t *testing.T) {
+	s := newResultStore(10)
+	expires := time.Now().Add(time.Hour).Round(0)
+	s.Store("a", csvRecord{Name: "classic.csv", ExpiresAt: expires})
+	hits := s.Search("classic", 10)
+	if len(hits) != 1 || hits[0].ExpiresAt == nil || !hits[0].ExpiresAt.Equal(expires) {
+		t.Fatalf("hits = %+v", hits)
+	}
+	// Повторное сохранение под тем же id меняет запись в store, но не
+	// уже выданный результат поиска.
+	s.Store("a", csvRecord{Name: "classic.csv", ExpiresAt: expires.Add(time.Hour)})
+	if !hits[0].ExpiresAt.Equal(expires) {
+		t.Errorf("search hit changed after the record was updated: %v, want %v", *hits[0].ExpiresAt, expires)
+	}
+}
+
+func TestResultStoreLRU(t *testing.T) {
+	tests := []struct {
+		name   string
+		max    int
+		ops    []string // "s:id" — Store, "l:id" — Load
+		remain []string
+		gone   []string
+	}{
+		{"under capacity", 3, []string{"s:a", "s:b"}, []string{"a", "b"}, nil},
+		{"evicts oldest", 2, []string{"s:a", "s:b", "s:c"}, []string{"b", "c"}, []string{"a"}},
+		{"load refreshes", 2, []string{"s:a", "s:b", "l:a", "s:c"}, []string{"a", "c"}, []string{"b"}},
+		{"restore refreshes", 2, []string{"s:a", "s:b", "s:a", "s:c"}, []string{"a", "c"}, []string{"b"}},
+		{"unbounded", 0, []string{"s:a", "s:b", "s:c"}, []string{"a", "b", "c"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newResultStore(tt.max)
+			for _, op := range tt.ops {
+				if op[0] == 's' {
+					s.Store(op[2:], csvRecord{Name: op[2:]})
+				} else {
+					s.Load(op[2:])
+				}
+			}
+			for _, id := range tt.remain {
+				if _, ok := s.Peek(id); !ok {
+					t.Errorf("%s evicted", id)
+				}
+			}
+			for _, id := range tt.gone {
+				if _, ok := s.Peek(id); ok {
+					t.Errorf("%s still stored", id)
+				}
+			}
+		})
+	}
+}
+
+func TestResultStoreConcurrent(t *testing.T) {
+	s := newResultStore(8)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				id := fmt.Sprintf("%d-%d", g, i%16)
+				s.Store(id, csvRecord{Name: id})
+				s.Load(id)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if n := s.ll.Len(); n > 8 || len(s.items) != n {
+		t.Errorf("store holds %d entries (%d indexed), want at most 8", n, len(s.items))
+	}
+}
+
+func TestCompressStore(t *testing.T) {
+	defer func(c bool, s *resultStore, m *missLimiter) { compressStore, store, downloadMiss = c, s, m }(compressStore, store, downloadMiss)
+	store = newResultStore(10)
+	downloadMiss = newMissLimiter(100, time.Minute, time.Minute)
+	random := make([]byte, 64)
+	rand.Read(random)
+
+	tests := []struct {
+		name     string
+		compress bool
+		data     []byte
+		gzipped  bool
+	}{
+		{"compressible", true, []byte(strings.Repeat("route,cost\n1,2.5\n", 500)), true},
+		{"incompressible kept raw", true, random, false},
+		{"disabled", false, []byte(strings.Repeat("a,b\n", 500)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressStore = tt.compress
+			rec := newRecord("r.csv", tt.data, "")
+			if rec.Gzipped != tt.gzipped {
+				t.Fatalf("Gzipped = %v, want %v", rec.Gzipped, tt.gzipped)
+			}
+			if tt.gzipped && rec.storedBytes() >= rec.Size {
+				t.Errorf("stored %d bytes for %d bytes of data", rec.storedBytes(), rec.Size)
+			}
+			sum := sha256.Sum256(tt.data)
+			if rec.Size != int64(len(tt.data)) || rec.SHA256 != hex.EncodeToString(sum[:]) {
+				t.Errorf("Size, SHA256 = %d, %s; want those of the uncompressed data", rec.Size, rec.SHA256)
+			}
+			r, err := rec.reader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := io.ReadAll(r)
+			r.Close()
+			if string(got) != string(tt.data) {
+				t.Error("reader returned different data")
+			}
+
+			// Скачивание отдаёт исходные байты.
+			id := genID()
+			store.Store(id, rec)
+			dl := getDownload(t, "id="+id)
+			if dl.Code != http.StatusOK || dl.Body.String() != string(tt.data) {
+				t.Errorf("download = %d, %d bytes; want the original %d bytes", dl.Code, dl.Body.Len(), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestRetainOverride(t *testing.T) {
+	fakeRunner(t, echoRunner)
+	t.Setenv("RETAIN_MAX", "2h")
+	t.Setenv("RESULT_TTL", "")
+	tests := []struct {
+		retain string
+		want   time.Duration // 0 — без срока
+	}{
+		{"", 0},
+		{"3600", time.Hour},
+		{"30m", 30 * time.Minute},
+		{"48h", 2 * time.Hour}, // урезается до RETAIN_MAX
+	}
+	for _, tt := range tests {
+		t.Run(tt.retain, func(t *testing.T) {
+			form := url.Values{}
+			if tt.retain != "" {
+				form.Set("retain", tt.retain)
+			}
+			start := time.Now()
+			got := decodeBody(t, postProcess(t, form, "in.csv", "a,b\n1,2\n", nil), http.StatusOK)
+			for key, id := range got["downloads"].(map[string]any) {
+				rec, ok := store.Peek(id.(string))
+				if !ok {
+					t.Fatalf("%s not stored", key)
+				}
+				if tt.want == 0 {
+					if !rec.ExpiresAt.IsZero() {
+						t.Errorf("%s expires at %s, want no expiry", key, rec.ExpiresAt)
+					}
+					continue
+				}
+				if left := rec.ExpiresAt.Sub(start); left < tt.want || left > tt.want+time.Minute {
+					t.Errorf("%s expires in %s, want %s", key, left, tt.want)
+				}
+			}
+		})
+	}
+
+	for _, bad := range []string{"0", "-5m", "forever"} {
+		if rec := postProcess(t, url.Values{"retain": {bad}}, "in.csv", "a,b\n1,2\n", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("retain=%s: %d, want 400", bad, rec.Code)
+		}
+	}
+}
+
+func TestStoreDirStreaming(t *testing.T) {
+	defer func(s *resultStore, dir string) { store, storeDir = s, dir }(store, storeDir)
+	store = newResultStore(2)
+	storeDir = t.TempDir()
+	fakeRunner(t, echoRunner)
+
+	input := "route,cost\n1,2\n3,4\n"
+	got := decodeBody(t, postProcess(t, nil, "in.csv", input, nil), http.StatusOK)
+	id := got["downloads"].(map[string]any)["quantum_csv"].(string)
+	rec, ok := store.Peek(id)
+	if !ok || rec.Path == "" || rec.Data != nil {
+		t.Fatalf("record not on disk: %+v", rec)
+	}
+	if filepath.Dir(rec.Path) != storeDir {
+		t.Errorf("stored at %s, want under %s", rec.Path, storeDir)
+	}
+
+	full := getDownload(t, "id="+id)
+	if full.Code != http.StatusOK || full.Body.String() != "route,cost\n1,2\n" {
+		t.Fatalf("download: %d %q", full.Code, full.Body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/download?id="+id, nil)
+	req.Header.Set("Range", "bytes=0-4")
+	part := httptest.NewRecorder()
+	download(part, req)
+	if part.Code != http.StatusPartialContent || part.Body.String() != "route" {
+		t.Errorf("range: %d %q", part.Code, part.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/download?id="+id, nil)
+	req.Header.Set("If-None-Match", full.Header().Get("ETag"))
+	cached := httptest.NewRecorder()
+	download(cached, req)
+	if cached.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: status %d", cached.Code)
+	}
+
+	// Вытеснение удаляет файл с диска.
+	for range 2 {
+		store.Store(genID(), newRecord("other.csv", []byte("x\n"), ""))
+	}
+	if _, err := os.Stat(rec.Path); !os.IsNotExist(err) {
+		t.Errorf("evicted file still on disk: %v", err)
+	}
+}
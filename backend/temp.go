@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Права временных каталогов и файлов с загрузками (TEMP_DIR_MODE,
+// TEMP_FILE_MODE, восьмеричные). Umask процесса может их только сузить.
+var (
+	tempDirMode  os.FileMode = 0o700
+	tempFileMode os.FileMode = 0o600
+)
+
+// parseFileMode читает права из key. owner — биты владельца, без которых
+// сервер не сможет работать со своими же файлами (0700 для каталогов,
+// 0600 для файлов): такое значение отклоняется при старте, а не падает
+// на первой загрузке.
+func parseFileMode(key string, def, owner os.FileMode) (os.FileMode, error) {
+	v := getenv(key, "")
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(v, 8, 32)
+	if err != nil || n > 0o777 {
+		return 0, fmt.Errorf("%s must be an octal permission mode like 0700, got %q", key, v)
+	}
+	if mode := os.FileMode(n); mode&owner != owner {
+		return 0, fmt.Errorf("%s=%q must grant the owner at least %#o", key, v, owner)
+	}
+	return os.FileMode(n), nil
+}
+
+// makeTempDir — os.MkdirTemp с правами tempDirMode.
+func makeTempDir(pattern string) (string, error) {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(dir, tempDirMode); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// createTempFile — os.Create с правами tempFileMode вместо 0666.
+func createTempFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, tempFileMode)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		owner   os.FileMode
+		want    os.FileMode
+		wantErr bool
+	}{
+		{"", 0o700, 0o700, false},
+		{"0750", 0o700, 0o750, false},
+		{"770", 0o700, 0o770, false},
+		{"0600", 0o700, 0, true}, // каталог без x: в него нельзя войти
+		{"0500", 0o700, 0, true},
+		{"0077", 0o700, 0, true},
+		{"0640", 0o600, 0o640, false},
+		{"0400", 0o600, 0, true},
+		{"0800", 0o700, 0, true},
+		{"01777", 0o700, 0, true},
+		{"rwx", 0o700, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TEMP_DIR_MODE", tt.value)
+			got, err := parseFileMode("TEMP_DIR_MODE", tt.owner, tt.owner)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("mode = %#o, want %#o", got, tt.want)
+			}
+		})
+	}
+}
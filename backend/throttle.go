@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// downloadRate — лимит скорости отдачи одного скачивания, байт/с
+// (DOWNLOAD_RATE_BYTES_PER_SEC); 0 — без ограничения.
+var downloadRate int64
+
+// throttledWriter — token bucket поверх ResponseWriter: за секунду
+// накапливается rate байт, всплеск не больше одной секунды трафика.
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx    context.Context
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func throttle(w http.ResponseWriter, ctx context.Context, rate int64) http.ResponseWriter {
+	if rate <= 0 {
+		return w
+	}
+	return &throttledWriter{ResponseWriter: w, ctx: ctx, rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	// Пишем порциями примерно по 100 мс трафика, чтобы не дробить вывод.
+	step := max(t.rate/10, 1)
+	for len(p) > 0 {
+		now := time.Now()
+		t.tokens = min(t.rate, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+		t.last = now
+		need := min(float64(len(p)), step)
+		if t.tokens < need {
+			timer := time.NewTimer(time.Duration((need - t.tokens) / t.rate * float64(time.Second)))
+			select {
+			case <-t.ctx.Done():
+				timer.Stop()
+				return written, t.ctx.Err()
+			case <-timer.C:
+			}
+			continue
+		}
+		n, err := t.ResponseWriter.Write(p[:int(need)])
+		written += n
+		t.tokens -= float64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (t *throttledWriter) Unwrap() http.ResponseWriter { return t.ResponseWriter }
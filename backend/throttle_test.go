@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDownloadThrottle(t *testing.T) {
+	defer func(s *resultStore, rate int64) { store, downloadRate = s, rate }(store, downloadRate)
+	store = newResultStore(10)
+	data := bytes.Repeat([]byte("0123456789"), 3000) // 30 000 байт
+	id := genID()
+	store.Store(id, newRecord("big.csv", data, ""))
+
+	tests := []struct {
+		rate    int64
+		minTime time.Duration
+	}{
+		{0, 0},
+		// Первые 20 000 байт — всплеск, остальные 10 000 — за ~0.5 с.
+		{20000, 400 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		downloadRate = tt.rate
+		start := time.Now()
+		rec := getDownload(t, "id="+id)
+		elapsed := time.Since(start)
+		if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), data) {
+			t.Fatalf("rate %d: %d, %d bytes", tt.rate, rec.Code, rec.Body.Len())
+		}
+		if elapsed < tt.minTime || (tt.rate == 0 && elapsed > 200*time.Millisecond) {
+			t.Errorf("rate %d: download took %s, want at least %s", tt.rate, elapsed, tt.minTime)
+		}
+	}
+}
+
+func TestThrottleStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rec := httptest.NewRecorder()
+	w := throttle(rec, ctx, 1000)
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	n, err := w.Write(make([]byte, 5000))
+	if !errors.Is(err, context.Canceled) || time.Since(start) > time.Second {
+		t.Errorf("Write = %d, %v after %s; want to stop on cancel", n, err, time.Since(start))
+	}
+	// До отмены успевает уйти только начальный всплеск (~1 с трафика).
+	if n < 1000 || n > 1500 {
+		t.Errorf("written %d bytes before cancel, want about 1000", n)
+	}
+	if throttle(rec, ctx, 0) != http.ResponseWriter(rec) {
+		t.Error("rate 0 must return the writer unchanged")
+	}
+}
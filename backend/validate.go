@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Обязательные колонки входного CSV; сравниваются после нормализации имён
+// (так же, как в csv_parser.py: lower-case, без пробелов, "-" и "_").
+var requiredColumns = []string{"graph_index", "graph_matrix", "routes_start_end"}
+
+const maxReportedIssues = 100
+
+type csvIssue struct {
+	Line    int    `json:"line"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// csvReport — результат проверки входного файла без запуска оптимизатора.
+type csvReport struct {
+	Valid           bool         `json:"valid"`
+	Delimiter       string       `json:"delimiter"`
+	Columns         []string     `json:"columns"`
+	HeaderDetected  bool         `json:"header_detected"`
+	InferredSchema  []columnType `json:"inferred_schema,omitempty"`
+	Rows            int          `json:"rows"`
+	Issues          []csvIssue   `json:"issues"`
+	IssuesTruncated bool         `json:"issues_truncated,omitempty"`
+}
+
+func (rep *csvReport) issue(line int, column, format string, args ...any) {
+	if len(rep.Issues) >= maxReportedIssues {
+		rep.IssuesTruncated = true
+		return
+	}
+	rep.Issues = append(rep.Issues, csvIssue{Line: line, Column: column, Message: fmt.Sprintf(format, args...)})
+}
+
+func normalizeColumn(c string) string {
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(c)))
+}
+
+// validateCSV разбирает файл тем же образом, что csv_parser.py, и собирает
+// все найденные проблемы с номерами строк.
+func validateCSV(src io.Reader) csvReport {
+	rep := csvReport{Issues: []csvIssue{}}
+	br := bufio.NewReader(src)
+	delim := sniffDelimiter(br)
+	rep.Delimiter = string(delim)
+
+	cr := csv.NewReader(br)
+	cr.Comma = delim
+	cr.LazyQuotes = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			rep.issue(1, "", "file is empty")
+		} else {
+			rep.issue(1, "", "cannot read header: %v", err)
+		}
+		return rep
+	}
+	trimBOM(header)
+	rep.Columns = header
+	rep.HeaderDetected = looksLikeHeader(header)
+
+	index := map[string]int{}
+	for i, h := range header {
+		index[normalizeColumn(h)] = i
+	}
+	for _, c := range requiredColumns {
+		if _, ok := index[normalizeColumn(c)]; !ok {
+			rep.issue(1, c, "missing required column")
+		}
+	}
+	if len(rep.Issues) > 0 {
+		return rep
+	}
+
+	var infer schemaInferrer
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				line = perr.StartLine
+			}
+			rep.issue(line, "", "%v", err)
+			if !errors.Is(err, csv.ErrFieldCount) {
+				break
+			}
+			continue
+		}
+		rep.Rows++
+		infer.observe(rec)
+		validateRow(&rep, line, rec, index)
+	}
+	rep.InferredSchema = infer.result(header)
+	if rep.Rows == 0 {
+		rep.issue(1, "", "no data rows")
+	}
+	rep.Valid = len(rep.Issues) == 0
+	return rep
+}
+
+func validateRow(rep *csvReport, line int, rec []string, index map[string]int) {
+	if _, err := strconv.Atoi(strings.TrimSpace(rec[index["graphindex"]])); err != nil {
+		rep.issue(line, "graph_index", "not an integer: %q", truncate(rec[index["graphindex"]], 32))
+	}
+
+	n, err := matrixSize(rec[index["graphmatrix"]])
+	if err != nil {
+		rep.issue(line, "graph_matrix", "%v", err)
+	}
+
+	routes, err := parseRoutes(rec[index["routesstartend"]])
+	if err != nil {
+		rep.issue(line, "routes_start_end", "%v", err)
+		return
+	}
+	if n > 0 {
+		for i, v := range routes {
+			if v < 0 || v >= n {
+				rep.issue(line, "routes_start_end", "route %d references node %d outside 0..%d", i/2, v, n-1)
+				break
+			}
+		}
+	}
+}
+
+var (
+	matrixStripRe = regexp.MustCompile(`[\[\]\n\r]`)
+	matrixSplitRe = regexp.MustCompile(`[;|\t ,]+`)
+	routesStripRe = regexp.MustCompile(`[\[\]\(\);|\n\r\t,]`)
+)
+
+// matrixSize возвращает размер квадратной матрицы смежности.
+func matrixSize(s string) (int, error) {
+	tokens := splitNonEmpty(matrixSplitRe.Split(matrixStripRe.ReplaceAllString(s, " "), -1))
+	for _, t := range tokens {
+		if _, err := strconv.ParseFloat(t, 64); err != nil {
+			return 0, fmt.Errorf("matrix element %q is not a number", truncate(t, 32))
+		}
+	}
+	n := int(math.Round(math.Sqrt(float64(len(tokens)))))
+	if n*n != len(tokens) || n == 0 {
+		return 0, fmt.Errorf("%d matrix elements don't form a square matrix", len(tokens))
+	}
+	return n, nil
+}
+
+func parseRoutes(s string) ([]int, error) {
+	tokens := strings.Fields(routesStripRe.ReplaceAllString(s, " "))
+	if len(tokens)%2 != 0 {
+		return nil, fmt.Errorf("odd number of route elements: %d", len(tokens))
+	}
+	out := make([]int, len(tokens))
+	for i, t := range tokens {
+		v, err := strconv.Atoi(t)
+		if err != nil {
+			return nil, fmt.Errorf("route element %q is not an integer", truncate(t, 32))
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func splitNonEmpty(parts []string) []string {
+	out := parts[:0]
+	for _, p := range parts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// inputInfo — то, что сервер увидел во входном файле: колонки заголовка и
+// выведенные по первым строкам типы.
+type inputInfo struct {
+	Columns        []string
+	HeaderDetected bool
+	Schema         []columnType
+}
+
+// inspectInput читает заголовок (после определения разделителя) и
+// небольшую выборку строк для вывода типов колонок.
+func inspectInput(src io.Reader) (inputInfo, error) {
+	br := bufio.NewReader(src)
+	cr := csv.NewReader(br)
+	cr.Comma = sniffDelimiter(br)
+	cr.LazyQuotes = true
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return inputInfo{}, err
+	}
+	trimBOM(header)
+	var infer schemaInferrer
+	for infer.rows < inferSampleRows {
+		rec, err := cr.Read()
+		if err != nil {
+			break
+		}
+		infer.observe(rec)
+	}
+	return inputInfo{
+		Columns:        header,
+		HeaderDetected: looksLikeHeader(header),
+		Schema:         infer.result(header),
+	}, nil
+}
+
+// trimBOM убирает UTF-8 BOM из первой колонки заголовка (CSV из Excel):
+// иначе она не совпадёт с обязательной колонкой.
+func trimBOM(header []string) {
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+}
+
+// looksLikeHeader считает строку заголовком, если в ней есть хоть одно
+// нечисловое поле: файл без заголовка начинается сразу с данных.
+func looksLikeHeader(row []string) bool {
+	for _, f := range row {
+		f = strings.TrimSpace(strings.TrimPrefix(f, "\ufeff"))
+		if f == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(f, 64); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffDelimiter угадывает разделитель по первой строке (как sep=None в pandas):
+// берётся самый частый из , ; \t | вне кавычек.
+func sniffDelimiter(br *bufio.Reader) rune {
+	head, _ := br.Peek(64 << 10)
+	counts := map[rune]int{}
+	inQuotes := false
+	for _, c := range string(head) {
+		if c == '"' {
+			inQuotes = !inQuotes
+			continue
+		}
+		if c == '\n' && !inQuotes {
+			break
+		}
+		if !inQuotes && strings.ContainsRune(",;\t|", c) {
+			counts[c]++
+		}
+	}
+	best := ','
+	for _, c := range []rune{',', ';', '\t', '|'} {
+		if counts[c] > counts[best] {
+			best = c
+		}
+	}
+	return best
+}
+
+func validateUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		http.Error(w, "bad form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file required: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if !allowedExtension(filepath.Ext(header.Filename)) {
+		http.Error(w, "only .csv or .txt files are allowed", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, validateCSV(file))
+}
+
+// validateParams — POST /validate-params: только поля параметров, без
+// файла. Проверка та же, что у /process; в ответе — итоговые параметры
+// запуска после умолчаний и ограничений (например, retain до RETAIN_MAX).
+func validateParams(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseMultipartForm(multipartMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		http.Error(w, "bad form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	params, err := parseParams(r)
+	if err != nil {
+		var verr *validationError
+		if !errors.As(err, &verr) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"valid": false, "fields": verr.Fields})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"valid":      true,
+		"async":      params.Async,
+		"labels":     params.Labels,
+		"parameters": newEffectiveParameters(params),
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidateCSV(t *testing.T) {
+	const rows = "1,\"[[0,1],[1,0]]\",\"[0,1]\"\n2,\"[[0,1],[1,0]]\",\"[1,0]\"\n"
+	tests := []struct {
+		name      string
+		in        string
+		valid     bool
+		delimiter string
+		column0   string
+		issue     string
+	}{
+		{"plain", "graph_index,graph_matrix,routes_start_end\n" + rows, true, ",", "graph_index", ""},
+		{"BOM", "\ufeffgraph_index,graph_matrix,routes_start_end\n" + rows, true, ",", "graph_index", ""},
+		{"BOM semicolon", "\ufeffGraphIndex;GraphMatrix;RoutesStartEnd\n1;[[0,1],[1,0]];[0,1]\n", true, ";", "GraphIndex", ""},
+		{"missing column", "graph_index,graph_matrix\n1,\"[[0]]\"\n", false, ",", "graph_index", "missing required column"},
+		{"node out of range", "graph_index,graph_matrix,routes_start_end\n1,\"[[0,1],[1,0]]\",\"[0,5]\"\n", false, ",", "graph_index", "outside 0..1"},
+		{"empty", "", false, ",", "", "file is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rep := validateCSV(strings.NewReader(tt.in))
+			if rep.Valid != tt.valid {
+				t.Errorf("valid = %t, want %t (issues %+v)", rep.Valid, tt.valid, rep.Issues)
+			}
+			if rep.Delimiter != tt.delimiter {
+				t.Errorf("delimiter = %q, want %q", rep.Delimiter, tt.delimiter)
+			}
+			if tt.column0 != "" && (len(rep.Columns) == 0 || rep.Columns[0] != tt.column0) {
+				t.Errorf("columns = %q, want first %q", rep.Columns, tt.column0)
+			}
+			if tt.issue != "" && (len(rep.Issues) == 0 || !strings.Contains(rep.Issues[0].Message, tt.issue)) {
+				t.Errorf("issues = %+v, want %q", rep.Issues, tt.issue)
+			}
+		})
+	}
+}
+
+// TestHeaderBOM: BOM из Excel не должен мешать ни одному из читателей
+// заголовка.
+func TestHeaderBOM(t *testing.T) {
+	const in = "\ufeffgraph_index,graph_matrix,routes_start_end\n1,\"[[0,1],[1,0]]\",\"[0,1]\"\n"
+	info, err := inspectInput(strings.NewReader(in))
+	if err != nil || info.Columns[0] != "graph_index" {
+		t.Errorf("inspectInput: columns %q, err %v", info.Columns, err)
+	}
+	wl, err := measureWorkload(strings.NewReader(in))
+	if err != nil || wl.Graphs != 1 || wl.Routes != 1 {
+		t.Errorf("measureWorkload: %+v, err %v", wl, err)
+	}
+}
+
+func TestValidateUpload(t *testing.T) {
+	const good = "graph_index,graph_matrix,routes_start_end\n1,\"[[0,1],[1,0]]\",\"[0,1]\"\n"
+	tests := []struct {
+		name, filename, content string
+		status                  int
+		valid                   bool
+	}{
+		{"csv", "in.csv", good, http.StatusOK, true},
+		{"txt", "in.txt", good, http.StatusOK, true},
+		{"invalid csv", "in.csv", "a,b\n1,2\n", http.StatusOK, false},
+		{"xlsx", "in.xlsx", good, http.StatusBadRequest, false},
+		{"upper case", "IN.CSV", good, http.StatusBadRequest, false},
+		{"no file", "", "", http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := store.Len()
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			if tt.filename != "" {
+				fw, _ := mw.CreateFormFile("file", tt.filename)
+				io.WriteString(fw, tt.content)
+			}
+			mw.Close()
+			req := httptest.NewRequest(http.MethodPost, "/validate", &body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			rec := httptest.NewRecorder()
+			validateUpload(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d %q, want %d", rec.Code, rec.Body.String(), tt.status)
+			}
+			if tt.status == http.StatusOK {
+				got := decodeBody(t, rec, http.StatusOK)
+				if got["valid"] != tt.valid {
+					t.Errorf("valid = %v, want %v (%v)", got["valid"], tt.valid, got)
+				}
+			}
+			if store.Len() != before {
+				t.Error("validation stored a result")
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	validateUpload(rec, httptest.NewRequest(http.MethodGet, "/validate", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status %d, want 405", rec.Code)
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	t.Setenv("RETAIN_MAX", "1h")
+	post := func(form url.Values) map[string]any {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/validate-params", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		validateParams(rec, req)
+		return decodeBody(t, rec, http.StatusOK)
+	}
+
+	// Итоговые параметры — после умолчаний и ограничений.
+	got := post(url.Values{"p_layers": {"2"}, "retain": {"3h"}, "labels": {"team=ops"}, "sync": {"false"}})
+	params, _ := got["parameters"].(map[string]any)
+	if got["valid"] != true || got["async"] != true || params["p_layers"] != 2.0 || params["retain_seconds"] != 3600.0 {
+		t.Errorf("valid form: %v", got)
+	}
+	if labels, _ := got["labels"].(map[string]any); labels["team"] != "ops" {
+		t.Errorf("labels = %v", got["labels"])
+	}
+
+	// Все ошибки полей — одним ответом, как у /process.
+	got = post(url.Values{"p_layers": {"0"}, "seed": {"x"}})
+	fields, _ := got["fields"].(map[string]any)
+	if got["valid"] != false || fields["p_layers"] == nil || fields["seed"] == nil {
+		t.Errorf("invalid form: %v", got)
+	}
+
+	rec := httptest.NewRecorder()
+	validateParams(rec, httptest.NewRequest(http.MethodGet, "/validate-params", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status %d, want 405", rec.Code)
+	}
+}
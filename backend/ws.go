@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GET /ws?id= — WebSocket-канал задачи для интерактивной консоли. Сервер
+// шлёт {"type":"status","job":...} — тот же снимок, что /status, — при
+// каждом его изменении (состояние, прогресс итераций, ETA) и закрывает
+// соединение после конечного состояния. Клиент может прислать
+// {"action":"cancel"}; ответ — {"type":"cancel","ok":...}.
+//
+// Реализован минимальный RFC 6455 без расширений: кадры от клиента
+// маскированы и не фрагментированы, команды не длиннее wsMaxMessage.
+
+const (
+	wsGUID       = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsMaxMessage = 4096
+
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xA
+
+	wsCloseNormal      = 1000
+	wsCloseProtocol    = 1002
+	wsCloseUnsupported = 1003
+	wsCloseTooBig      = 1009
+)
+
+// wsConn — соединение после апгрейда; запись из нескольких горутин идёт
+// под mu.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	mu   sync.Mutex
+}
+
+// wsCloseError — клиент нарушил протокол; соединение закрывается с code.
+type wsCloseError struct {
+	code   int
+	reason string
+}
+
+func (e *wsCloseError) Error() string { return e.reason }
+
+func jobSocket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	tenant := tenantOf(r)
+	if _, ok := jobs.Get(id, tenant); !ok {
+		if jobs.Pruned(id, tenant) {
+			http.Error(w, "job is no longer in the history (MAX_JOB_HISTORY / JOB_HISTORY_TTL)", http.StatusGone)
+			return
+		}
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return
+	}
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "websocket not supported: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Time{})
+	sum := sha1.Sum([]byte(key + wsGUID))
+	fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := brw.Flush(); err != nil {
+		return
+	}
+	ws := &wsConn{conn: conn, br: brw.Reader}
+	ws.serveJob(id, tenant, getenvDuration("WS_POLL_INTERVAL", 500*time.Millisecond), getenvDuration("WS_PING_INTERVAL", 30*time.Second))
+}
+
+// serveJob шлёт снимки задачи и обрабатывает команды клиента, пока задача
+// не завершится, клиент не отключится или не перестанет отвечать на ping.
+func (ws *wsConn) serveJob(id, tenant string, poll, ping time.Duration) {
+	done := make(chan error, 1)
+	var lastSeen time.Time
+	var seenMu sync.Mutex
+	touch := func() {
+		seenMu.Lock()
+		lastSeen = time.Now()
+		seenMu.Unlock()
+	}
+	touch()
+	go func() { done <- ws.readLoop(id, tenant, touch) }()
+
+	pollTicker := time.NewTicker(poll)
+	defer pollTicker.Stop()
+	pingTicker := time.NewTicker(ping)
+	defer pingTicker.Stop()
+	var last []byte
+	for {
+		job, ok := jobs.Get(id, tenant)
+		if !ok {
+			ws.close(wsCloseNormal, "job removed")
+			return
+		}
+		b, err := json.Marshal(map[string]any{"type": "status", "job": job})
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(b, last) {
+			if err := ws.write(wsText, b); err != nil {
+				return
+			}
+			last = b
+		}
+		switch job.State {
+		case jobDone, jobFailed, jobCancelled:
+			ws.close(wsCloseNormal, job.State)
+			return
+		}
+
+		select {
+		case err := <-done:
+			var cerr *wsCloseError
+			if errors.As(err, &cerr) {
+				ws.close(cerr.code, cerr.reason)
+			}
+			return
+		case <-pollTicker.C:
+		case <-pingTicker.C:
+			seenMu.Lock()
+			idle := time.Since(lastSeen)
+			seenMu.Unlock()
+			if idle > 2*ping {
+				log.Printf("WebSocket for job %s: no pong for %s, closing", id, idle.Round(time.Second))
+				return
+			}
+			if err := ws.write(wsPing, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readLoop читает кадры клиента до закрытия соединения. Любой кадр
+// считается признаком жизни клиента (touch).
+func (ws *wsConn) readLoop(id, tenant string, touch func()) error {
+	for {
+		op, payload, err := ws.readFrame()
+		if err != nil {
+			return err
+		}
+		touch()
+		switch op {
+		case wsPing:
+			if err := ws.write(wsPong, payload); err != nil {
+				return err
+			}
+		case wsPong:
+		case wsClose:
+			return &wsCloseError{code: wsCloseNormal, reason: "client closed"}
+		case wsText:
+			var cmd struct {
+				Action string `json:"action"`
+			}
+			reply := map[string]any{"type": "error", "message": `expected {"action":"cancel"}`}
+			if json.Unmarshal(payload, &cmd) == nil && cmd.Action == "cancel" {
+				ok := jobs.Cancel(id, tenant)
+				if ok {
+					log.Printf("Job %s cancel requested over WebSocket", id)
+				}
+				reply = map[string]any{"type": "cancel", "ok": ok}
+			}
+			b, _ := json.Marshal(reply)
+			if err := ws.write(wsText, b); err != nil {
+				return err
+			}
+		default:
+			return &wsCloseError{code: wsCloseUnsupported, reason: "unsupported frame"}
+		}
+	}
+}
+
+// readFrame читает один кадр клиента и снимает маску.
+func (ws *wsConn) readFrame() (op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.br, head[:]); err != nil {
+		return 0, nil, err
+	}
+	fin, op := head[0]&0x80 != 0, head[0]&0x0f
+	if !fin || op == 0 {
+		return 0, nil, &wsCloseError{code: wsCloseUnsupported, reason: "fragmented messages are not supported"}
+	}
+	if head[1]&0x80 == 0 {
+		return 0, nil, &wsCloseError{code: wsCloseProtocol, reason: "client frames must be masked"}
+	}
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxMessage {
+		return 0, nil, &wsCloseError{code: wsCloseTooBig, reason: "message too big"}
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.br, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(ws.br, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
+
+// write отправляет один немаскированный кадр.
+func (ws *wsConn) write(op byte, payload []byte) error {
+	frame := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+func (ws *wsConn) close(code int, reason string) {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	ws.write(wsClose, append(payload, truncate(reason, 120)...))
+}
+
+// headerHasToken — есть ли token (без учёта регистра) в списке значений
+// заголовка через запятую.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
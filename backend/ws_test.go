@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsClient — минимальный клиент RFC 6455 для тестов /ws.
+type wsClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialJobSocket(t *testing.T, srv *httptest.Server, id string) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	io.WriteString(conn, "GET /ws?id="+id+" HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Пример из RFC 6455, раздел 1.3.
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake: %s %v", resp.Status, resp.Header)
+	}
+	return &wsClient{conn: conn, br: br}
+}
+
+func (c *wsClient) send(op byte, payload []byte) {
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | op, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	c.conn.Write(frame)
+}
+
+func (c *wsClient) read(t *testing.T) (byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	n := int(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.br, ext[:])
+		n = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		t.Fatalf("read payload: %v", err)
+	}
+	return head[0] & 0x0f, payload
+}
+
+// readEvent пропускает служебные кадры и возвращает следующее сообщение.
+func (c *wsClient) readEvent(t *testing.T) map[string]any {
+	t.Helper()
+	for {
+		op, payload := c.read(t)
+		switch op {
+		case wsText:
+			var ev map[string]any
+			if err := json.Unmarshal(payload, &ev); err != nil {
+				t.Fatalf("event %q: %v", payload, err)
+			}
+			return ev
+		case wsClose:
+			t.Fatalf("unexpected close %d %q", binary.BigEndian.Uint16(payload), payload[2:])
+		}
+	}
+}
+
+func TestJobSocket(t *testing.T) {
+	defer func(j *jobRegistry) { jobs = j }(jobs)
+	jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+	t.Setenv("WS_POLL_INTERVAL", "20ms")
+	srv := httptest.NewServer(http.HandlerFunc(jobSocket))
+	defer srv.Close()
+
+	id := genID()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	jobs.Start(&jobRecord{ID: id}, cancel)
+	jobs.Running(id)
+	c := dialJobSocket(t, srv, id)
+
+	ev := c.readEvent(t)
+	if ev["type"] != "status" || ev["job"].(map[string]any)["state"] != jobRunning {
+		t.Fatalf("first event = %v", ev)
+	}
+	// Прогресс итераций приходит новым снимком.
+	jobs.Update(id, func(job *jobRecord) {
+		job.Convergence = append(job.Convergence, convergencePoint{Iteration: 1, Objective: 5})
+	})
+	ev = c.readEvent(t)
+	if conv, _ := ev["job"].(map[string]any)["convergence"].([]any); len(conv) != 1 {
+		t.Fatalf("progress event = %v", ev)
+	}
+
+	c.send(wsPing, []byte("hi"))
+	if op, payload := c.read(t); op != wsPong || string(payload) != "hi" {
+		t.Fatalf("ping answered with %x %q", op, payload)
+	}
+	c.send(wsText, []byte(`{"action":"pause"}`))
+	if ev := c.readEvent(t); ev["type"] != "error" {
+		t.Fatalf("unknown command answered with %v", ev)
+	}
+	c.send(wsText, []byte(`{"action":"cancel"}`))
+	if ev := c.readEvent(t); ev["type"] != "cancel" || ev["ok"] != true {
+		t.Fatalf("cancel answered with %v", ev)
+	}
+	if !errors.Is(context.Cause(ctx), errJobCancelled) {
+		t.Fatalf("job context cause = %v, want %v", context.Cause(ctx), errJobCancelled)
+	}
+
+	// Задача завершилась — последний снимок и закрытие 1000.
+	jobs.Cancelled(id)
+	if ev := c.readEvent(t); ev["job"].(map[string]any)["state"] != jobCancelled {
+		t.Fatalf("final event = %v", ev)
+	}
+	op, payload := c.read(t)
+	if op != wsClose || binary.BigEndian.Uint16(payload) != wsCloseNormal {
+		t.Fatalf("want close 1000, got %x %q", op, payload)
+	}
+}
+
+func TestJobSocketRejects(t *testing.T) {
+	defer func(j *jobRegistry) { jobs = j }(jobs)
+	jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+	id := genID()
+	jobs.Start(&jobRecord{ID: id, Tenant: "team-a"}, nil)
+
+	upgrade := http.Header{
+		"Connection":            {"Upgrade"},
+		"Upgrade":               {"websocket"},
+		"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+		"Sec-Websocket-Version": {"13"},
+	}
+	tests := []struct {
+		name   string
+		id     string
+		header http.Header
+		want   int
+	}{
+		{"unknown job", genID(), upgrade, http.StatusNotFound},
+		{"other tenant", id, upgrade, http.StatusNotFound},
+		{"no upgrade", id, http.Header{"X-Tenant": {"team-a"}}, http.StatusBadRequest},
+		{"old version", id, http.Header{
+			"X-Tenant": {"team-a"}, "Connection": {"Upgrade"}, "Upgrade": {"websocket"},
+			"Sec-Websocket-Key": {"x"}, "Sec-Websocket-Version": {"8"},
+		}, http.StatusUpgradeRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ws?id="+tt.id, nil)
+			req.Header = tt.header
+			rec := httptest.NewRecorder()
+			jobSocket(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobSocketUnmaskedFrame(t *testing.T) {
+	defer func(j *jobRegistry) { jobs = j }(jobs)
+	jobs = &jobRegistry{jobs: make(map[string]*jobRecord), pruned: make(map[string]string)}
+	srv := httptest.NewServer(http.HandlerFunc(jobSocket))
+	defer srv.Close()
+	id := genID()
+	jobs.Start(&jobRecord{ID: id}, nil)
+	c := dialJobSocket(t, srv, id)
+	c.readEvent(t)
+
+	c.conn.Write([]byte{0x80 | wsText, 2, '{', '}'})
+	for {
+		op, payload := c.read(t)
+		if op == wsClose {
+			if code := binary.BigEndian.Uint16(payload); code != wsCloseProtocol {
+				t.Errorf("close code %d, want %d", code, wsCloseProtocol)
+			}
+			return
+		}
+	}
+}